@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"chatgpt-adapter/core/common/jwtkey"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const usage = `Usage: keys <command> [options]
+
+Commands:
+  keygen    Generate an EdDSA key pair in PEM format
+  mint      Sign a gateway API key
+  inspect   Decode a gateway API key, verifying it when a key is given
+
+Run 'keys <command> -h' for the options of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Print(usage)
+		os.Exit(1)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "keygen":
+		err = keygen(os.Args[2:])
+	case "mint":
+		err = mint(os.Args[2:])
+	case "inspect":
+		err = inspect(os.Args[2:])
+	default:
+		fmt.Print(usage)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// mint 与 inspect 共用的密钥参数
+func signerFlags(fs *flag.FlagSet) func() (*jwtkey.Signer, error) {
+	alg := fs.String("alg", "HS256", "Signing algorithm: HS256 or EdDSA")
+	secret := fs.String("secret", os.Getenv("JWT_SECRET"), "HS256 secret (default $JWT_SECRET)")
+	privateKey := fs.String("private-key", "", "EdDSA private key, PEM content or file path")
+	publicKey := fs.String("public-key", "", "EdDSA public key, PEM content or file path")
+	issuer := fs.String("issuer", "", "Issuer, must match jwt.issuer of the server")
+	return func() (*jwtkey.Signer, error) {
+		return jwtkey.New(*alg, *secret, *privateKey, *publicKey, *issuer)
+	}
+}
+
+// 生成 EdDSA 密钥对
+func keygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	output := fs.String("output", "", "Write <output>.pem and <output>.pub.pem instead of stdout")
+	_ = fs.Parse(args)
+
+	private, public, err := jwtkey.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		fmt.Print(private + public)
+		return nil
+	}
+
+	if err = os.WriteFile(*output+".pem", []byte(private), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(*output+".pub.pem", []byte(public), 0644)
+}
+
+// 签发网关密钥，必须指定有效期，签发后无法吊销
+func mint(args []string) error {
+	fs := flag.NewFlagSet("mint", flag.ExitOnError)
+	newSigner := signerFlags(fs)
+	subject := fs.String("subject", "", "Key owner, shown in logs and usage reports")
+	id := fs.String("id", "", "Key id (jti), rate limits are counted per id (default: random)")
+	tenant := fs.String("tenant", "", "Tenant id")
+	models := fs.String("models", "", "Comma separated model patterns (regex of the whole model name)")
+	adapters := fs.String("adapters", "", "Comma separated adapter names")
+	rpm := fs.Int("rpm", 0, "Requests per minute, 0 for unlimited")
+	tpd := fs.Int("tpd", 0, "Tokens per day, 0 for unlimited")
+	ttl := fs.Duration("ttl", 0, "Time to live, e.g. 720h (required)")
+	_ = fs.Parse(args)
+
+	if *subject == "" {
+		return fmt.Errorf("-subject is required")
+	}
+	if *ttl <= 0 {
+		return fmt.Errorf("-ttl is required, keys can not be revoked")
+	}
+
+	signer, err := newSigner()
+	if err != nil {
+		return err
+	}
+
+	token, err := signer.Mint(jwtkey.Claims{
+		Tenant:   *tenant,
+		Models:   split(*models),
+		Adapters: split(*adapters),
+		RPM:      *rpm,
+		TPD:      *tpd,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:      *id,
+			Subject: *subject,
+		},
+	}, *ttl)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(token)
+	return nil
+}
+
+// 解析网关密钥的内容
+func inspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	newSigner := signerFlags(fs)
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: keys inspect [options] <token>")
+	}
+
+	token := fs.Arg(0)
+	claims, header, err := jwtkey.Inspect(token)
+	if err != nil {
+		return err
+	}
+
+	// 提供了密钥时才校验签名
+	verified := "unverified"
+	if signer, e := newSigner(); e == nil {
+		if _, err = signer.Parse(token); err != nil {
+			verified = "invalid: " + err.Error()
+		} else {
+			verified = "valid"
+		}
+	}
+
+	expires := "never"
+	if claims.ExpiresAt != nil {
+		expires = claims.ExpiresAt.Format(time.RFC3339)
+	}
+
+	bytes, err := json.MarshalIndent(map[string]interface{}{
+		"header":    header,
+		"claims":    claims,
+		"expires":   expires,
+		"signature": verified,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(bytes))
+	return nil
+}
+
+// 逗号分隔的列表，忽略空项
+func split(value string) (values []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"chatgpt-adapter/core/common/ledger"
+)
+
+const usage = `Usage: usage export [options]
+
+Export the usage ledger to CSV, one row per request or aggregated with -group.
+`
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "export" {
+		fmt.Print(usage)
+		os.Exit(1)
+	}
+
+	if err := export(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// 导出 [from, to] 日期内的用量记录，未指定 -group 时每个请求一行
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	path := fs.String("path", "usage", "Ledger directory, same as usage.path")
+	from := fs.String("from", "", "First day, YYYY-MM-DD (default: 29 days before -to)")
+	to := fs.String("to", time.Now().Format(time.DateOnly), "Last day, YYYY-MM-DD")
+	group := fs.String("group", "", "Aggregate by comma separated fields: day,key,tenant,model,adapter")
+	key := fs.String("key", "", "Only export the given key hash or label")
+	output := fs.String("output", "", "Output file (default: stdout)")
+	_ = fs.Parse(args)
+
+	end, err := time.ParseInLocation(time.DateOnly, *to, time.Local)
+	if err != nil {
+		return fmt.Errorf("invalid -to: %v", err)
+	}
+
+	start := end.AddDate(0, 0, -29)
+	if *from != "" {
+		if start, err = time.ParseInLocation(time.DateOnly, *from, time.Local); err != nil {
+			return fmt.Errorf("invalid -from: %v", err)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	filter := func(row ledger.Row) bool {
+		return *key == "" || row.Key == *key || row.Label == *key
+	}
+
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	// 逐行导出原始记录
+	if *group == "" {
+		_ = writer.Write([]string{"time", "key", "label", "tenant", "model", "adapter", "account",
+			"prompt_tokens", "completion_tokens", "latency_ms", "status", "cost"})
+		err = ledger.Read(*path, start, end, filter, func(row ledger.Row) {
+			_ = writer.Write([]string{
+				row.Time.Format(time.RFC3339), row.Key, row.Label, row.Tenant, row.Model, row.Adapter, row.Account,
+				strconv.Itoa(row.PromptTokens), strconv.Itoa(row.CompletionTokens),
+				strconv.FormatInt(row.Latency, 10), strconv.Itoa(row.Status), cost(row.Cost),
+			})
+		})
+		return err
+	}
+
+	// 按 -group 汇总，字段与 /v1/usage 的 group_by 相同
+	data, err := ledger.Summarize(*path, start, end, strings.Split(*group, ","), filter)
+	if err != nil {
+		return err
+	}
+
+	_ = writer.Write([]string{"day", "key", "label", "tenant", "model", "adapter",
+		"requests", "failures", "prompt_tokens", "completion_tokens", "avg_latency_ms", "cost"})
+	for _, agg := range data {
+		_ = writer.Write([]string{
+			agg.Day, agg.Key, agg.Label, agg.Tenant, agg.Model, agg.Adapter,
+			strconv.Itoa(agg.Requests), strconv.Itoa(agg.Failures),
+			strconv.Itoa(agg.PromptTokens), strconv.Itoa(agg.CompletionTokens),
+			strconv.FormatInt(agg.Latency, 10), cost(agg.Cost),
+		})
+	}
+	return writer.Error()
+}
+
+// 费用保留 6 位小数
+func cost(value float64) string {
+	return strconv.FormatFloat(value, 'f', 6, 64)
+}
@@ -26,6 +26,7 @@ var (
 	cursorCacheManager    *Manager[string]
 	qodoCacheManager      *Manager[string]
 	zedCacheManager       *Manager[string]
+	responsesCacheManager *Manager[[]model.Keyv[interface{}]]
 )
 
 func init() {
@@ -59,6 +60,11 @@ func init() {
 		zedCacheManager = &Manager[string]{
 			cache.New[string](gocacheStore.NewGoCache(client)),
 		}
+
+		client = gocache.New(30*time.Minute, 5*time.Minute)
+		responsesCacheManager = &Manager[[]model.Keyv[interface{}]]{
+			cache.New[[]model.Keyv[interface{}]](gocacheStore.NewGoCache(client)),
+		}
 	})
 }
 
@@ -86,6 +92,10 @@ func ZedCacheManager() *Manager[string] {
 	return zedCacheManager
 }
 
+func ResponsesCacheManager() *Manager[[]model.Keyv[interface{}]] {
+	return responsesCacheManager
+}
+
 func (cacheManager *Manager[T]) SetValue(key string, value T) error {
 	return cacheManager.SetWithExpiration(key, value, 120*time.Second)
 }
@@ -118,7 +118,7 @@ TOOL_CALL:
 toolId将作为用户调用工具的依据，当需要执行工具时尽量携带此参数。
 
 请你根据工具描述，决定回答问题或是使用工具。在完成任务过程中，USER代表用户的输入，TOOL_RESPONSE代表工具运行结果。ASSISTANT 代表你的输出。
-{{- if eq .toolDef "-1" }}
+{{- if and (eq .toolDef "-1") (not .required) }}
 你的每次输出都必须以0,1开头，代表是否需要调用工具：
 0: 不使用工具。
 1: 使用工具，返回工具调用的参数。
@@ -127,6 +127,12 @@ toolId将作为用户调用工具的依据，当需要执行工具时尽量携
 0: 不使用工具。
 1: 使用工具，返回工具调用的参数。
 {{- end }}
+{{- if .required }}
+本次必须使用工具，不允许直接回答。
+{{- end }}
+{{- if .parallel }}
+需要同时调用多个工具时，以数组的形式返回全部工具调用的参数：1: [{"toolId":"xxx","arguments":{...}}, ...]。
+{{- end }}
 例如：
 
 USER: 你好呀 <|end|>
@@ -152,6 +158,17 @@ ANSWER: 0: <|end|>
 {{- else }}
 ANSWER: 1: {"toolId":"{{.toolDef}}","arguments":{}} <|end|>
 {{- end }}
+{{- if .parallel }}
+
+USER: 杭州和深圳今天的天气如何 <|end|>
+ANSWER: 1: [{"toolId":"testToolId","arguments":{"city": "杭州"}}, {"toolId":"testToolId","arguments":{"city": "深圳"}}] <|end|>
+TOOL_RESPONSE: """
+杭州：晴天......
+"""
+TOOL_RESPONSE: """
+深圳：多云......
+"""
+{{- end }}
 
 
 现在，我们开始吧！下面是你本次可以使用的工具：
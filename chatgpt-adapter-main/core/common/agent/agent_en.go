@@ -0,0 +1,206 @@
+package agent
+
+const ToolTasksEn = `{{- range $index, $value := .pMessages}}
+{{- if eq $value.role "tool" }}
+<|tool|>
+TOOL_RESPONSE:
+  name: "{{ ToolId $value.name }}"
+  description: "{{ ToolDesc $value.name }}"
+
+output: {{ $value.content }}
+<|end|>
+{{- else if and (eq $value.role "assistant") (gt (Len $value.tool_calls) 0) }}
+<|assistant|>
+{{- range $toolCall := $value.tool_calls }}
+TOOL_CALL:
+  name: "{{ ToolId $toolCall.function.name }}"
+  arguments: "{{ $toolCall.function.arguments }}"
+{{- end }}
+<|end|>
+{{ else }}
+<|{{$value.role}}|>
+{{$value.content}}
+<|end|>
+{{end -}}
+{{end}}
+
+
+You are an intelligent assistant that specializes in breaking a request down into tasks. Sometimes you can rely on the results of tools to answer the user more accurately.
+
+Break the user request down into at most 3 sub-tasks. USER is the user input, TOOL_RESPONSE is the result of a tool and ANSWER is your output, task is the description of a sub-task.
+Read the context above and avoid sub-tasks that are unrelated to the latest user request.
+
+Every output of yours must start with 0 or 1, indicating whether the request needs to be broken down:
+
+Each task-item contains two keys: "toolId" (string) and "task" (string).
+0: no tasks.
+1: [{"toolId": "xxx", "task": "the weather in xxx today"}, ...].
+
+For example:
+
+USER: Hello <|end|>
+ANSWER: 0: no tasks <|end|>
+USER: What's the weather like in London today? <|end|>
+ANSWER: 1: [{"toolId": "testToolId", "task": "the weather in London today"}] <|end|>
+TOOL_RESPONSE: """
+Sunny......
+"""
+
+USER: Where should I go in London with today's weather? <|end|>
+ANSWER: 1: [{"toolId": "testToolId", "task": "the weather in London today"}, {"toolId": "testToolId2", "task": "places to visit in London for this weather"}] <|end|>
+TOOL_RESPONSE: """
+Sunny. Hyde Park, the British Museum, Greenwich......
+"""
+ANSWER: 0: no tasks <|end|>
+
+USER: Get the weather in Paris and send it to the Slack channel <|end|>
+ANSWER: 1: [{"toolId": "testToolId", "task": "the weather in Paris"}, {"toolId": "testToolId2", "task": "send the weather in Paris to the Slack channel"}] <|end|>
+
+
+Now let's begin! These are the tools you can use this time:
+"""
+[
+    {{- range $index, $value := .tools}}
+    {{- if eq $value.type "function" }}
+    {
+        "toolId": "{{$value.function.id}}",
+        "description": "{{$value.function.description}}",
+        "parameters": {
+             "type": "object",
+             "properties": {
+{{- range $key, $v := $value.function.parameters.properties}}
+                 "{{$key}}": {
+                     "type": "{{$v.type}}",
+                     "description": "{{ Enc $v.description }}"
+                 }
+{{- end }}
+             }
+        },
+        "required": [{{Join $value.function.parameters.required ", " }}]
+    },
+    {{- end -}}
+    {{- end}}
+]
+"""
+
+Here is the actual conversation, output the list of tasks directly:
+USER: {{.content}}
+ANSWER: `
+
+const ToolCallEn = `{{- range $index, $value := .pMessages}}
+{{- if eq $value.role "tool" }}
+<|tool|>
+TOOL_RESPONSE:
+  name: "{{ ToolId $value.name }}"
+  description: "{{ ToolDesc $value.name }}"
+
+output: {{ $value.content }}
+<|end|>
+{{- else if and (eq $value.role "assistant") (gt (Len $value.tool_calls) 0) }}
+<|assistant|>
+{{- range $toolCall := $value.tool_calls }}
+TOOL_CALL:
+  name: "{{ ToolId $toolCall.function.name }}"
+  arguments: "{{ $toolCall.function.arguments }}"
+{{- end }}
+<|end|>
+{{ else }}
+<|{{$value.role}}|>
+{{$value.content}}
+<|end|>
+{{end -}}
+{{end}}
+
+
+You are an intelligent assistant that specializes in choosing tools for the user. You are in an offline environment and must not output the results of tools yourself. Sometimes you can rely on the results of tools to answer the user more accurately.
+
+Tools are declared in JSON Schema format: toolId identifies the tool, description describes it, parameters are its arguments with their types and descriptions, and required lists the mandatory arguments.
+The toolId is how the user calls a tool, always include it when a tool should be executed.
+
+Decide whether to answer the question or to use a tool according to the tool descriptions. USER is the user input, TOOL_RESPONSE is the result of a tool and ANSWER is your output.
+{{- if and (eq .toolDef "-1") (not .required) }}
+Every output of yours must start with 0 or 1, indicating whether a tool should be called:
+0: do not use a tool.
+1: use a tool and return the arguments of the tool call.
+{{- else }}
+This output of yours must start with 1, indicating whether a tool should be called:
+0: do not use a tool.
+1: use a tool and return the arguments of the tool call.
+{{- end }}
+{{- if .required }}
+You must use a tool this time, answering directly is not allowed.
+{{- end }}
+{{- if .parallel }}
+When several tools should be called at the same time, return the arguments of all tool calls as an array: 1: [{"toolId":"xxx","arguments":{...}}, ...].
+{{- end }}
+For example:
+
+USER: Hello <|end|>
+{{- if eq .toolDef "-1" }}
+ANSWER: 0: <|end|>
+{{- else }}
+ANSWER: 1: {"toolId":"{{.toolDef}}","arguments":{}} <|end|>
+{{- end }}
+
+USER: What's the weather like in London today? <|end|>
+ANSWER: 1: {"toolId":"testToolId","arguments":{"city": "London"}} <|end|>
+TOOL_RESPONSE: """
+Sunny......
+"""
+
+USER: Where should I go in London with today's weather? <|end|>
+ANSWER: 1: {"toolId":"testToolId2","arguments":{"query": "London weather places to visit"}} <|end|>
+TOOL_RESPONSE: """
+Sunny. Hyde Park, the British Museum, Greenwich......
+"""
+{{- if eq .toolDef "-1" }}
+ANSWER: 0: <|end|>
+{{- else }}
+ANSWER: 1: {"toolId":"{{.toolDef}}","arguments":{}} <|end|>
+{{- end }}
+{{- if .parallel }}
+
+USER: What's the weather like in London and Paris today? <|end|>
+ANSWER: 1: [{"toolId":"testToolId","arguments":{"city": "London"}}, {"toolId":"testToolId","arguments":{"city": "Paris"}}] <|end|>
+TOOL_RESPONSE: """
+London: sunny......
+"""
+TOOL_RESPONSE: """
+Paris: cloudy......
+"""
+{{- end }}
+
+
+Now let's begin! These are the tools you can use this time:
+"""
+[
+    {{- range $index, $value := .tools}}
+    {{- if eq $value.type "function" }}
+    {
+        "toolId": "{{$value.function.id}}",
+        "description": "{{$value.function.description}}",
+        "parameters": {
+             "type": "object",
+             "properties": {
+{{- range $key, $v := $value.function.parameters.properties}}
+                 "{{$key}}": {
+                     "type": "{{$v.type}}",
+                     "description": "{{ Enc $v.description }}"{{ if gt (Len $v.enum) 0 }},
+                     "enum": [{{ Join $v.enum ", " }}]{{end}}
+                 }
+{{- end }}
+             }
+        },
+        "required": [{{Join $value.function.parameters.required ", " }}]
+    },
+    {{- end -}}
+    {{- end}}
+]
+"""
+
+{{ if gt (len .excludeTaskContents) 0 }}
+Note: {{ .excludeTaskContents }}.
+{{- end }}
+Here is the actual conversation, output the tool call directly:
+USER: {{.content}}
+ANSWER: `
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/logger"
+	"github.com/bincooo/emit.io"
+	"github.com/iocgo/sdk/env"
+)
+
+// Reason 账号异常的原因，决定冷却策略
+type Reason string
+
+const (
+	ReasonNone         Reason = ""
+	ReasonRateLimited  Reason = "rate-limited"
+	ReasonUnauthorized Reason = "unauthorized"
+	ReasonUpstream     Reason = "upstream-error"
+	ReasonCaptcha      Reason = "captcha"
+)
+
+// Backoff 冷却策略：base * factor^(连续失败次数-1)，不超过 max，并加上 ±jitter 比例的随机抖动。
+// quarantine 为 true 时永久隔离，需要通过管理接口复位
+type Backoff struct {
+	Base       int     `mapstructure:"base"` // 秒
+	Max        int     `mapstructure:"max"`  // 秒
+	Factor     float64 `mapstructure:"factor"`
+	Jitter     float64 `mapstructure:"jitter"`
+	Quarantine bool    `mapstructure:"quarantine"`
+}
+
+var (
+	// 默认策略，base 为 0 时使用账号池的 resetTime
+	backoffs = map[Reason]Backoff{
+		ReasonRateLimited:  {Factor: 2, Max: 24 * 3600, Jitter: 0.2},
+		ReasonUpstream:     {Base: 10, Factor: 2, Max: 600, Jitter: 0.2},
+		ReasonCaptcha:      {Base: 60, Factor: 2, Max: 3600, Jitter: 0.2},
+		ReasonUnauthorized: {Quarantine: true},
+	}
+
+	// 按账号池名称覆盖
+	poolBackoffs = make(map[string]map[Reason]Backoff)
+)
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		var config map[string]Backoff
+		if err := env.UnmarshalKey("backoff", &config); err != nil {
+			logger.Fatal(err)
+		}
+		for reason, b := range config {
+			backoffs[Reason(reason)] = b
+		}
+
+		var pools map[string]map[string]Backoff
+		if err := env.UnmarshalKey("backoff-pools", &pools); err != nil {
+			logger.Fatal(err)
+		}
+		for name, config := range pools {
+			poolBackoffs[name] = make(map[Reason]Backoff)
+			for reason, b := range config {
+				poolBackoffs[name][Reason(reason)] = b
+			}
+		}
+	})
+}
+
+func backoffOf(pool string, reason Reason) Backoff {
+	if b, ok := poolBackoffs[pool][reason]; ok {
+		return b
+	}
+	if b, ok := backoffs[reason]; ok {
+		return b
+	}
+	return backoffs[ReasonUpstream]
+}
+
+// 第 failures 次连续失败的冷却时间
+func (b Backoff) delay(failures int, resetTime time.Duration) time.Duration {
+	base := time.Duration(b.Base) * time.Second
+	if base <= 0 {
+		base = resetTime
+	}
+	if base <= 0 {
+		base = time.Minute
+	}
+
+	factor := b.Factor
+	if factor < 1 {
+		factor = 1
+	}
+
+	d := float64(base) * math.Pow(factor, float64(max(0, failures-1)))
+	if b.Jitter > 0 {
+		d *= 1 + b.Jitter*(2*rand.Float64()-1)
+	}
+	if b.Max > 0 {
+		d = math.Min(d, float64(time.Duration(b.Max)*time.Second))
+	}
+	return time.Duration(d)
+}
+
+// ReasonOf 根据上游错误判断原因，请求被取消等与账号无关的错误返回 ReasonNone
+func ReasonOf(err error) Reason {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return ReasonNone
+	}
+
+	msg := strings.ToLower(err.Error())
+	if strings.Contains(msg, "captcha") || strings.Contains(msg, "challenge") || strings.Contains(msg, "cloudflare") {
+		return ReasonCaptcha
+	}
+	if strings.Contains(msg, "quota") || strings.Contains(msg, "rate limit") {
+		return ReasonRateLimited
+	}
+
+	var busErr emit.Error
+	if !errors.As(err, &busErr) {
+		return ReasonUpstream
+	}
+
+	switch code := busErr.Code; {
+	case code == http.StatusUnauthorized:
+		return ReasonUnauthorized
+	case code == http.StatusForbidden:
+		return ReasonCaptcha
+	case code == http.StatusTooManyRequests:
+		return ReasonRateLimited
+	case code >= 500 || code <= 0:
+		return ReasonUpstream
+	}
+	return ReasonNone
+}
@@ -0,0 +1,147 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bincooo/emit.io"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		backoff   Backoff
+		failures  int
+		resetTime time.Duration
+		want      time.Duration
+	}{
+		{"first failure", Backoff{Base: 10, Factor: 2}, 1, time.Hour, 10 * time.Second},
+		{"exponential", Backoff{Base: 10, Factor: 2}, 3, time.Hour, 40 * time.Second},
+		{"max", Backoff{Base: 10, Factor: 2, Max: 30}, 3, time.Hour, 30 * time.Second},
+		{"reset time as base", Backoff{Factor: 2}, 2, time.Minute, 2 * time.Minute},
+		{"default base", Backoff{}, 1, 0, time.Minute},
+		{"factor below one", Backoff{Base: 10, Factor: 0.5}, 4, 0, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.backoff.delay(tt.failures, tt.resetTime); got != tt.want {
+				t.Errorf("delay = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	b := Backoff{Base: 100, Factor: 2, Max: 150, Jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		if d := b.delay(1, 0); d < 80*time.Second || d > 120*time.Second {
+			t.Fatalf("delay with jitter = %v, want 80s..120s", d)
+		}
+		if d := b.delay(5, 0); d > 150*time.Second {
+			t.Fatalf("delay with jitter = %v, want at most the max", d)
+		}
+	}
+}
+
+func TestBackoffOf(t *testing.T) {
+	poolBackoffs["test-pool"] = map[Reason]Backoff{ReasonRateLimited: {Base: 5}}
+	t.Cleanup(func() { delete(poolBackoffs, "test-pool") })
+
+	if b := backoffOf("test-pool", ReasonRateLimited); b.Base != 5 {
+		t.Errorf("pool backoff = %+v", b)
+	}
+	if b := backoffOf("test-pool", ReasonUnauthorized); !b.Quarantine {
+		t.Errorf("default unauthorized backoff = %+v", b)
+	}
+	if b := backoffOf("other", Reason("unknown")); b != backoffs[ReasonUpstream] {
+		t.Errorf("unknown reason backoff = %+v", b)
+	}
+}
+
+func TestReasonOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Reason
+	}{
+		{"nil", nil, ReasonNone},
+		{"canceled", fmt.Errorf("request: %w", context.Canceled), ReasonNone},
+		{"unauthorized", emit.Error{Code: 401, Err: errors.New("401 Unauthorized")}, ReasonUnauthorized},
+		{"forbidden", emit.Error{Code: 403, Err: errors.New("403 Forbidden")}, ReasonCaptcha},
+		{"too many requests", emit.Error{Code: 429, Err: errors.New("429 Too Many Requests")}, ReasonRateLimited},
+		{"bad gateway", emit.Error{Code: 502, Err: errors.New("502 Bad Gateway")}, ReasonUpstream},
+		{"response is nil", emit.Error{Code: -1, Err: errors.New("response is nil")}, ReasonUpstream},
+		{"bad request", emit.Error{Code: 400, Err: errors.New("400 Bad Request")}, ReasonNone},
+		{"wrapped", fmt.Errorf("chat: %w", emit.Error{Code: 401, Err: errors.New("401")}), ReasonUnauthorized},
+		{"captcha message", errors.New("please complete the cloudflare challenge"), ReasonCaptcha},
+		{"quota message", errors.New("You have exceeded your quota"), ReasonRateLimited},
+		{"network", errors.New("connection reset by peer"), ReasonUpstream},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReasonOf(tt.err); got != tt.want {
+				t.Errorf("ReasonOf(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkFailed(t *testing.T) {
+	container := newTestContainer(t, strategyConfig{}, "a", "b")
+	poolBackoffs[container.Name()] = map[Reason]Backoff{ReasonRateLimited: {Base: 60, Factor: 2, Max: 3600}}
+	t.Cleanup(func() { delete(poolBackoffs, container.Name()) })
+
+	cooldown := func(value string) Member {
+		return memberStates(container)[container.Id(value)]
+	}
+
+	// 连续失败时冷却时间翻倍
+	for i, want := range []int64{60, 120, 240} {
+		if err := container.MarkFailed("a", ReasonRateLimited); err != nil {
+			t.Fatal(err)
+		}
+		m := cooldown("a")
+		if m.State != "error" || m.Reason != ReasonRateLimited || m.Failures != i+1 || m.Cooldown < want-1 || m.Cooldown > want {
+			t.Errorf("failure #%d: a = %+v, want cooldown %ds", i+1, m, want)
+		}
+	}
+
+	// 成功使用后清零
+	_ = container.MarkTo("a", 0)
+	_ = container.MarkFailed("a", ReasonRateLimited)
+	if m := cooldown("a"); m.Failures != 1 || m.Cooldown > 60 {
+		t.Errorf("a after success = %+v", m)
+	}
+
+	// ReasonNone 不改变状态
+	if value, _ := container.Poll(); value != "b" {
+		t.Fatalf("poll = %s, want b", value)
+	}
+	_ = container.MarkFailed("b", ReasonNone)
+	if m := cooldown("b"); m.State != "in-use" {
+		t.Errorf("b after ReasonNone = %+v", m)
+	}
+
+	// 401 永久隔离，只能通过管理接口复位
+	_ = container.MarkFailed("b", ReasonUnauthorized)
+	if m := cooldown("b"); m.State != "quarantined" || m.Reason != ReasonUnauthorized || m.Cooldown != 0 || m.InFlight != 0 {
+		t.Errorf("b after 401 = %+v", m)
+	}
+	if _, err := container.Poll(); err == nil {
+		t.Error("a quarantined member should not be polled")
+	}
+	_ = container.ResetMember(container.Id("b"))
+	if value, err := container.Poll(); err != nil || value != "b" {
+		t.Errorf("poll after reset = %s, %v", value, err)
+	}
+
+	// 排空中的成员失败后移除
+	_ = container.DrainMember(container.Id("b"))
+	_ = container.MarkFailed("b", ReasonUpstream)
+	if container.Len() != 1 {
+		t.Errorf("len = %d, the drained member should be removed", container.Len())
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/hex"
 	"io"
 	"math/rand"
-	"time"
 	"unsafe"
 
 	"chatgpt-adapter/core/logger"
@@ -20,22 +19,21 @@ func IsNIL(obj interface{}) bool {
 	return obj == nil || unpackEFace(obj).data == nil
 }
 
+// Hex 使用全局的随机源，同一时刻生成的多个值不会因种子相同而重复
 func Hex(n int) string {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	var runes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
 	bytes := make([]rune, n)
 	for i := range bytes {
-		bytes[i] = runes[r.Intn(len(runes))]
+		bytes[i] = runes[rand.Intn(len(runes))]
 	}
 	return string(bytes)
 }
 
 func RandInt(n int) string {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	var runes = []rune("1234567890")
 	bytes := make([]rune, n)
 	for i := range bytes {
-		bytes[i] = runes[r.Intn(len(runes))]
+		bytes[i] = runes[rand.Intn(len(runes))]
 	}
 	return string(bytes)
 }
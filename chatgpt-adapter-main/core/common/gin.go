@@ -12,6 +12,11 @@ func GetGinCompletion(ctx *gin.Context) (value model.Completion) {
 	return
 }
 
+func GetGinTextCompletion(ctx *gin.Context) (value model.TextCompletion) {
+	value, _ = GetGinValue[model.TextCompletion](ctx, vars.GinTextCompletion)
+	return
+}
+
 func GetGinEmbedding(ctx *gin.Context) (value model.Embed) {
 	value, _ = GetGinValue[model.Embed](ctx, vars.GinEmbedding)
 	return
@@ -0,0 +1,115 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Coerce 按照 schema 转换标量类型：字符串形式的数字、布尔值，
+// 数字转为字符串，单个值包装为数组等，无法转换时保持原值
+func Coerce(schema, value interface{}) interface{} {
+	obj, ok := schema.(map[string]interface{})
+	if !ok {
+		return value
+	}
+
+	types := schemaTypes(obj["type"])
+	for _, t := range types {
+		if IsType(t, value) {
+			return coerceChildren(obj, value)
+		}
+	}
+
+	for _, t := range types {
+		if result, ok := coerce(t, value); ok {
+			return coerceChildren(obj, result)
+		}
+	}
+	return coerceChildren(obj, value)
+}
+
+func coerceChildren(schema map[string]interface{}, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		for key, item := range v {
+			if sub, ok := properties[key]; ok {
+				v[key] = Coerce(sub, item)
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"]; ok {
+			for i, item := range v {
+				v[i] = Coerce(items, item)
+			}
+		}
+	}
+	return value
+}
+
+func coerce(t string, value interface{}) (interface{}, bool) {
+	switch t {
+	case "integer", "number":
+		switch v := value.(type) {
+		case string:
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || (t == "integer" && !IsType(t, n)) {
+				return nil, false
+			}
+			return n, true
+		case bool:
+			if v {
+				return float64(1), true
+			}
+			return float64(0), true
+		}
+
+	case "boolean":
+		switch v := value.(type) {
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			return b, err == nil
+		case float64:
+			return v != 0, v == 0 || v == 1
+		}
+
+	case "string":
+		switch v := value.(type) {
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		case bool:
+			return strconv.FormatBool(v), true
+		case nil:
+			return nil, false
+		default:
+			bytes, err := json.Marshal(v)
+			return string(bytes), err == nil
+		}
+
+	case "array":
+		if v, ok := value.(string); ok {
+			var array []interface{}
+			if err := json.Unmarshal([]byte(v), &array); err == nil {
+				return array, true
+			}
+		}
+		if value != nil {
+			return []interface{}{value}, true
+		}
+
+	case "object":
+		if v, ok := value.(string); ok {
+			var obj map[string]interface{}
+			if err := json.Unmarshal([]byte(v), &obj); err == nil {
+				return obj, true
+			}
+		}
+
+	case "null":
+		if v, ok := value.(string); ok && (v == "" || v == "null") {
+			return nil, true
+		}
+	}
+	return nil, false
+}
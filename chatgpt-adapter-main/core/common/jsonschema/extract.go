@@ -0,0 +1,141 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Extract 从模型输出中提取 JSON 并解析：去除 markdown 代码块、前后的说明文字，
+// 删除多余的逗号，为键名补上引号，补全被截断的字符串和括号
+func Extract(text string) (value interface{}, raw string, err error) {
+	text = strings.TrimSpace(text)
+	if idx := strings.Index(text, "```"); idx >= 0 {
+		block := text[idx+3:]
+		if end := strings.Index(block, "\n"); end >= 0 {
+			block = block[end+1:]
+		}
+		if end := strings.Index(block, "```"); end >= 0 {
+			block = block[:end]
+		}
+		text = strings.TrimSpace(block)
+	}
+
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		err = errors.New("no JSON object found in the output")
+		return
+	}
+
+	raw = repair(text[start:])
+	if err = json.Unmarshal([]byte(raw), &value); err != nil {
+		return
+	}
+	return
+}
+
+func repair(text string) string {
+	var (
+		builder strings.Builder
+		stack   []byte
+		str     = false
+		escape  = false
+	)
+
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		if str {
+			builder.WriteByte(ch)
+			if escape {
+				escape = false
+			} else if ch == '\\' {
+				escape = true
+			} else if ch == '"' {
+				str = false
+			}
+			continue
+		}
+
+		// 未加引号的键名
+		if isKeyStart(ch) && len(stack) > 0 && stack[len(stack)-1] == '{' && expectKey(builder.String()) {
+			end := i
+			for end < len(text) && isKeyChar(text[end]) {
+				end++
+			}
+			if rest := strings.TrimLeft(text[end:], " \t\r\n"); strings.HasPrefix(rest, ":") {
+				builder.WriteString(`"` + text[i:end] + `"`)
+				i = end - 1
+				continue
+			}
+		}
+
+		switch ch {
+		case '"':
+			str = true
+		case '{', '[':
+			stack = append(stack, ch)
+		case '}', ']':
+			trimComma(&builder)
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			builder.WriteByte(ch)
+			if len(stack) == 0 {
+				return builder.String()
+			}
+			continue
+		}
+		builder.WriteByte(ch)
+	}
+
+	// 输出被截断，补全结构
+	if str {
+		if escape {
+			result := builder.String()
+			builder.Reset()
+			builder.WriteString(result[:len(result)-1])
+		}
+		builder.WriteByte('"')
+	}
+
+	result := strings.TrimRight(builder.String(), " \t\r\n")
+	result = strings.TrimSuffix(result, ",")
+	if strings.HasSuffix(result, ":") {
+		result += "null"
+	}
+
+	builder.Reset()
+	builder.WriteString(result)
+	for i := len(stack) - 1; i >= 0; i-- {
+		trimComma(&builder)
+		if stack[i] == '{' {
+			builder.WriteByte('}')
+		} else {
+			builder.WriteByte(']')
+		}
+	}
+	return builder.String()
+}
+
+// 前一个有效字符为 { 或 , 时，当前位置应为键名
+func expectKey(prefix string) bool {
+	prefix = strings.TrimRight(prefix, " \t\r\n")
+	return strings.HasSuffix(prefix, "{") || strings.HasSuffix(prefix, ",")
+}
+
+func isKeyStart(ch byte) bool {
+	return ch == '_' || ch == '$' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isKeyChar(ch byte) bool {
+	return isKeyStart(ch) || ch == '-' || (ch >= '0' && ch <= '9')
+}
+
+// 删除结尾多余的逗号
+func trimComma(builder *strings.Builder) {
+	result := strings.TrimRight(builder.String(), " \t\r\n")
+	if strings.HasSuffix(result, ",") {
+		builder.Reset()
+		builder.WriteString(result[:len(result)-1])
+	}
+}
@@ -0,0 +1,165 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", `{"a": 1}`, `{"a":1}`},
+		{"markdown", "```json\n{\"a\": 1}\n```", `{"a":1}`},
+		{"surrounding text", `result: {"a": 1} done`, `{"a":1}`},
+		{"trailing commas", `{"a": [1, 2,], "b": {"c": 1,},}`, `{"a":[1,2],"b":{"c":1}}`},
+		{"unquoted keys", `{a: 1, b_2: {$c: "x"}}`, `{"a":1,"b_2":{"$c":"x"}}`},
+		{"truncated object", `{"a": {"b": [1, 2`, `{"a":{"b":[1,2]}}`},
+		{"truncated string", `{"a": "hel`, `{"a":"hel"}`},
+		{"truncated escape", `{"a": "x\`, `{"a":"x"}`},
+		{"truncated after colon", `{"a": 1, "b":`, `{"a":1,"b":null}`},
+		{"escaped quotes", `{"a": "say \"hi\", ok"}`, `{"a":"say \"hi\", ok"}`},
+		{"braces in string", `{"a": "} ] { [", b: 1,}`, `{"a":"} ] { [","b":1}`},
+		{"key-like words in string", `{"a": "x, y: z"}`, `{"a":"x, y: z"}`},
+		{"array", `[{"a": 1}, {"a": 2},]`, `[{"a":1},{"a":2}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, _, err := Extract(tt.text)
+			if err != nil {
+				t.Fatalf("Extract(%q) error: %v", tt.text, err)
+			}
+			got, _ := json.Marshal(value)
+			if string(got) != tt.want {
+				t.Errorf("Extract(%q) = %s, want %s", tt.text, got, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := Extract("no json here"); err == nil {
+		t.Error("Extract without JSON should fail")
+	}
+}
+
+func TestCoerce(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		want   string
+	}{
+		{"string to integer", `{"type": "integer"}`, `"42"`, `42`},
+		{"invalid integer", `{"type": "integer"}`, `"4.2"`, `"4.2"`},
+		{"string to number", `{"type": "number"}`, `" 4.5 "`, `4.5`},
+		{"string to boolean", `{"type": "boolean"}`, `"true"`, `true`},
+		{"number to string", `{"type": "string"}`, `1.5`, `"1.5"`},
+		{"value to array", `{"type": "array"}`, `"x"`, `["x"]`},
+		{"json string to array", `{"type": "array"}`, `"[1,2]"`, `[1,2]`},
+		{"json string to object", `{"type": "object"}`, `"{\"a\":1}"`, `{"a":1}`},
+		{"nested", `{"type": "object", "properties": {"n": {"type": "integer"}, "tags": {"type": "array", "items": {"type": "string"}}}}`,
+			`{"n": "3", "tags": [1, true], "other": "3"}`, `{"n":3,"other":"3","tags":["1","true"]}`},
+		{"already valid", `{"type": ["string", "null"]}`, `null`, `null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema, value interface{}
+			_ = json.Unmarshal([]byte(tt.schema), &schema)
+			_ = json.Unmarshal([]byte(tt.value), &value)
+			got, _ := json.Marshal(Coerce(schema, value))
+			if string(got) != tt.want {
+				t.Errorf("Coerce(%s, %s) = %s, want %s", tt.schema, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"properties": {
+			"city": {"type": "string", "minLength": 2, "pattern": "^[A-Z]"},
+			"days": {"type": "integer", "minimum": 1, "maximum": 7},
+			"unit": {"enum": ["c", "f"]},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2}
+		},
+		"required": ["city"],
+		"additionalProperties": false
+	}`
+
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"valid", `{"city": "Paris", "days": 3, "unit": "c", "tags": ["a"]}`, true},
+		{"missing required", `{"days": 3}`, false},
+		{"wrong type", `{"city": 1}`, false},
+		{"not an integer", `{"city": "Paris", "days": 1.5}`, false},
+		{"out of range", `{"city": "Paris", "days": 8}`, false},
+		{"enum", `{"city": "Paris", "unit": "k"}`, false},
+		{"pattern", `{"city": "paris"}`, false},
+		{"min length", `{"city": "P"}`, false},
+		{"item type", `{"city": "Paris", "tags": [1]}`, false},
+		{"max items", `{"city": "Paris", "tags": ["a", "b", "c"]}`, false},
+		{"additional property", `{"city": "Paris", "country": "FR"}`, false},
+		{"not an object", `"Paris"`, false},
+	}
+
+	var s interface{}
+	if err := json.Unmarshal([]byte(schema), &s); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			_ = json.Unmarshal([]byte(tt.value), &value)
+			if err := Validate(s, value); (err == nil) != tt.ok {
+				t.Errorf("Validate(%s) = %v, want ok %v", tt.value, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidateCombinators(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		ok     bool
+	}{
+		{"anyOf match", `{"anyOf": [{"type": "string"}, {"type": "integer"}]}`, `1`, true},
+		{"anyOf mismatch", `{"anyOf": [{"type": "string"}, {"type": "integer"}]}`, `true`, false},
+		{"oneOf twice", `{"oneOf": [{"type": "number"}, {"type": "integer"}]}`, `1`, false},
+		{"oneOf once", `{"oneOf": [{"type": "number"}, {"type": "integer"}]}`, `1.5`, true},
+		{"allOf", `{"allOf": [{"minimum": 1}, {"maximum": 2}]}`, `3`, false},
+		{"const", `{"const": {"a": [1]}}`, `{"a": [1]}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema, value interface{}
+			_ = json.Unmarshal([]byte(tt.schema), &schema)
+			_ = json.Unmarshal([]byte(tt.value), &value)
+			if err := Validate(schema, value); (err == nil) != tt.ok {
+				t.Errorf("Validate(%s, %s) = %v, want ok %v", tt.schema, tt.value, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRepairStopsAtFirstValue(t *testing.T) {
+	got := repair(`{"a": 1} {"b": 2}`)
+	if want := `{"a": 1}`; got != want {
+		t.Errorf("repair = %s, want %s", got, want)
+	}
+
+	var value map[string]interface{}
+	if err := json.Unmarshal([]byte(repair(`{"a": "}"`)), &value); err != nil || !reflect.DeepEqual(value, map[string]interface{}{"a": "}"}) {
+		t.Errorf("repair of a truncated string with a brace = %v, %v", value, err)
+	}
+}
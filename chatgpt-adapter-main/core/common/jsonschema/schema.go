@@ -0,0 +1,247 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Validate 使用 JSON Schema 的常用子集校验 value，value 为 json.Unmarshal 的结果
+//
+//	支持 type、enum、const、properties、required、additionalProperties、items、
+//	anyOf、oneOf、allOf、minimum、maximum、minLength、maxLength、minItems、maxItems、pattern
+func Validate(schema, value interface{}) error {
+	return validate(schema, value, "$")
+}
+
+func validate(schema, value interface{}, path string) error {
+	obj, ok := schema.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if types := schemaTypes(obj["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if IsType(t, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(types, " or "), TypeOf(value))
+		}
+	}
+
+	if enum, ok := obj["enum"].([]interface{}); ok {
+		matched := false
+		for _, v := range enum {
+			if equal(v, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: value is not one of the enum values", path)
+		}
+	}
+
+	if v, ok := obj["const"]; ok && !equal(v, value) {
+		return fmt.Errorf("%s: value does not match const", path)
+	}
+
+	for _, sub := range slice(obj["allOf"]) {
+		if err := validate(sub, value, path); err != nil {
+			return err
+		}
+	}
+
+	if anyOf := slice(obj["anyOf"]); len(anyOf) > 0 {
+		var err error
+		for _, sub := range anyOf {
+			if err = validate(sub, value, path); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: value does not match any schema of anyOf", path)
+		}
+	}
+
+	if oneOf := slice(obj["oneOf"]); len(oneOf) > 0 {
+		count := 0
+		for _, sub := range oneOf {
+			if validate(sub, value, path) == nil {
+				count++
+			}
+		}
+		if count != 1 {
+			return fmt.Errorf("%s: value must match exactly one schema of oneOf", path)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return validateObject(obj, v, path)
+	case []interface{}:
+		if n, ok := number(obj["minItems"]); ok && float64(len(v)) < n {
+			return fmt.Errorf("%s: expected at least %v items", path, n)
+		}
+		if n, ok := number(obj["maxItems"]); ok && float64(len(v)) > n {
+			return fmt.Errorf("%s: expected at most %v items", path, n)
+		}
+		if items, ok := obj["items"]; ok {
+			for i, item := range v {
+				if err := validate(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if n, ok := number(obj["minLength"]); ok && length < n {
+			return fmt.Errorf("%s: expected at least %v characters", path, n)
+		}
+		if n, ok := number(obj["maxLength"]); ok && length > n {
+			return fmt.Errorf("%s: expected at most %v characters", path, n)
+		}
+		if pattern, ok := obj["pattern"].(string); ok {
+			if compile, err := regexp.Compile(pattern); err == nil && !compile.MatchString(v) {
+				return fmt.Errorf("%s: value does not match pattern '%s'", path, pattern)
+			}
+		}
+	case float64:
+		if n, ok := number(obj["minimum"]); ok && v < n {
+			return fmt.Errorf("%s: expected >= %v", path, n)
+		}
+		if n, ok := number(obj["maximum"]); ok && v > n {
+			return fmt.Errorf("%s: expected <= %v", path, n)
+		}
+	}
+	return nil
+}
+
+func validateObject(schema map[string]interface{}, value map[string]interface{}, path string) error {
+	for _, key := range slice(schema["required"]) {
+		if name, ok := key.(string); ok {
+			if _, exists := value[name]; !exists {
+				return fmt.Errorf("%s: missing required property '%s'", path, name)
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if sub, ok := properties[key]; ok {
+			if err := validate(sub, value[key], path+"."+key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%s: additional property '%s' is not allowed", path, key)
+			}
+		case map[string]interface{}:
+			if err := validate(additional, value[key], path+"."+key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// IsType 判断 value 是否为 JSON Schema 的类型 t
+func IsType(t string, value interface{}) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		v, ok := value.(float64)
+		return ok && v == math.Trunc(v)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+// TypeOf 返回 value 对应的 JSON Schema 类型
+func TypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func schemaTypes(value interface{}) (types []string) {
+	switch t := value.(type) {
+	case string:
+		types = append(types, t)
+	case []interface{}:
+		for _, v := range t {
+			if str, ok := v.(string); ok {
+				types = append(types, str)
+			}
+		}
+	}
+	return
+}
+
+func slice(value interface{}) []interface{} {
+	values, _ := value.([]interface{})
+	return values
+}
+
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func equal(a, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
@@ -0,0 +1,162 @@
+package jwtkey
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Claims 网关签发的 JWT 密钥中携带的声明，无需数据库即可完成校验
+type Claims struct {
+	Tenant   string   `json:"tenant,omitempty"`
+	Models   []string `json:"models,omitempty"`   // 允许的模型，匹配完整模型名的正则表达式
+	Adapters []string `json:"adapters,omitempty"` // 允许的适配器
+	RPM      int      `json:"rpm,omitempty"`      // 每分钟请求数
+	TPD      int      `json:"tpd,omitempty"`      // 每天 token 数
+
+	jwt.RegisteredClaims
+}
+
+// Signer 签发与校验 JWT 密钥，支持 HS256 与 EdDSA
+type Signer struct {
+	method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+	issuer string
+}
+
+// New 创建 Signer，EdDSA 的密钥可以是 PEM 内容或文件路径，只有公钥时仅能校验
+func New(alg, secret, privateKey, publicKey, issuer string) (*Signer, error) {
+	s := &Signer{issuer: issuer}
+	switch strings.ToUpper(alg) {
+	case "", "HS256":
+		if secret == "" {
+			return nil, errors.New("the HS256 secret is empty")
+		}
+		s.method = jwt.SigningMethodHS256
+		s.sign, s.verify = []byte(secret), []byte(secret)
+
+	case "EDDSA", "ED25519":
+		s.method = jwt.SigningMethodEdDSA
+		if privateKey != "" {
+			key, err := jwt.ParseEdPrivateKeyFromPEM(readPEM(privateKey))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the EdDSA private key: %v", err)
+			}
+			s.sign = key
+			s.verify = key.(ed25519.PrivateKey).Public()
+		}
+		if publicKey != "" {
+			key, err := jwt.ParseEdPublicKeyFromPEM(readPEM(publicKey))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the EdDSA public key: %v", err)
+			}
+			s.verify = key
+		}
+		if s.verify == nil {
+			return nil, errors.New("the EdDSA key is empty")
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported algorithm: %s", alg)
+	}
+	return s, nil
+}
+
+// 非 PEM 内容时作为文件路径读取
+func readPEM(value string) []byte {
+	if strings.Contains(value, "-----BEGIN") {
+		return []byte(value)
+	}
+	bytes, err := os.ReadFile(value)
+	if err != nil {
+		return []byte(value)
+	}
+	return bytes
+}
+
+// Mint 签发密钥，无状态的密钥无法吊销，必须设置过期时间。未指定 jti 时随机生成，限额按 jti 计算
+func (s *Signer) Mint(claims Claims, ttl time.Duration) (string, error) {
+	if s.sign == nil {
+		return "", errors.New("the signing key is not configured")
+	}
+	if ttl <= 0 {
+		return "", errors.New("the ttl must be positive")
+	}
+
+	now := time.Now()
+	if claims.Issuer == "" {
+		claims.Issuer = s.issuer
+	}
+	if claims.ID == "" {
+		claims.ID = uuid.NewString()
+	}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	return jwt.NewWithClaims(s.method, claims).SignedString(s.sign)
+}
+
+// Parse 校验签名、过期时间以及签发者，没有过期时间的密钥视为无效
+func (s *Signer) Parse(token string) (*Claims, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{s.method.Alg()}),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	}
+	if s.issuer != "" {
+		options = append(options, jwt.WithIssuer(s.issuer))
+	}
+
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return s.verify, nil
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// Inspect 不校验签名，解析出密钥中的声明
+func Inspect(token string) (*Claims, map[string]interface{}, error) {
+	var claims Claims
+	t, _, err := jwt.NewParser().ParseUnverified(token, &claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &claims, t.Header, nil
+}
+
+// IsToken 判断是否为 JWT 格式
+func IsToken(token string) bool {
+	return strings.HasPrefix(token, "eyJ") && strings.Count(token, ".") == 2
+}
+
+// GenerateKey 生成 EdDSA 密钥对，返回 PEM 格式
+func GenerateKey() (private, public string, err error) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return
+	}
+
+	privBytes, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return
+	}
+	pubBytes, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return
+	}
+
+	private = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes}))
+	public = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes}))
+	return
+}
@@ -0,0 +1,186 @@
+package jwtkey
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestSigner(t *testing.T) {
+	private, public, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 公钥也可以是文件路径
+	file := filepath.Join(t.TempDir(), "public.pem")
+	if err = os.WriteFile(file, []byte(public), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		signer func() (*Signer, error)
+		verify func() (*Signer, error)
+	}{
+		{
+			"HS256",
+			func() (*Signer, error) { return New("HS256", "secret", "", "", "gateway") },
+			func() (*Signer, error) { return New("", "secret", "", "", "gateway") },
+		},
+		{
+			"EdDSA",
+			func() (*Signer, error) { return New("EdDSA", "", private, "", "gateway") },
+			func() (*Signer, error) { return New("ed25519", "", "", file, "gateway") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := tt.signer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			verify, err := tt.verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims := Claims{Tenant: "acme", Models: []string{"gpt-4.*"}, RPM: 10, TPD: 1000}
+			claims.Subject = "alice"
+			token, err := signer.Mint(claims, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsToken(token) {
+				t.Errorf("IsToken(%q) = false", token)
+			}
+
+			parsed, err := verify.Parse(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Tenant != "acme" || parsed.Subject != "alice" || parsed.Issuer != "gateway" || parsed.ID == "" ||
+				!reflect.DeepEqual(parsed.Models, claims.Models) || parsed.RPM != 10 || parsed.TPD != 1000 {
+				t.Errorf("claims = %+v", parsed)
+			}
+			if d := time.Until(parsed.ExpiresAt.Time); d <= 59*time.Minute || d > time.Hour {
+				t.Errorf("expires in %v", d)
+			}
+
+			if _, err = verify.Mint(claims, time.Hour); tt.name == "EdDSA" && err == nil {
+				t.Error("a signer with only the public key should not mint")
+			}
+		})
+	}
+}
+
+func TestMint(t *testing.T) {
+	signer, _ := New("HS256", "secret", "", "", "")
+	if _, err := signer.Mint(Claims{}, 0); err == nil {
+		t.Error("a token without ttl should be rejected")
+	}
+
+	// 未指定 jti 时每次都不同
+	a, _ := signer.Mint(Claims{}, time.Hour)
+	b, _ := signer.Mint(Claims{}, time.Hour)
+	ca, _ := signer.Parse(a)
+	cb, _ := signer.Parse(b)
+	if ca.ID == "" || ca.ID == cb.ID {
+		t.Errorf("jti = %q, %q", ca.ID, cb.ID)
+	}
+
+	claims := Claims{}
+	claims.ID = "key-1"
+	token, _ := signer.Mint(claims, time.Hour)
+	if parsed, _ := signer.Parse(token); parsed.ID != "key-1" {
+		t.Errorf("jti = %q, want key-1", parsed.ID)
+	}
+}
+
+func TestParse(t *testing.T) {
+	signer, _ := New("HS256", "secret", "", "", "gateway")
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.Claims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	registered := func(issuer string, expires time.Time) jwt.RegisteredClaims {
+		c := jwt.RegisteredClaims{Issuer: issuer, IssuedAt: jwt.NewNumericDate(time.Now())}
+		if !expires.IsZero() {
+			c.ExpiresAt = jwt.NewNumericDate(expires)
+		}
+		return c
+	}
+	hour := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"valid", sign(jwt.SigningMethodHS256, []byte("secret"), &Claims{RegisteredClaims: registered("gateway", hour)}), ""},
+		{"wrong secret", sign(jwt.SigningMethodHS256, []byte("other"), &Claims{RegisteredClaims: registered("gateway", hour)}), "signature"},
+		{"without expiry", sign(jwt.SigningMethodHS256, []byte("secret"), &Claims{RegisteredClaims: registered("gateway", time.Time{})}), "exp claim is required"},
+		{"expired", sign(jwt.SigningMethodHS256, []byte("secret"), &Claims{RegisteredClaims: registered("gateway", time.Now().Add(-time.Minute))}), "expired"},
+		{"other issuer", sign(jwt.SigningMethodHS256, []byte("secret"), &Claims{RegisteredClaims: registered("someone", hour)}), "issuer"},
+		{"other algorithm", sign(jwt.SigningMethodHS512, []byte("secret"), &Claims{RegisteredClaims: registered("gateway", hour)}), "signing method"},
+		{"none", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, &Claims{RegisteredClaims: registered("gateway", hour)}), "signing method"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := signer.Parse(tt.token)
+			if tt.err == "" && err != nil {
+				t.Fatalf("Parse = %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Parse = %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name                   string
+		alg, secret, priv, pub string
+	}{
+		{"empty secret", "HS256", "", "", ""},
+		{"empty EdDSA key", "EdDSA", "", "", ""},
+		{"invalid EdDSA key", "EdDSA", "", "not a key", ""},
+		{"unsupported algorithm", "RS256", "secret", "", ""},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.alg, tt.secret, tt.priv, tt.pub, ""); err == nil {
+			t.Errorf("%s: New should fail", tt.name)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	signer, _ := New("HS256", "secret", "", "", "gateway")
+	claims := Claims{Tenant: "acme"}
+	token, _ := signer.Mint(claims, time.Hour)
+
+	// 不校验签名
+	parts := strings.Split(token, ".")
+	parsed, header, err := Inspect(parts[0] + "." + parts[1] + ".invalid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Tenant != "acme" || header["alg"] != "HS256" {
+		t.Errorf("claims = %+v, header = %v", parsed, header)
+	}
+
+	if IsToken("sk-team") || IsToken("eyJabc") {
+		t.Error("IsToken should reject plain keys")
+	}
+}
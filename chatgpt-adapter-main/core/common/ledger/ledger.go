@@ -0,0 +1,305 @@
+package ledger
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/logger"
+	"github.com/iocgo/sdk/env"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Row 每次请求的用量记录，按天追加写入 <path>/<date>.jsonl
+type Row struct {
+	Time             time.Time `json:"time"`
+	Key              string    `json:"key,omitempty"` // 密钥哈希
+	Label            string    `json:"label,omitempty"`
+	Tenant           string    `json:"tenant,omitempty"`
+	Model            string    `json:"model"`
+	Adapter          string    `json:"adapter,omitempty"`
+	Account          string    `json:"account,omitempty"` // 上游账号哈希
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Latency          int64     `json:"latency"` // 毫秒
+	Status           int       `json:"status"`
+	Cost             float64   `json:"cost"`
+}
+
+// Price 每百万 token 的价格
+type Price struct {
+	Model      string  `mapstructure:"model"` // 正则表达式
+	Prompt     float64 `mapstructure:"prompt"`
+	Completion float64 `mapstructure:"completion"`
+
+	regexp *regexp.Regexp
+}
+
+var (
+	enabled bool
+	path    string
+	prices  []Price
+
+	// 写入队列，退出时关闭，closed 与发送都在 closeMu 下进行
+	rows    = make(chan Row, 1024)
+	closed  bool
+	closeMu sync.RWMutex
+	wg      sync.WaitGroup
+
+	dropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "chatgpt_adapter_usage_dropped_total",
+		Help: "Usage ledger rows dropped because the write queue was full or the server was exiting.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(dropped)
+	inited.AddInitialized(func(env *env.Environment) {
+		enabled = env.GetBool("usage.enabled")
+		if !enabled {
+			return
+		}
+
+		path = Path(env)
+		if err := os.MkdirAll(path, 0755); err != nil {
+			logger.Fatalf("failed to create usage.path: %v", err)
+		}
+
+		if err := env.UnmarshalKey("usage.prices", &prices); err != nil {
+			logger.Fatal(err)
+		}
+		for i := range prices {
+			compile, err := regexp.Compile(prices[i].Model)
+			if err != nil {
+				logger.Fatalf("failed to compile usage.prices[%d]: %v", i, err)
+			}
+			prices[i].regexp = compile
+		}
+
+		wg.Add(1)
+		go write()
+	})
+
+	// 退出前写入剩余的记录
+	inited.AddExited(func(*env.Environment) {
+		if enabled {
+			stop()
+		}
+	})
+}
+
+// 关闭队列并等待写入完成，之后的记录直接丢弃
+func stop() {
+	closeMu.Lock()
+	if !closed {
+		closed = true
+		close(rows)
+	}
+	closeMu.Unlock()
+	wg.Wait()
+}
+
+// Path 用量记录的目录
+func Path(env *env.Environment) string {
+	if p := env.GetString("usage.path"); p != "" {
+		return p
+	}
+	return "usage"
+}
+
+func Enabled() bool { return enabled }
+
+// Record 计算费用并异步写入，不阻塞请求：队列已满或正在退出时丢弃并计入
+// chatgpt_adapter_usage_dropped_total
+func Record(row Row) {
+	if !enabled {
+		return
+	}
+
+	row.Cost = cost(row.Model, row.PromptTokens, row.CompletionTokens)
+	closeMu.RLock()
+	defer closeMu.RUnlock()
+	if closed {
+		dropped.Inc()
+		logger.Warnf("usage ledger is closed, dropped: %s %s %d+%d tokens", row.Key, row.Model, row.PromptTokens, row.CompletionTokens)
+		return
+	}
+
+	select {
+	case rows <- row:
+	default:
+		dropped.Inc()
+		logger.Errorf("usage ledger queue is full, dropped: %s %s %d+%d tokens", row.Key, row.Model, row.PromptTokens, row.CompletionTokens)
+	}
+}
+
+func cost(mod string, promptTokens, completionTokens int) float64 {
+	for _, price := range prices {
+		if price.regexp.MatchString(mod) {
+			return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1e6
+		}
+	}
+	return 0
+}
+
+func write() {
+	defer wg.Done()
+
+	var (
+		file *os.File
+		day  string
+	)
+	defer func() {
+		if file != nil {
+			_ = file.Close()
+		}
+	}()
+
+	for row := range rows {
+		if d := row.Time.Format(time.DateOnly); d != day || file == nil {
+			if file != nil {
+				_ = file.Close()
+			}
+
+			var err error
+			file, err = os.OpenFile(filepath.Join(path, d+".jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				logger.Errorf("failed to open the usage ledger: %v", err)
+				file = nil
+				continue
+			}
+			day = d
+		}
+
+		data, _ := json.Marshal(row)
+		if _, err := file.Write(append(data, '\n')); err != nil {
+			logger.Errorf("failed to write the usage ledger: %v", err)
+		}
+	}
+}
+
+// Read 读取 [from, to] 日期内的记录，filter 返回 false 的记录被忽略
+func Read(dir string, from, to time.Time, filter func(Row) bool, apply func(Row)) error {
+	for day := dayOf(from); !day.After(dayOf(to)); day = day.AddDate(0, 0, 1) {
+		file, err := os.Open(filepath.Join(dir, day.Format(time.DateOnly)+".jsonl"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var row Row
+			// 跳过正在写入的不完整行
+			if json.Unmarshal(scanner.Bytes(), &row) != nil {
+				continue
+			}
+			if filter == nil || filter(row) {
+				apply(row)
+			}
+		}
+
+		err = scanner.Err()
+		_ = file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// Aggregate 按 day、key、tenant、model、adapter 分组的汇总
+type Aggregate struct {
+	Day              string  `json:"day,omitempty"`
+	Key              string  `json:"key,omitempty"`
+	Label            string  `json:"label,omitempty"`
+	Tenant           string  `json:"tenant,omitempty"`
+	Model            string  `json:"model,omitempty"`
+	Adapter          string  `json:"adapter,omitempty"`
+	Requests         int     `json:"requests"`
+	Failures         int     `json:"failures"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Latency          int64   `json:"latency"` // 平均毫秒
+	Cost             float64 `json:"cost"`
+}
+
+// Summarize 汇总 [from, to] 日期内的记录
+func Summarize(dir string, from, to time.Time, groupBy []string, filter func(Row) bool) ([]Aggregate, error) {
+	groups := make(map[string]*Aggregate)
+	err := Read(dir, from, to, filter, func(row Row) {
+		var (
+			agg  Aggregate
+			keys []string
+		)
+		for _, group := range groupBy {
+			switch group {
+			case "day":
+				agg.Day = row.Time.Format(time.DateOnly)
+				keys = append(keys, agg.Day)
+			case "key":
+				agg.Key, agg.Label = row.Key, row.Label
+				keys = append(keys, agg.Key)
+			case "tenant":
+				agg.Tenant = row.Tenant
+				keys = append(keys, agg.Tenant)
+			case "model":
+				agg.Model = row.Model
+				keys = append(keys, agg.Model)
+			case "adapter":
+				agg.Adapter = row.Adapter
+				keys = append(keys, agg.Adapter)
+			}
+		}
+
+		id := strings.Join(keys, "\x00")
+		item, ok := groups[id]
+		if !ok {
+			item = &agg
+			groups[id] = item
+		}
+
+		item.Requests++
+		if row.Status >= 400 {
+			item.Failures++
+		}
+		item.PromptTokens += row.PromptTokens
+		item.CompletionTokens += row.CompletionTokens
+		item.Latency += row.Latency
+		item.Cost += row.Cost
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Aggregate, 0, len(groups))
+	for _, item := range groups {
+		item.Latency /= int64(item.Requests)
+		result = append(result, *item)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		for _, field := range [][2]string{{a.Day, b.Day}, {a.Tenant, b.Tenant}, {a.Key, b.Key}, {a.Model, b.Model}, {a.Adapter, b.Adapter}} {
+			if field[0] != field[1] {
+				return field[0] < field[1]
+			}
+		}
+		return false
+	})
+	return result, nil
+}
@@ -0,0 +1,130 @@
+package ledger
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// 使用临时目录启动写入，测试结束时关闭队列
+func start(t *testing.T, size int) (dir string) {
+	t.Helper()
+	dir = t.TempDir()
+	enabled, path, prices = true, dir, nil
+	rows, closed = make(chan Row, size), false
+	wg.Add(1)
+	go write()
+	t.Cleanup(func() {
+		stop()
+		enabled = false
+	})
+	return
+}
+
+func TestRecordAndSummarize(t *testing.T) {
+	dir := start(t, 16)
+	prices = []Price{{Model: "^claude", Prompt: 3, Completion: 15, regexp: regexp.MustCompile("^claude")}}
+
+	day := time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local)
+	for _, row := range []Row{
+		{Time: day, Key: "k1", Model: "claude-3", PromptTokens: 1000, CompletionTokens: 100, Latency: 100, Status: 200},
+		{Time: day, Key: "k1", Model: "claude-3", PromptTokens: 1000, CompletionTokens: 100, Latency: 300, Status: 500},
+		{Time: day, Key: "k2", Model: "gpt-4o", PromptTokens: 10, Latency: 50, Status: 200},
+		{Time: day.AddDate(0, 0, 1), Key: "k1", Model: "claude-3", PromptTokens: 1, Status: 200},
+	} {
+		Record(row)
+	}
+	stop()
+
+	if _, err := os.Stat(filepath.Join(dir, "2026-10-02.jsonl")); err != nil {
+		t.Fatalf("rows are not written by day: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		from    time.Time
+		groupBy []string
+		filter  func(Row) bool
+		want    []Aggregate
+	}{
+		{
+			"by model", day, []string{"model"}, nil,
+			[]Aggregate{
+				{Model: "claude-3", Requests: 3, Failures: 1, PromptTokens: 2001, CompletionTokens: 200, Latency: 133, Cost: 0.009003},
+				{Model: "gpt-4o", Requests: 1, PromptTokens: 10, Latency: 50},
+			},
+		},
+		{
+			"by day and key", day, []string{"day", "key"}, func(row Row) bool { return row.Key == "k1" },
+			[]Aggregate{
+				{Day: "2026-10-01", Key: "k1", Requests: 2, Failures: 1, PromptTokens: 2000, CompletionTokens: 200, Latency: 200, Cost: 0.009},
+				{Day: "2026-10-02", Key: "k1", Requests: 1, PromptTokens: 1, Cost: 0.000003},
+			},
+		},
+		{"outside the range", day.AddDate(0, 0, 2), []string{"model"}, nil, []Aggregate{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Summarize(dir, tt.from, day.AddDate(0, 0, 3), tt.groupBy, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Summarize = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				g, w := got[i], tt.want[i]
+				g.Cost, w.Cost = 0, 0
+				if g != w || math.Abs(got[i].Cost-tt.want[i].Cost) > 1e-9 {
+					t.Errorf("Summarize[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRecordDoesNotBlock(t *testing.T) {
+	// 没有写入端，队列满后应立即丢弃
+	enabled, prices = true, nil
+	rows, closed = make(chan Row, 1), false
+	t.Cleanup(func() { enabled = false })
+
+	before := testutil.ToFloat64(dropped)
+	begin := time.Now()
+	for i := 0; i < 3; i++ {
+		Record(Row{Time: time.Now(), Model: "m"})
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("Record blocked for %v", elapsed)
+	}
+	if got := testutil.ToFloat64(dropped) - before; got != 2 {
+		t.Errorf("dropped = %v, want 2", got)
+	}
+}
+
+func TestRecordAfterStop(t *testing.T) {
+	start(t, 4)
+	stop()
+
+	before := testutil.ToFloat64(dropped)
+	var group sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			Record(Row{Time: time.Now(), Model: "m"})
+		}()
+	}
+	group.Wait()
+
+	if got := testutil.ToFloat64(dropped) - before; got != 10 {
+		t.Errorf("dropped = %v, want 10", got)
+	}
+}
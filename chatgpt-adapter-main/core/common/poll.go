@@ -6,8 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"slices"
+	"sort"
+	"sync"
 	"time"
 
+	"chatgpt-adapter/core/common/quota"
+	"chatgpt-adapter/core/common/ratelimit"
+	"chatgpt-adapter/core/common/store"
 	"chatgpt-adapter/core/logger"
 	"github.com/iocgo/sdk/lock"
 )
@@ -19,6 +25,10 @@ const (
 type state struct {
 	t time.Time
 	s byte
+
+	reason   Reason
+	failures int       // 连续失败次数，成功使用后清零
+	until    time.Time // 冷却结束时间，为空时使用 resetTime
 }
 
 type PollContainer[T interface{}] struct {
@@ -26,38 +36,141 @@ type PollContainer[T interface{}] struct {
 	pos       int
 	slice     []T
 	markers   map[interface{}]*state
+	drains    map[interface{}]bool // 排空中，使用结束后移除
+	lastUsed  map[interface{}]time.Time
+	inFlight  map[interface{}]int
+	resetTime time.Duration
 	mu        *lock.ExpireLock // mark
 	cmu       *lock.ExpireLock // delete
 	Condition func(T, ...interface{}) bool
+
+	// 管理接口添加成员时使用，为空时将 JSON 解析为 T 后直接添加
+	Append func(raw json.RawMessage) error
+
+	added   []json.RawMessage // 管理接口添加的成员
+	removed []string          // 管理接口移除的成员 Id
+	pending map[string]*state // 已恢复但成员尚未添加的状态
+	dirty   chan struct{}
+}
+
+// 持久化的账号池状态，成员以 Id 标识
+type pollState struct {
+	Added   []json.RawMessage      `json:"added,omitempty"`
+	Removed []string               `json:"removed,omitempty"`
+	Markers map[string]markerState `json:"markers,omitempty"`
+}
+
+type markerState struct {
+	S        byte      `json:"s"`
+	T        time.Time `json:"t"`
+	Reason   Reason    `json:"reason,omitempty"`
+	Failures int       `json:"failures,omitempty"`
+	Until    time.Time `json:"until,omitempty"`
+}
+
+func (marker *state) persisted() markerState {
+	return markerState{marker.s, marker.t, marker.reason, marker.failures, marker.until}
+}
+
+// Pool 类型无关的账号池，用于管理接口
+type Pool interface {
+	Name() string
+	Strategy() string
+	Members() []Member
+	AddMember(raw json.RawMessage) error
+	RemoveMember(id string) error
+	ResetMember(id string) error
+	DrainMember(id string) error
+}
+
+// Member 账号池成员的状态快照
+type Member struct {
+	Id       string `json:"id"`
+	State    string `json:"state"`
+	Reason   Reason `json:"reason,omitempty"`
+	Failures int    `json:"failures,omitempty"`
+	Since    int64  `json:"since,omitempty"`    // 状态变更时间
+	Cooldown int64  `json:"cooldown,omitempty"` // 剩余冷却秒数
+	InFlight int    `json:"in_flight,omitempty"`
+	LastUsed int64  `json:"last_used,omitempty"`
+
+	Quota *quota.Status `json:"quota,omitempty"`
+}
+
+var (
+	poolsMu sync.Mutex
+	pools   = make(map[string]Pool)
+)
+
+// Pools 已创建的全部账号池
+func Pools() []Pool {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+
+	result := make([]Pool, 0, len(pools))
+	for _, pool := range pools {
+		result = append(result, pool)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result
+}
+
+func PoolOf(name string) (pool Pool, ok bool) {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+	pool, ok = pools[name]
+	return
 }
 
 // resetTime 用于复位状态：0 就绪状态，1 使用状态，2 异常状态
 func NewPollContainer[T interface{}](name string, slice []T, resetTime time.Duration) *PollContainer[T] {
 	container := PollContainer[T]{
-		name:    name,
-		slice:   slice,
-		markers: make(map[interface{}]*state),
+		name:      name,
+		slice:     slice,
+		markers:   make(map[interface{}]*state),
+		drains:    make(map[interface{}]bool),
+		lastUsed:  make(map[interface{}]time.Time),
+		inFlight:  make(map[interface{}]int),
+		resetTime: resetTime,
 
 		mu:  lock.NewExpireLock(true),
 		cmu: lock.NewExpireLock(true),
 	}
 
-	if resetTime > 0 {
-		go timer(&container, resetTime)
+	if store.Enabled() {
+		container.restore()
+		container.dirty = make(chan struct{}, 1)
+		go container.persist()
 	}
+
+	go timer(&container, resetTime)
+
+	poolsMu.Lock()
+	pools[name] = &container
+	poolsMu.Unlock()
 	return &container
 }
 
-// 定时复位状态 0 就绪状态，1 使用状态，2 异常状态
+// 标记使用的键，非字符串序列化为 JSON
+func markerKey(value interface{}) interface{} {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// 定时复位状态 0 就绪状态，1 使用状态，2 异常状态，3 隔离状态不会自动复位
 func timer[T interface{}](container *PollContainer[T], resetTime time.Duration) {
 	s10 := 10 * time.Second
 	s20 := 20 * time.Second
 	for {
-		if len(container.slice) == 0 {
+		if container.Len() == 0 {
 			time.Sleep(s10)
 			continue
 		}
 
+		values := container.values()
 		timeout, cancel := context.WithTimeout(context.Background(), s20)
 		if !container.mu.Lock(timeout) {
 			cancel()
@@ -67,27 +180,25 @@ func timer[T interface{}](container *PollContainer[T], resetTime time.Duration)
 		}
 		cancel()
 
-		for _, value := range container.slice {
-			var obj interface{} = value
-			if s, ok := obj.(string); ok {
-				obj = s
-			} else {
-				data, _ := json.Marshal(obj)
-				obj = string(data)
-			}
-
+		for _, value := range values {
+			obj := markerKey(value)
 			marker, ok := container.markers[obj]
 			if !ok {
 				continue
 			}
 
-			if marker.s == 0 || marker.s == 1 { // 0 就绪状态, 1 使用中
+			if marker.s != 2 { // 0 就绪状态, 1 使用中, 3 隔离
 				continue
 			}
 
 			// 2 异常冷却中
-			if time.Now().Add(-resetTime).After(marker.t) {
+			if marker.until.IsZero() && resetTime <= 0 {
+				continue
+			}
+			if (!marker.until.IsZero() && time.Now().After(marker.until)) ||
+				(marker.until.IsZero() && time.Now().Add(-resetTime).After(marker.t)) {
 				marker.s = 0
+				container.changed()
 				logger.Infof("[%s] PollContainer 冷却完毕: %v", container.name, obj)
 			}
 		}
@@ -97,8 +208,13 @@ func timer[T interface{}](container *PollContainer[T], resetTime time.Duration)
 }
 
 func (container *PollContainer[T]) Poll(argv ...interface{}) (T, error) {
+	return container.PollBy("", argv...)
+}
+
+// PollBy 按账号池配置的策略选择成员，key 为 sticky 策略下终端用户的标识
+func (container *PollContainer[T]) PollBy(key string, argv ...interface{}) (T, error) {
 	var zero T
-	if container == nil || len(container.slice) == 0 {
+	if container == nil || container.Len() == 0 {
 		return zero, errors.New("no elements in slice")
 	}
 
@@ -121,19 +237,34 @@ func (container *PollContainer[T]) Poll(argv ...interface{}) (T, error) {
 		pos = 0
 	}
 
-	for index := 0; index < sliceL; index++ {
-		curr := pos + index
-		if curr >= sliceL {
-			curr = curr - sliceL
-		}
+	candidates, ok := container.candidates()
+	if !ok {
+		return zero, errors.New("lock timeout")
+	}
 
+	for _, c := range order(strategyOf(container.name), candidates, pos, key) {
+		curr := c.index
 		value := container.slice[curr]
+		if c.draining {
+			continue
+		}
+
+		scope := ratelimit.Account(c.id)
+		if ratelimit.Exhausted(scope) || !quota.Allow(c.id) {
+			continue
+		}
+
 		if container.Condition(value, argv...) {
+			if _, ok := ratelimit.Acquire(scope); !ok {
+				continue
+			}
+
 			container.pos = curr + 1
 			err := container.MarkTo(value, 1)
 			if err != nil {
 				return zero, err
 			}
+			container.acquired(value)
 			return value, nil
 		}
 	}
@@ -141,6 +272,55 @@ func (container *PollContainer[T]) Poll(argv ...interface{}) (T, error) {
 	return zero, fmt.Errorf("not roll result")
 }
 
+// 成员的使用情况，调用方需持有 cmu
+func (container *PollContainer[T]) candidates() ([]candidate, bool) {
+	timeout, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	if !container.mu.Lock(timeout) {
+		return nil, false
+	}
+	defer container.mu.Unlock()
+
+	candidates := make([]candidate, len(container.slice))
+	for i, value := range container.slice {
+		key := markerKey(value)
+		id := container.Id(value)
+		candidates[i] = candidate{
+			index:     i,
+			id:        id,
+			lastUsed:  container.lastUsed[key],
+			inFlight:  container.inFlight[key],
+			remaining: quota.Remaining(id),
+			draining:  container.drains[key],
+		}
+	}
+	return candidates, true
+}
+
+// 记录成员被分配
+func (container *PollContainer[T]) acquired(value T) {
+	timeout, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	if !container.mu.Lock(timeout) {
+		return
+	}
+	key := markerKey(value)
+	container.lastUsed[key] = time.Now()
+	container.inFlight[key]++
+	container.mu.Unlock()
+}
+
+// 成员使用结束，调用方需持有 mu
+func (container *PollContainer[T]) released(key interface{}) {
+	if container.inFlight[key] > 1 {
+		container.inFlight[key]--
+	} else {
+		delete(container.inFlight, key)
+	}
+}
+
 func (container *PollContainer[T]) Remove(value T) (err error) {
 	if container.Len() == 0 {
 		return
@@ -164,45 +344,73 @@ func (container *PollContainer[T]) Remove(value T) (err error) {
 }
 
 func (container *PollContainer[T]) Add(value T) {
+	timeout, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	if !container.cmu.Lock(timeout) {
+		logger.Errorf("[%s] PollContainer 添加失败: lock timeout", container.name)
+		return
+	}
 	container.slice = append(container.slice, value)
+	container.cmu.Unlock()
+
+	// 恢复持久化的状态
+	if len(container.pending) > 0 && container.mu.Lock(timeout) {
+		id := container.Id(value)
+		if marker, ok := container.pending[id]; ok {
+			container.markers[markerKey(value)] = marker
+			delete(container.pending, id)
+		}
+		container.mu.Unlock()
+	}
 }
 
 // 标记： 0 就绪状态，1 使用状态，2 异常状态
 func (container *PollContainer[T]) MarkTo(key interface{}, value byte) error {
-	if s, ok := key.(string); ok {
-		key = s
-	} else {
-		data, _ := json.Marshal(key)
-		key = string(data)
-	}
+	key = markerKey(key)
 
 	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if container.mu.Lock(timeout) {
-		defer container.mu.Unlock()
-		container.markers[key] = &state{
-			t: time.Now(),
-			s: value,
-		}
-		if value == 1 {
-			logger.Infof("[%s] 索引 [%d] 设置状态值：%d", container.name, container.pos, value)
-		} else {
-			logger.Infof("[%s] 设置状态值：%d", container.name, value)
-		}
-	} else {
+	if !container.mu.Lock(timeout) {
 		return context.DeadlineExceeded
 	}
+
+	marker := &state{
+		t: time.Now(),
+		s: value,
+	}
+	// 复位为就绪状态时清零失败次数
+	if previous, ok := container.markers[key]; ok && value != 0 {
+		marker.failures = previous.failures
+	}
+	if value != 1 {
+		container.released(key)
+	}
+	// 共享的成员仍有请求在使用时保持使用状态
+	if value == 0 && container.inFlight[key] > 0 {
+		marker.s = 1
+	}
+	container.markers[key] = marker
+	if value == 1 {
+		logger.Infof("[%s] 索引 [%d] 设置状态值：%d", container.name, container.pos, value)
+	} else {
+		logger.Infof("[%s] 设置状态值：%d", container.name, value)
+	}
+
+	drained := marker.s != 1 && container.drains[key]
+	container.mu.Unlock()
+	container.changed()
+
+	// 排空中的成员使用结束，移除
+	if drained {
+		return container.removeKey(key)
+	}
 	return nil
 }
 
 func (container *PollContainer[T]) Marked(key interface{}) (byte, error) {
-	if s, ok := key.(string); ok {
-		key = s
-	} else {
-		data, _ := json.Marshal(key)
-		key = string(data)
-	}
+	key = markerKey(key)
 
 	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -219,6 +427,432 @@ func (container *PollContainer[T]) Marked(key interface{}) (byte, error) {
 	}
 }
 
+// Available 成员是否可以分配：就绪状态，或 least-in-flight 策略下使用中且未超过 max-in-flight
+func (container *PollContainer[T]) Available(key interface{}) (bool, error) {
+	key = markerKey(key)
+
+	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if !container.mu.Lock(timeout) {
+		return false, context.DeadlineExceeded
+	}
+	defer container.mu.Unlock()
+
+	marker, ok := container.markers[key]
+	switch {
+	case !ok || marker.s == 0:
+		return true, nil
+	case marker.s == 1:
+		return strategyOf(container.name).shared(container.inFlight[key]), nil
+	default:
+		return false, nil
+	}
+}
+
+// MarkFailed 按原因标记异常：按策略退避冷却，或永久隔离。ReasonNone 时不做处理
+func (container *PollContainer[T]) MarkFailed(key interface{}, reason Reason) error {
+	if reason == ReasonNone {
+		return nil
+	}
+	key = markerKey(key)
+
+	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if !container.mu.Lock(timeout) {
+		return context.DeadlineExceeded
+	}
+
+	marker := &state{t: time.Now(), s: 2, reason: reason, failures: 1}
+	if previous, ok := container.markers[key]; ok {
+		marker.failures = previous.failures + 1
+	}
+
+	b := backoffOf(container.name, reason)
+	if b.Quarantine {
+		marker.s = 3
+		logger.Warnf("[%s] 账号已隔离：%s", container.name, reason)
+	} else {
+		d := b.delay(marker.failures, container.resetTime)
+		marker.until = marker.t.Add(d)
+		logger.Infof("[%s] 账号冷却 %s：%s，连续失败 %d 次", container.name, d.Round(time.Second), reason, marker.failures)
+	}
+
+	container.markers[key] = marker
+	container.released(key)
+	drained := container.drains[key]
+	container.mu.Unlock()
+	container.changed()
+
+	if drained {
+		return container.removeKey(key)
+	}
+	return nil
+}
+
+// Id 账号的标识，使用哈希避免在日志和接口中暴露凭证
+func (container *PollContainer[T]) Id(value T) string {
+	return container.name + ":" + CalcHex(markerKey(value).(string))[:12]
+}
+
 func (container *PollContainer[T]) Len() int {
+	if container == nil {
+		return 0
+	}
+
+	// 管理接口会在运行时增删成员
+	timeout, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	if !container.cmu.Lock(timeout) {
+		return 0
+	}
+	defer container.cmu.Unlock()
 	return len(container.slice)
 }
+
+func (container *PollContainer[T]) Name() string {
+	return container.name
+}
+
+func (container *PollContainer[T]) Strategy() string {
+	if s := strategyOf(container.name).Strategy; s != "" {
+		return s
+	}
+	return StrategyRoundRobin
+}
+
+// 复制当前的成员，可在不持有锁的情况下遍历
+func (container *PollContainer[T]) values() []T {
+	timeout, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	if !container.cmu.Lock(timeout) {
+		return nil
+	}
+	defer container.cmu.Unlock()
+	return append([]T(nil), container.slice...)
+}
+
+// Each 遍历成员的副本，apply 返回 false 时停止
+func (container *PollContainer[T]) Each(apply func(value T) bool) {
+	for _, value := range container.values() {
+		if !apply(value) {
+			return
+		}
+	}
+}
+
+// Members 成员状态快照：ready 就绪，in-use 使用中，error 异常冷却中，draining 排空中，以及额度用量
+func (container *PollContainer[T]) Members() []Member {
+	values := container.values()
+	result := make([]Member, 0, len(values))
+
+	timeout, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	if !container.mu.Lock(timeout) {
+		return result
+	}
+	defer container.mu.Unlock()
+
+	for _, value := range values {
+		key := markerKey(value)
+		member := Member{Id: container.Id(value), State: "ready", InFlight: container.inFlight[key]}
+		if t, ok := container.lastUsed[key]; ok {
+			member.LastUsed = t.Unix()
+		}
+		if marker, ok := container.markers[key]; ok {
+			member.Since = marker.t.Unix()
+			member.Reason, member.Failures = marker.reason, marker.failures
+			switch marker.s {
+			case 1:
+				member.State = "in-use"
+			case 2:
+				member.State = "error"
+				until := marker.until
+				if until.IsZero() && container.resetTime > 0 {
+					until = marker.t.Add(container.resetTime)
+				}
+				if !until.IsZero() {
+					member.Cooldown = int64(max(0, time.Until(until).Seconds()))
+				}
+			case 3:
+				member.State = "quarantined"
+			}
+		}
+		if container.drains[key] {
+			member.State = "draining"
+		}
+		if st, ok := quota.Lookup(member.Id); ok {
+			member.Quota = &st
+		}
+		result = append(result, member)
+	}
+	return result
+}
+
+// 按 Id 查找成员
+func (container *PollContainer[T]) lookup(id string) (value T, ok bool) {
+	container.Each(func(v T) bool {
+		if container.Id(v) == id {
+			value, ok = v, true
+			return false
+		}
+		return true
+	})
+	return
+}
+
+func (container *PollContainer[T]) AddMember(raw json.RawMessage) (err error) {
+	var value T
+	if err = json.Unmarshal(raw, &value); err != nil {
+		return
+	}
+
+	id := container.Id(value)
+	if _, ok := container.lookup(id); ok {
+		return errors.New("the member already exists")
+	}
+
+	if container.Append != nil {
+		err = container.Append(raw)
+	} else {
+		container.Add(value)
+	}
+	if err != nil {
+		return
+	}
+
+	container.track(func() {
+		container.removed = slices.DeleteFunc(container.removed, func(item string) bool { return item == id })
+		container.added = append(container.added, raw)
+	})
+	return
+}
+
+func (container *PollContainer[T]) RemoveMember(id string) error {
+	value, ok := container.lookup(id)
+	if !ok {
+		return fmt.Errorf("member not found: %s", id)
+	}
+	return container.removeKey(markerKey(value))
+}
+
+// ResetMember 强制复位为就绪状态，并取消排空。使用中的成员保持使用状态，
+// 使用结束后由分配方复位，不影响 in-flight 计数
+func (container *PollContainer[T]) ResetMember(id string) error {
+	value, ok := container.lookup(id)
+	if !ok {
+		return fmt.Errorf("member not found: %s", id)
+	}
+
+	timeout, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	if !container.mu.Lock(timeout) {
+		return context.DeadlineExceeded
+	}
+	key := markerKey(value)
+	marker := &state{t: time.Now()}
+	if previous, exists := container.markers[key]; exists && previous.s == 1 {
+		marker.s = 1
+	}
+	container.markers[key] = marker
+	delete(container.drains, key)
+	container.mu.Unlock()
+
+	container.changed()
+	logger.Infof("[%s] 成员已复位: %s", container.name, id)
+	return nil
+}
+
+// DrainMember 不再分配该成员，正在使用时等待结束后移除
+func (container *PollContainer[T]) DrainMember(id string) error {
+	value, ok := container.lookup(id)
+	if !ok {
+		return fmt.Errorf("member not found: %s", id)
+	}
+
+	key := markerKey(value)
+	timeout, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	if !container.mu.Lock(timeout) {
+		return context.DeadlineExceeded
+	}
+
+	marker, exists := container.markers[key]
+	inUse := exists && marker.s == 1
+	if inUse {
+		container.drains[key] = true
+	}
+	container.mu.Unlock()
+
+	if inUse {
+		container.changed()
+		logger.Infof("[%s] 成员排空中: %s", container.name, id)
+		return nil
+	}
+	return container.removeKey(key)
+}
+
+// 移除成员以及其状态
+func (container *PollContainer[T]) removeKey(key interface{}) error {
+	timeout, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	if !container.cmu.Lock(timeout) {
+		return errors.New("lock timeout")
+	}
+	for idx := 0; idx < len(container.slice); idx++ {
+		if markerKey(container.slice[idx]) == key {
+			container.slice = append(container.slice[:idx], container.slice[idx+1:]...)
+			break
+		}
+	}
+	container.cmu.Unlock()
+
+	if !container.mu.Lock(timeout) {
+		return context.DeadlineExceeded
+	}
+	delete(container.markers, key)
+	delete(container.drains, key)
+	delete(container.lastUsed, key)
+	delete(container.inFlight, key)
+	container.mu.Unlock()
+
+	id := container.name + ":" + CalcHex(key.(string))[:12]
+	container.track(func() {
+		container.added = slices.DeleteFunc(container.added, func(raw json.RawMessage) bool {
+			var value T
+			return json.Unmarshal(raw, &value) == nil && container.Id(value) == id
+		})
+		container.removed = append(container.removed, id)
+	})
+
+	logger.Infof("[%s] 移除成员: %v", container.name, CalcHex(key.(string))[:12])
+	return nil
+}
+
+// Removed 成员是否已被管理接口移除，用于过滤异步添加的成员
+func (container *PollContainer[T]) Removed(value T) bool {
+	timeout, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	if !container.mu.Lock(timeout) {
+		return false
+	}
+	defer container.mu.Unlock()
+	return slices.Contains(container.removed, container.Id(value))
+}
+
+// 记录管理接口对成员的修改
+func (container *PollContainer[T]) track(apply func()) {
+	timeout, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	if !container.mu.Lock(timeout) {
+		logger.Errorf("[%s] PollContainer 获取锁失败", container.name)
+		return
+	}
+	apply()
+	container.mu.Unlock()
+	container.changed()
+}
+
+// 状态有变化，等待写入存储
+func (container *PollContainer[T]) changed() {
+	if container.dirty == nil {
+		return
+	}
+
+	select {
+	case container.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// 合并一秒内的修改后写入
+func (container *PollContainer[T]) persist() {
+	for range container.dirty {
+		time.Sleep(time.Second)
+		container.save()
+	}
+}
+
+func (container *PollContainer[T]) save() {
+	values := container.values()
+
+	timeout, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	if !container.mu.Lock(timeout) {
+		logger.Errorf("[%s] PollContainer 获取锁失败", container.name)
+		return
+	}
+
+	st := pollState{
+		Added:   slices.Clone(container.added),
+		Removed: slices.Clone(container.removed),
+		Markers: make(map[string]markerState),
+	}
+	for id, marker := range container.pending {
+		st.Markers[id] = marker.persisted()
+	}
+	for _, value := range values {
+		key := markerKey(value)
+		if container.drains[key] {
+			st.Removed = append(st.Removed, container.Id(value))
+			continue
+		}
+		if marker, ok := container.markers[key]; ok && marker.s != 0 {
+			st.Markers[container.Id(value)] = marker.persisted()
+		}
+	}
+	container.mu.Unlock()
+
+	store.Save("pool-"+container.name, st)
+}
+
+// 恢复持久化的成员与状态：使用中的成员复位为就绪，排空中的成员视为已移除
+func (container *PollContainer[T]) restore() {
+	var st pollState
+	if !store.Load("pool-"+container.name, &st) {
+		return
+	}
+
+	container.added, container.removed = st.Added, st.Removed
+	container.slice = slices.DeleteFunc(container.slice, func(value T) bool {
+		return slices.Contains(st.Removed, container.Id(value))
+	})
+
+	for _, raw := range st.Added {
+		var value T
+		if err := json.Unmarshal(raw, &value); err != nil {
+			logger.Errorf("[%s] PollContainer 恢复成员失败: %v", container.name, err)
+			continue
+		}
+		if !slices.ContainsFunc(container.slice, func(item T) bool { return container.Id(item) == container.Id(value) }) {
+			container.slice = append(container.slice, value)
+		}
+	}
+
+	container.pending = make(map[string]*state)
+	for id, marker := range st.Markers {
+		if marker.S == 1 {
+			continue
+		}
+		container.pending[id] = &state{t: marker.T, s: marker.S, reason: marker.Reason, failures: marker.Failures, until: marker.Until}
+	}
+
+	for _, value := range container.slice {
+		id := container.Id(value)
+		if marker, ok := container.pending[id]; ok {
+			container.markers[markerKey(value)] = marker
+			delete(container.pending, id)
+		}
+	}
+	logger.Infof("[%s] PollContainer 已恢复状态，共 %d 个成员", container.name, len(container.slice))
+}
@@ -0,0 +1,253 @@
+package common
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"chatgpt-adapter/core/common/inited"
+	"github.com/iocgo/sdk/env"
+	"github.com/spf13/viper"
+)
+
+// 账号池的状态写入临时目录
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "pool")
+	if err != nil {
+		panic(err)
+	}
+
+	v := viper.New()
+	v.Set("store.type", "file")
+	v.Set("store.path", dir)
+	env.Env = &env.Environment{Viper: v}
+	inited.Initialized(env.Env)
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// 成员 Id 到状态的映射
+func memberStates[T interface{}](container *PollContainer[T]) map[string]Member {
+	result := make(map[string]Member)
+	for _, member := range container.Members() {
+		result[member.Id] = member
+	}
+	return result
+}
+
+func TestPollMembers(t *testing.T) {
+	container := newTestContainer(t, strategyConfig{}, "a", "b", "c", "d")
+	if pool, ok := PoolOf(container.Name()); !ok || pool.Strategy() != StrategyRoundRobin {
+		t.Fatalf("PoolOf(%s) = %v, %v", container.Name(), pool, ok)
+	}
+
+	if value, err := container.Poll(); err != nil || value != "a" {
+		t.Fatalf("poll = %s, %v", value, err)
+	}
+	_ = container.MarkTo("b", 2)
+	if value, _ := container.Poll(); value != "c" {
+		t.Fatalf("poll = %s, want c", value)
+	}
+	if err := container.DrainMember(container.Id("c")); err != nil {
+		t.Fatal(err)
+	}
+
+	states := memberStates(container)
+	if len(states) != 4 {
+		t.Fatalf("members = %v", states)
+	}
+	if m := states[container.Id("a")]; m.State != "in-use" || m.InFlight != 1 || m.LastUsed == 0 {
+		t.Errorf("a = %+v", m)
+	}
+	if m := states[container.Id("b")]; m.State != "error" || m.Cooldown <= 3500 || m.Cooldown > 3600 {
+		t.Errorf("b = %+v", m)
+	}
+	if m := states[container.Id("c")]; m.State != "draining" {
+		t.Errorf("c = %+v", m)
+	}
+	if m := states[container.Id("d")]; m.State != "ready" || m.Since != 0 {
+		t.Errorf("d = %+v", m)
+	}
+
+	// Id 不暴露凭证
+	for id := range states {
+		if id == container.Name()+":a" || len(id) != len(container.Name())+13 {
+			t.Errorf("id = %s", id)
+		}
+	}
+}
+
+func TestPollAddRemoveMember(t *testing.T) {
+	container := newTestContainer(t, strategyConfig{}, "a")
+
+	if err := container.AddMember(json.RawMessage(`"b"`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := container.AddMember(json.RawMessage(`"b"`)); err == nil {
+		t.Error("adding an existing member should fail")
+	}
+	if err := container.AddMember(json.RawMessage(`{"cookie": "c"}`)); err == nil {
+		t.Error("adding a member of another type should fail")
+	}
+
+	_ = container.MarkTo("a", 2)
+	if value, err := container.Poll(); err != nil || value != "b" {
+		t.Fatalf("poll = %s, %v; want the added member", value, err)
+	}
+
+	id := container.Id("b")
+	if err := container.RemoveMember(id); err != nil {
+		t.Fatal(err)
+	}
+	if container.Len() != 1 || !container.Removed("b") || container.Removed("a") {
+		t.Errorf("len = %d, removed b = %v", container.Len(), container.Removed("b"))
+	}
+	if err := container.RemoveMember(id); err == nil {
+		t.Error("removing an unknown member should fail")
+	}
+
+	// 重新添加后不再视为已移除
+	var appended []string
+	container.Append = func(raw json.RawMessage) error {
+		var value string
+		_ = json.Unmarshal(raw, &value)
+		appended = append(appended, value)
+		container.Add(value)
+		return nil
+	}
+	if err := container.AddMember(json.RawMessage(`"b"`)); err != nil || len(appended) != 1 || container.Removed("b") {
+		t.Errorf("add again = %v, appended = %v, removed = %v", err, appended, container.Removed("b"))
+	}
+}
+
+func TestPollResetMember(t *testing.T) {
+	container := newTestContainer(t, strategyConfig{}, "a", "b")
+
+	_ = container.MarkTo("b", 2)
+	if err := container.ResetMember(container.Id("b")); err != nil {
+		t.Fatal(err)
+	}
+	if marker, _ := container.Marked("b"); marker != 0 {
+		t.Errorf("marker after reset = %d, want 0", marker)
+	}
+
+	// 使用中的成员保持使用状态，由分配方结束使用
+	if value, _ := container.Poll(); value != "a" {
+		t.Fatalf("poll = %s, want a", value)
+	}
+	_ = container.ResetMember(container.Id("a"))
+	if m := memberStates(container)[container.Id("a")]; m.State != "in-use" || m.InFlight != 1 {
+		t.Errorf("a after reset = %+v", m)
+	}
+	_ = container.MarkTo("a", 0)
+	if m := memberStates(container)[container.Id("a")]; m.State != "ready" || m.InFlight != 0 {
+		t.Errorf("a after release = %+v", m)
+	}
+
+	if err := container.ResetMember("unknown"); err == nil {
+		t.Error("resetting an unknown member should fail")
+	}
+}
+
+func TestPollDrainMember(t *testing.T) {
+	container := newTestContainer(t, strategyConfig{}, "a", "b", "c")
+
+	// 空闲的成员直接移除
+	if err := container.DrainMember(container.Id("c")); err != nil || container.Len() != 2 {
+		t.Fatalf("drain idle member = %v, len = %d", err, container.Len())
+	}
+
+	// 使用中的成员不再分配，使用结束后移除
+	if value, _ := container.Poll(); value != "a" {
+		t.Fatalf("poll = %s, want a", value)
+	}
+	_ = container.DrainMember(container.Id("a"))
+	_ = container.MarkTo("b", 0)
+	if value, _ := container.Poll(); value != "b" {
+		t.Errorf("poll = %s, want b", value)
+	}
+	if container.Len() != 2 {
+		t.Fatalf("len = %d, want 2 while a is in use", container.Len())
+	}
+	if err := container.MarkTo("a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if container.Len() != 1 || !container.Removed("a") {
+		t.Errorf("len = %d after the drained member was released", container.Len())
+	}
+
+	// 复位取消排空
+	_ = container.DrainMember(container.Id("b"))
+	_ = container.ResetMember(container.Id("b"))
+	_ = container.MarkTo("b", 0)
+	if container.Len() != 1 {
+		t.Errorf("len = %d, reset should cancel draining", container.Len())
+	}
+}
+
+func TestPollRestore(t *testing.T) {
+	config := []string{"a", "b", "c", "d"}
+	container := newTestContainer(t, strategyConfig{}, config...)
+
+	_ = container.MarkTo("a", 2)
+	if value, _ := container.Poll(); value != "b" {
+		t.Fatalf("poll = %s, want b", value)
+	}
+	_ = container.DrainMember(container.Id("b"))
+	_ = container.RemoveMember(container.Id("c"))
+	_ = container.AddMember(json.RawMessage(`"e"`))
+
+	// 异步添加的成员，如登录后得到的账号
+	container.Add("f")
+	_ = container.MarkTo("f", 2)
+	container.save()
+
+	restored := NewPollContainer[string](container.Name(), append([]string(nil), config...), time.Hour)
+	if values := restored.values(); len(values) != 3 || values[0] != "a" || values[1] != "d" || values[2] != "e" {
+		t.Fatalf("restored members = %v, want [a d e]", values)
+	}
+	if !restored.Removed("b") || !restored.Removed("c") {
+		t.Error("the removed and drained members should stay removed")
+	}
+
+	states := memberStates(restored)
+	if m := states[restored.Id("a")]; m.State != "error" || m.Cooldown <= 3500 {
+		t.Errorf("a = %+v", m)
+	}
+	if m := states[restored.Id("d")]; m.State != "ready" {
+		t.Errorf("d = %+v", m)
+	}
+
+	// 成员添加后恢复其状态
+	restored.Add("f")
+	if marker, _ := restored.Marked("f"); marker != 2 {
+		t.Errorf("marker of the member added after restoring = %d, want 2", marker)
+	}
+}
+
+func TestPollPersist(t *testing.T) {
+	container := newTestContainer(t, strategyConfig{}, "a")
+	_ = container.MarkTo("a", 2)
+
+	// 修改合并一秒后写入
+	file := filepath.Join(env.Env.GetString("store.path"), "pool-"+container.Name()+".json")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := os.ReadFile(file)
+		if err == nil {
+			var st pollState
+			if err = json.Unmarshal(data, &st); err != nil || st.Markers[container.Id("a")].S != 2 {
+				t.Errorf("saved state = %s, %v", data, err)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the pool state was not saved after a change")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
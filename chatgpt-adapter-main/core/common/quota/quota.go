@@ -0,0 +1,414 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/common/store"
+	"chatgpt-adapter/core/logger"
+	"github.com/bincooo/emit.io"
+	"github.com/iocgo/sdk/env"
+)
+
+// 额度的重置方式
+const (
+	ResetDay     = "day"     // 按时区的自然日
+	ResetMonth   = "month"   // 按时区的自然月
+	ResetRolling = "rolling" // 滑动窗口
+)
+
+// Quota 上游账号在一个周期内的额度，0 为不限制
+type Quota struct {
+	Requests      int    `mapstructure:"requests" json:"requests,omitempty"`
+	Tokens        int    `mapstructure:"tokens" json:"tokens,omitempty"`
+	Reset         string `mapstructure:"reset" json:"reset,omitempty"`
+	Window        string `mapstructure:"window" json:"window,omitempty"` // rolling 的窗口，默认 24h
+	Timezone      string `mapstructure:"timezone" json:"timezone,omitempty"`
+	Reserve       int    `mapstructure:"reserve" json:"reserve,omitempty"`               // 剩余请求数不大于该值时跳过
+	ReserveTokens int    `mapstructure:"reserve-tokens" json:"reserve_tokens,omitempty"` // 剩余 token 数不大于该值时跳过
+
+	window   time.Duration
+	location *time.Location
+}
+
+// 成员的配置覆盖账号池的配置
+func (q Quota) merge(o Quota) Quota {
+	if o.Requests != 0 {
+		q.Requests = o.Requests
+	}
+	if o.Tokens != 0 {
+		q.Tokens = o.Tokens
+	}
+	if o.Reset != "" {
+		q.Reset, q.Window = o.Reset, o.Window
+	}
+	if o.Timezone != "" {
+		q.Timezone = o.Timezone
+	}
+	if o.Reserve != 0 {
+		q.Reserve = o.Reserve
+	}
+	if o.ReserveTokens != 0 {
+		q.ReserveTokens = o.ReserveTokens
+	}
+	return q
+}
+
+func (q *Quota) compile() (err error) {
+	switch q.Reset {
+	case "":
+		q.Reset = ResetDay
+	case ResetDay, ResetMonth:
+	case ResetRolling:
+		q.window = 24 * time.Hour
+		if q.Window != "" {
+			if q.window, err = time.ParseDuration(q.Window); err != nil {
+				return
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported reset: %s", q.Reset)
+	}
+
+	q.location = time.Local
+	if q.Timezone != "" {
+		q.location, err = time.LoadLocation(q.Timezone)
+	}
+	return
+}
+
+// 自然日或自然月的开始时间
+func (q Quota) periodOf(now time.Time) time.Time {
+	t := now.In(q.location)
+	if q.Reset == ResetMonth {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, q.location)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, q.location)
+}
+
+func (q Quota) nextOf(period time.Time) time.Time {
+	if q.Reset == ResetMonth {
+		return period.AddDate(0, 1, 0)
+	}
+	return period.AddDate(0, 0, 1)
+}
+
+// Status 账号在当前周期的用量
+type Status struct {
+	Id            string `json:"id"`
+	Requests      int    `json:"requests"`
+	RequestsLimit int    `json:"requests_limit,omitempty"`
+	Tokens        int    `json:"tokens"`
+	TokensLimit   int    `json:"tokens_limit,omitempty"`
+	Remaining     *int   `json:"remaining_requests,omitempty"`
+	Upstream      *int   `json:"upstream_remaining,omitempty"` // 上游报告的剩余请求数
+	Reported      int64  `json:"upstream_reported,omitempty"`
+	ResetAt       int64  `json:"reset_at,omitempty"`
+	Exhausted     bool   `json:"exhausted"`
+}
+
+type event struct {
+	T      time.Time `json:"t"`
+	Tokens int       `json:"tokens"`
+}
+
+// 账号的用量，自然周期累计计数，滑动窗口记录每次请求
+type usage struct {
+	Period   time.Time `json:"period,omitempty"`
+	Requests int       `json:"requests,omitempty"`
+	Tokens   int       `json:"tokens,omitempty"`
+	Events   []event   `json:"events,omitempty"`
+
+	Upstream *int      `json:"upstream,omitempty"`
+	Reported time.Time `json:"reported,omitempty"`
+}
+
+var (
+	mu       sync.Mutex
+	pools    = make(map[string]Quota)
+	members  = make(map[string]Quota)
+	reserve  Quota
+	accounts = make(map[string]*usage)
+	dirty    = make(chan struct{}, 1)
+)
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		if err := env.UnmarshalKey("quota.pools", &pools); err != nil {
+			logger.Fatal(err)
+		}
+		if err := env.UnmarshalKey("quota.members", &members); err != nil {
+			logger.Fatal(err)
+		}
+		reserve = Quota{Reserve: env.GetInt("quota.reserve"), ReserveTokens: env.GetInt("quota.reserve-tokens")}
+		if reserve.Reserve < 0 || reserve.ReserveTokens < 0 {
+			logger.Fatal("quota.reserve must not be negative")
+		}
+
+		for name, q := range pools {
+			if err := q.compile(); err != nil {
+				logger.Fatalf("invalid quota.pools.%s: %v", name, err)
+			}
+			pools[name] = q
+		}
+		for id, q := range members {
+			pool, _, _ := strings.Cut(id, ":")
+			q = pools[pool].merge(q)
+			if err := q.compile(); err != nil {
+				logger.Fatalf("invalid quota.members.%s: %v", id, err)
+			}
+			members[id] = q
+		}
+
+		if store.Enabled() {
+			store.Load("quota", &accounts)
+			go persist()
+		}
+	})
+}
+
+// 未配置额度的账号只跟踪上游报告，按自然日重置
+var untracked = Quota{Reset: ResetDay, location: time.Local}
+
+// Of 账号的额度配置，id 为 <账号池或适配器>:<哈希>，成员配置优先
+func Of(id string) (q Quota, ok bool) {
+	if q, ok = members[strings.ToLower(id)]; ok {
+		return
+	}
+	pool, _, _ := strings.Cut(id, ":")
+	q, ok = pools[pool]
+	return
+}
+
+func quotaOf(id string) (Quota, bool) {
+	if q, ok := Of(id); ok {
+		return q, true
+	}
+	return untracked, false
+}
+
+// 调用方需持有 mu，返回清理过期用量后的记录
+func usageOf(id string, q Quota, now time.Time) *usage {
+	u, ok := accounts[id]
+	if !ok {
+		u = &usage{}
+		accounts[id] = u
+	}
+
+	if q.Reset == ResetRolling {
+		since := now.Add(-q.window)
+		i := sort.Search(len(u.Events), func(i int) bool { return u.Events[i].T.After(since) })
+		if i > 0 {
+			u.Events = u.Events[i:]
+		}
+		if u.Upstream != nil && u.Reported.Before(since) {
+			u.Upstream = nil
+		}
+		return u
+	}
+
+	if period := q.periodOf(now); !u.Period.Equal(period) {
+		*u = usage{Period: period}
+	}
+	return u
+}
+
+func (u *usage) used(q Quota) (requests, tokens int) {
+	if q.Reset == ResetRolling {
+		for _, e := range u.Events {
+			requests++
+			tokens += e.Tokens
+		}
+		return
+	}
+	return u.Requests, u.Tokens
+}
+
+func status(id string, q Quota, configured bool, u *usage) (st Status) {
+	st.Id = id
+	if u.Upstream != nil {
+		upstream := *u.Upstream
+		st.Upstream, st.Reported = &upstream, u.Reported.Unix()
+	}
+	st.Requests, st.Tokens = u.used(q)
+	switch {
+	case q.Reset != ResetRolling:
+		st.ResetAt = q.nextOf(u.Period).Unix()
+	case len(u.Events) > 0:
+		st.ResetAt = u.Events[0].T.Add(q.window).Unix()
+	}
+
+	if q.Reserve == 0 {
+		q.Reserve = reserve.Reserve
+	}
+	if q.ReserveTokens == 0 {
+		q.ReserveTokens = reserve.ReserveTokens
+	}
+
+	if configured && q.Requests > 0 {
+		remaining := q.Requests - st.Requests
+		st.RequestsLimit, st.Remaining = q.Requests, &remaining
+		st.Exhausted = remaining <= q.Reserve
+	}
+	if configured && q.Tokens > 0 {
+		st.TokensLimit = q.Tokens
+		st.Exhausted = st.Exhausted || q.Tokens-st.Tokens <= q.ReserveTokens
+	}
+	if u.Upstream != nil {
+		if st.Remaining == nil || *st.Upstream < *st.Remaining {
+			st.Remaining = st.Upstream
+		}
+		st.Exhausted = st.Exhausted || *st.Upstream <= q.Reserve
+	}
+	return
+}
+
+// 读取状态，未配置额度且没有上游报告时 ok 为 false
+func lookup(id string) (st Status, ok bool) {
+	q, configured := quotaOf(id)
+	mu.Lock()
+	defer mu.Unlock()
+	if _, exists := accounts[id]; !exists && !configured {
+		return
+	}
+	return status(id, q, configured, usageOf(id, q, time.Now())), true
+}
+
+// Allow 账号的额度是否充足，接近耗尽时返回 false
+func Allow(id string) bool {
+	st, ok := lookup(id)
+	return !ok || !st.Exhausted
+}
+
+// Check 额度不足时返回 429 错误，用于不经过账号池的凭证
+func Check(id string) error {
+	st, ok := lookup(id)
+	if !ok || !st.Exhausted {
+		return nil
+	}
+
+	msg := fmt.Sprintf("the quota of account %s is exhausted", id)
+	if st.ResetAt > 0 {
+		msg += ", reset at " + time.Unix(st.ResetAt, 0).Format(time.RFC3339)
+	}
+	return emit.Error{Code: http.StatusTooManyRequests, Bus: "Quota", Err: errors.New(msg)}
+}
+
+// Lookup 账号在当前周期的用量，未跟踪时 ok 为 false
+func Lookup(id string) (Status, bool) {
+	return lookup(id)
+}
+
+// Remaining 剩余额度的比例，取请求数与 token 数中较小的一个，未配置额度时为 1
+func Remaining(id string) float64 {
+	st, ok := lookup(id)
+	if !ok {
+		return 1
+	}
+
+	ratio := 1.0
+	if st.RequestsLimit > 0 && st.Remaining != nil {
+		ratio = min(ratio, float64(*st.Remaining)/float64(st.RequestsLimit))
+	}
+	if st.TokensLimit > 0 {
+		ratio = min(ratio, float64(st.TokensLimit-st.Tokens)/float64(st.TokensLimit))
+	}
+	return max(ratio, 0)
+}
+
+// Consume 请求结束后扣除一次请求和使用的 token
+func Consume(id string, tokens int) {
+	if id == "" {
+		return
+	}
+
+	q, configured := quotaOf(id)
+	mu.Lock()
+	defer mu.Unlock()
+	u, exists := accounts[id]
+	if !exists && !configured {
+		return
+	}
+
+	now := time.Now()
+	u = usageOf(id, q, now)
+	if q.Reset == ResetRolling {
+		u.Events = append(u.Events, event{now, tokens})
+	} else {
+		u.Requests++
+		u.Tokens += tokens
+	}
+	if u.Upstream != nil {
+		remaining := *u.Upstream - 1
+		u.Upstream = &remaining
+	}
+	changed()
+}
+
+// Report 上游报告的剩余请求数，之后的请求在此基础上扣除
+func Report(id string, remaining int) {
+	q, _ := quotaOf(id)
+
+	mu.Lock()
+	defer mu.Unlock()
+	u := usageOf(id, q, time.Now())
+	u.Upstream, u.Reported = &remaining, time.Now()
+	changed()
+	logger.Infof("[quota] %s upstream remaining: %d", id, remaining)
+}
+
+// Stale 上游报告是否超过 d，用于控制查询上游用量的频率
+func Stale(id string, d time.Duration) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	u, ok := accounts[id]
+	return !ok || u.Upstream == nil || time.Since(u.Reported) > d
+}
+
+// Snapshot 已跟踪的账号，prefix 为空时返回全部
+func Snapshot(prefix string) []Status {
+	mu.Lock()
+	ids := make([]string, 0, len(accounts))
+	for id := range accounts {
+		if strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	mu.Unlock()
+
+	sort.Strings(ids)
+	result := make([]Status, 0, len(ids))
+	for _, id := range ids {
+		if st, ok := lookup(id); ok {
+			result = append(result, st)
+		}
+	}
+	return result
+}
+
+func changed() {
+	select {
+	case dirty <- struct{}{}:
+	default:
+	}
+}
+
+// 合并一秒内的修改后写入
+func persist() {
+	for range dirty {
+		time.Sleep(time.Second)
+		mu.Lock()
+		data := make(map[string]usage, len(accounts))
+		for id, u := range accounts {
+			data[id] = *u
+		}
+		mu.Unlock()
+		store.Save("quota", data)
+	}
+}
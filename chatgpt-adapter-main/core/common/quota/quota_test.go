@@ -0,0 +1,208 @@
+package quota
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustCompile(t *testing.T, q Quota) Quota {
+	t.Helper()
+	if err := q.compile(); err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name   string
+		quota  Quota
+		window time.Duration
+		ok     bool
+	}{
+		{"default", Quota{}, 0, true},
+		{"month", Quota{Reset: ResetMonth, Timezone: "Asia/Shanghai"}, 0, true},
+		{"rolling default window", Quota{Reset: ResetRolling}, 24 * time.Hour, true},
+		{"rolling window", Quota{Reset: ResetRolling, Window: "5h"}, 5 * time.Hour, true},
+		{"invalid window", Quota{Reset: ResetRolling, Window: "5 hours"}, 0, false},
+		{"invalid reset", Quota{Reset: "week"}, 0, false},
+		{"invalid timezone", Quota{Timezone: "Mars/Base"}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.quota
+			err := q.compile()
+			if (err == nil) != tt.ok {
+				t.Fatalf("compile = %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && q.window != tt.window {
+				t.Errorf("window = %v, want %v", q.window, tt.window)
+			}
+		})
+	}
+}
+
+func TestPeriod(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	newYork, _ := time.LoadLocation("America/New_York")
+
+	tests := []struct {
+		name   string
+		quota  Quota
+		now    time.Time
+		period time.Time
+		next   time.Time
+	}{
+		{
+			"day in timezone",
+			Quota{Reset: ResetDay, Timezone: "Asia/Shanghai"},
+			time.Date(2024, 3, 1, 17, 30, 0, 0, time.UTC), // 上海 3 月 2 日 01:30
+			time.Date(2024, 3, 2, 0, 0, 0, 0, shanghai),
+			time.Date(2024, 3, 3, 0, 0, 0, 0, shanghai),
+		},
+		{
+			"month end",
+			Quota{Reset: ResetMonth, Timezone: "Asia/Shanghai"},
+			time.Date(2024, 1, 31, 23, 0, 0, 0, shanghai),
+			time.Date(2024, 1, 1, 0, 0, 0, 0, shanghai),
+			time.Date(2024, 2, 1, 0, 0, 0, 0, shanghai),
+		},
+		{
+			"month across the year",
+			Quota{Reset: ResetMonth, Timezone: "UTC"},
+			time.Date(2024, 12, 15, 8, 0, 0, 0, time.UTC),
+			time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"day with daylight saving",
+			Quota{Reset: ResetDay, Timezone: "America/New_York"},
+			time.Date(2024, 3, 10, 12, 0, 0, 0, newYork),
+			time.Date(2024, 3, 10, 0, 0, 0, 0, newYork),
+			time.Date(2024, 3, 11, 0, 0, 0, 0, newYork),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := mustCompile(t, tt.quota)
+			period := q.periodOf(tt.now)
+			if !period.Equal(tt.period) {
+				t.Errorf("periodOf = %v, want %v", period, tt.period)
+			}
+			if next := q.nextOf(period); !next.Equal(tt.next) {
+				t.Errorf("nextOf = %v, want %v", next, tt.next)
+			}
+		})
+	}
+}
+
+func TestUsage(t *testing.T) {
+	now := time.Now()
+	day := mustCompile(t, Quota{Requests: 10, Tokens: 1000, Reset: ResetDay, Reserve: 2})
+	rolling := mustCompile(t, Quota{Requests: 3, Reset: ResetRolling, Window: "1h"})
+	upstream := func(n int) *int { return &n }
+
+	tests := []struct {
+		name      string
+		quota     Quota
+		usage     usage
+		requests  int
+		tokens    int
+		remaining int
+		exhausted bool
+	}{
+		{"unused", day, usage{Period: day.periodOf(now)}, 0, 0, 10, false},
+		{"used", day, usage{Period: day.periodOf(now), Requests: 5, Tokens: 300}, 5, 300, 5, false},
+		{"reserve", day, usage{Period: day.periodOf(now), Requests: 8}, 8, 0, 2, true},
+		{"tokens", day, usage{Period: day.periodOf(now), Requests: 1, Tokens: 1000}, 1, 1000, 9, true},
+		{"previous period", day, usage{Period: day.periodOf(now).AddDate(0, 0, -1), Requests: 10}, 0, 0, 10, false},
+		{"upstream is lower", day, usage{Period: day.periodOf(now), Requests: 1, Upstream: upstream(4), Reported: now}, 1, 0, 4, false},
+		{"rolling", rolling, usage{Events: []event{{now.Add(-2 * time.Hour), 5}, {now.Add(-30 * time.Minute), 7}}}, 1, 7, 2, false},
+		{"rolling full", rolling, usage{Events: []event{{now.Add(-50 * time.Minute), 1}, {now.Add(-20 * time.Minute), 1}, {now, 1}}}, 3, 3, 0, true},
+		{"rolling stale upstream", rolling, usage{Upstream: upstream(0), Reported: now.Add(-2 * time.Hour)}, 0, 0, 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := "test:" + t.Name()
+			u := tt.usage
+			mu.Lock()
+			accounts[id] = &u
+			st := status(id, tt.quota, true, usageOf(id, tt.quota, now))
+			delete(accounts, id)
+			mu.Unlock()
+
+			if st.Requests != tt.requests || st.Tokens != tt.tokens {
+				t.Errorf("used = %d requests, %d tokens; want %d, %d", st.Requests, st.Tokens, tt.requests, tt.tokens)
+			}
+			if st.Remaining == nil || *st.Remaining != tt.remaining {
+				t.Errorf("remaining = %v, want %d", st.Remaining, tt.remaining)
+			}
+			if st.Exhausted != tt.exhausted {
+				t.Errorf("exhausted = %v, want %v", st.Exhausted, tt.exhausted)
+			}
+		})
+	}
+}
+
+func TestRollingResetAt(t *testing.T) {
+	now := time.Now()
+	q := mustCompile(t, Quota{Requests: 3, Reset: ResetRolling, Window: "1h"})
+	first := now.Add(-40 * time.Minute)
+	st := status("test", q, true, &usage{Events: []event{{first, 1}, {now, 1}}})
+	if want := first.Add(time.Hour).Unix(); st.ResetAt != want {
+		t.Errorf("reset at = %d, want %d", st.ResetAt, want)
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	now := time.Now()
+	upstream := func(n int) *int { return &n }
+	tests := []struct {
+		name  string
+		quota *Quota
+		usage *usage
+		want  float64
+	}{
+		{"untracked", nil, nil, 1},
+		{"requests", &Quota{Requests: 10}, &usage{Requests: 4}, 0.6},
+		{"tokens are lower", &Quota{Requests: 10, Tokens: 100}, &usage{Requests: 1, Tokens: 75}, 0.25},
+		{"upstream is lower", &Quota{Requests: 10}, &usage{Requests: 1, Upstream: upstream(2), Reported: now}, 0.2},
+		{"overdrawn", &Quota{Tokens: 100}, &usage{Tokens: 150}, 0},
+		{"upstream only", nil, &usage{Upstream: upstream(3), Reported: now}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := "test:" + strings.ToLower(t.Name())
+			mu.Lock()
+			if tt.quota != nil {
+				q := mustCompile(t, *tt.quota)
+				members[id] = q
+			}
+			if tt.usage != nil {
+				u := *tt.usage
+				if tt.quota != nil {
+					u.Period = members[id].periodOf(now)
+				} else {
+					u.Period = untracked.periodOf(now)
+				}
+				accounts[id] = &u
+			}
+			mu.Unlock()
+			t.Cleanup(func() {
+				mu.Lock()
+				delete(members, id)
+				delete(accounts, id)
+				mu.Unlock()
+			})
+
+			if got := Remaining(id); got < tt.want-1e-9 || got > tt.want+1e-9 {
+				t.Errorf("Remaining = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
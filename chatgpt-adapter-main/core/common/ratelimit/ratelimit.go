@@ -0,0 +1,306 @@
+package ratelimit
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/logger"
+	"github.com/iocgo/sdk/env"
+)
+
+// Limit 令牌桶限额，0 为不限制
+type Limit struct {
+	RPM int `mapstructure:"rpm" json:"rpm,omitempty"` // 每分钟请求数
+	TPD int `mapstructure:"tpd" json:"tpd,omitempty"` // 每天 token 数
+}
+
+func (l Limit) Empty() bool {
+	return l.RPM <= 0 && l.TPD <= 0
+}
+
+// Scope 限额的作用范围，如 key、model、account
+type Scope struct {
+	Name  string
+	Key   string
+	Limit Limit
+}
+
+func (s Scope) id() string {
+	return s.Name + ":" + s.Key
+}
+
+// Status 检查后剩余的额度，用于输出 x-ratelimit-* 响应头
+type Status struct {
+	Scope Scope
+
+	Requests          int
+	RemainingRequests int
+	ResetRequests     time.Duration
+
+	Tokens          int
+	RemainingTokens int
+	ResetTokens     time.Duration
+
+	RetryAfter time.Duration // 超出限额时需要等待的时间
+}
+
+// 令牌桶，tokens 可以为负数：token 数在请求结束后才知道，先透支再慢慢恢复
+type bucket struct {
+	capacity float64
+	rate     float64 // 每秒恢复
+	tokens   float64
+	last     time.Time
+}
+
+func newBucket(capacity int, period time.Duration, now time.Time) *bucket {
+	return &bucket{
+		capacity: float64(capacity),
+		rate:     float64(capacity) / period.Seconds(),
+		tokens:   float64(capacity),
+		last:     now,
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if !now.After(b.last) {
+		return
+	}
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// 恢复 n 个令牌需要的时间
+func (b *bucket) wait(n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+type limiter struct {
+	requests *bucket
+	tokens   *bucket
+	limit    Limit
+	touched  time.Time
+}
+
+var (
+	mu       sync.Mutex
+	limiters = make(map[string]*limiter)
+)
+
+func init() {
+	go gc()
+}
+
+// 清理长时间未使用且已恢复满额的限额
+func gc() {
+	for {
+		time.Sleep(10 * time.Minute)
+		mu.Lock()
+		now := time.Now()
+		for id, l := range limiters {
+			if now.Sub(l.touched) > 24*time.Hour {
+				delete(limiters, id)
+			}
+		}
+		mu.Unlock()
+	}
+}
+
+// 获取限额，配置变化时重建
+func limiterOf(s Scope, now time.Time) *limiter {
+	l, ok := limiters[s.id()]
+	if !ok || l.limit != s.Limit {
+		l = &limiter{limit: s.Limit}
+		if s.Limit.RPM > 0 {
+			l.requests = newBucket(s.Limit.RPM, time.Minute, now)
+		}
+		if s.Limit.TPD > 0 {
+			l.tokens = newBucket(s.Limit.TPD, 24*time.Hour, now)
+		}
+		limiters[s.id()] = l
+	}
+
+	l.touched = now
+	if l.requests != nil {
+		l.requests.refill(now)
+	}
+	if l.tokens != nil {
+		l.tokens.refill(now)
+	}
+	return l
+}
+
+func status(s Scope, l *limiter) (st Status) {
+	st.Scope = s
+	if b := l.requests; b != nil {
+		st.Requests = s.Limit.RPM
+		st.RemainingRequests = int(math.Floor(b.tokens))
+		st.ResetRequests = b.wait(b.capacity)
+	}
+	if b := l.tokens; b != nil {
+		st.Tokens = s.Limit.TPD
+		st.RemainingTokens = int(math.Floor(b.tokens))
+		st.ResetTokens = b.wait(b.capacity)
+	}
+	return
+}
+
+// Acquire 检查全部范围，都有剩余额度时各消耗一次请求。
+// 通过时返回剩余请求数最少的状态，不通过时返回超出限额的状态
+func Acquire(scopes ...Scope) (Status, bool) {
+	return AcquireN(1, scopes...)
+}
+
+// AcquireN 一次消耗 n 个请求，如 n > 1 的补全。n 超过每分钟请求数时需要令牌桶是满的，超出部分透支
+func AcquireN(n int, scopes ...Scope) (Status, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	var tightest *Status
+	for _, s := range scopes {
+		if s.Limit.Empty() {
+			continue
+		}
+
+		l := limiterOf(s, now)
+		if b := l.requests; b != nil && b.tokens < math.Min(float64(n), b.capacity) {
+			st := status(s, l)
+			st.RemainingRequests = 0
+			st.RetryAfter = b.wait(math.Min(float64(n), b.capacity))
+			return st, false
+		}
+		if b := l.tokens; b != nil && b.tokens <= 0 {
+			st := status(s, l)
+			st.RemainingTokens = 0
+			st.RetryAfter = b.wait(1)
+			return st, false
+		}
+	}
+
+	for _, s := range scopes {
+		if s.Limit.Empty() {
+			continue
+		}
+
+		l := limiterOf(s, now)
+		if l.requests != nil {
+			l.requests.tokens -= float64(n)
+		}
+
+		st := status(s, l)
+		if tightest == nil || remaining(st) < remaining(*tightest) {
+			tightest = &st
+		}
+	}
+
+	if tightest == nil {
+		return Status{}, true
+	}
+	return *tightest, true
+}
+
+// 用于比较的剩余比例
+func remaining(st Status) float64 {
+	ratio := 1.0
+	if st.Requests > 0 {
+		ratio = min(ratio, float64(st.RemainingRequests)/float64(st.Requests))
+	}
+	if st.Tokens > 0 {
+		ratio = min(ratio, float64(st.RemainingTokens)/float64(st.Tokens))
+	}
+	return ratio
+}
+
+// Exhausted 判断是否已超出限额，不消耗额度
+func Exhausted(s Scope) bool {
+	if s.Limit.Empty() {
+		return false
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	l := limiterOf(s, time.Now())
+	return (l.requests != nil && l.requests.tokens < 1) ||
+		(l.tokens != nil && l.tokens.tokens <= 0)
+}
+
+// Charge 请求结束后扣除实际使用的 token 数
+func Charge(tokens int, scopes ...Scope) {
+	if tokens <= 0 {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	for _, s := range scopes {
+		if s.Limit.TPD <= 0 {
+			continue
+		}
+		limiterOf(s, now).tokens.tokens -= float64(tokens)
+	}
+}
+
+// Snapshot 当前全部限额的状态，prefix 不为空时只返回该范围
+func Snapshot(prefix string) []Status {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	result := make([]Status, 0, len(limiters))
+	for id, l := range limiters {
+		if prefix != "" && !strings.HasPrefix(id, prefix+":") {
+			continue
+		}
+
+		name, key, _ := strings.Cut(id, ":")
+		s := Scope{Name: name, Key: key, Limit: l.limit}
+		if l.requests != nil {
+			l.requests.refill(now)
+		}
+		if l.tokens != nil {
+			l.tokens.refill(now)
+		}
+		result = append(result, status(s, l))
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Scope.id() < result[j].Scope.id()
+	})
+	return result
+}
+
+var (
+	account Limit
+	pools   map[string]Limit
+)
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		if err := env.UnmarshalKey("ratelimit.account", &account); err != nil {
+			logger.Fatal(err)
+		}
+		if err := env.UnmarshalKey("ratelimit.pools", &pools); err != nil {
+			logger.Fatal(err)
+		}
+	})
+}
+
+// Account 上游账号的限额范围，id 为账号池名称与账号哈希，账号池可单独配置
+func Account(id string) Scope {
+	limit := account
+	if pool, _, ok := strings.Cut(id, ":"); ok {
+		if l, exists := pools[pool]; exists {
+			limit = l
+		}
+	}
+	return Scope{Name: "account", Key: id, Limit: limit}
+}
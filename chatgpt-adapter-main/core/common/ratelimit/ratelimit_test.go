@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		spent   float64
+		elapsed time.Duration
+		tokens  float64
+		wait    time.Duration // 恢复 1 个令牌需要的时间
+	}{
+		{"full", 0, 0, 60, 0},
+		{"empty", 60, 0, 0, time.Second},
+		{"refill", 60, 10 * time.Second, 10, 0},
+		{"refill capped", 30, time.Hour, 60, 0},
+		{"overdraft", 90, 0, -30, 31 * time.Second},
+		{"overdraft refill", 90, 20 * time.Second, -10, 11 * time.Second},
+		{"clock skew", 60, -time.Second, 0, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBucket(60, time.Minute, now)
+			b.tokens -= tt.spent
+			b.refill(now.Add(tt.elapsed))
+			if b.tokens != tt.tokens {
+				t.Errorf("tokens = %v, want %v", b.tokens, tt.tokens)
+			}
+			if wait := b.wait(1); wait != tt.wait {
+				t.Errorf("wait(1) = %v, want %v", wait, tt.wait)
+			}
+		})
+	}
+}
+
+func TestAcquireN(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    Limit
+		acquires []int
+		ok       []bool
+	}{
+		{"unlimited", Limit{}, []int{1000, 1000}, []bool{true, true}},
+		{"within rpm", Limit{RPM: 3}, []int{1, 1, 1, 1}, []bool{true, true, true, false}},
+		{"n requests", Limit{RPM: 5}, []int{3, 3}, []bool{true, false}},
+		{"n above rpm needs a full bucket", Limit{RPM: 2}, []int{5, 1}, []bool{true, false}},
+		{"n above rpm after use", Limit{RPM: 2}, []int{1, 5}, []bool{true, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope := Scope{Name: "test", Key: t.Name(), Limit: tt.limit}
+			for i, n := range tt.acquires {
+				st, ok := AcquireN(n, scope)
+				if ok != tt.ok[i] {
+					t.Fatalf("acquire #%d of %d = %v, want %v", i, n, ok, tt.ok[i])
+				}
+				if !ok && st.RetryAfter <= 0 {
+					t.Errorf("acquire #%d rejected without retry-after", i)
+				}
+			}
+		})
+	}
+}
+
+func TestAcquireAllOrNothing(t *testing.T) {
+	loose := Scope{Name: "test", Key: t.Name() + "-loose", Limit: Limit{RPM: 10}}
+	tight := Scope{Name: "test", Key: t.Name() + "-tight", Limit: Limit{RPM: 1}}
+
+	st, ok := Acquire(loose, tight)
+	if !ok || st.Scope.Key != tight.Key || st.RemainingRequests != 0 {
+		t.Fatalf("first acquire = %+v, %v; want the tightest scope", st, ok)
+	}
+
+	st, ok = Acquire(loose, tight)
+	if ok || st.Scope.Key != tight.Key {
+		t.Fatalf("second acquire = %+v, %v; want rejected by the tight scope", st, ok)
+	}
+
+	// 被拒绝时不消耗其它范围的额度
+	for _, s := range Snapshot("test") {
+		if s.Scope.Key == loose.Key && s.RemainingRequests != 9 {
+			t.Errorf("loose scope remaining = %d, want 9", s.RemainingRequests)
+		}
+	}
+}
+
+func TestCharge(t *testing.T) {
+	scope := Scope{Name: "test", Key: t.Name(), Limit: Limit{TPD: 100}}
+	if _, ok := Acquire(scope); !ok {
+		t.Fatal("first acquire rejected")
+	}
+
+	// token 数在请求结束后扣除，可以透支
+	Charge(150, scope)
+	if !Exhausted(scope) {
+		t.Error("scope should be exhausted after an overdraft")
+	}
+	if st, ok := Acquire(scope); ok || st.RemainingTokens != 0 {
+		t.Errorf("acquire after overdraft = %+v, %v; want rejected", st, ok)
+	}
+}
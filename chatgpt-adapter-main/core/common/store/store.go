@@ -0,0 +1,199 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/logger"
+	"github.com/iocgo/sdk/env"
+)
+
+// Store 持久化账号池状态与派生凭证，store.type 为空时不启用
+type Store interface {
+	// Load 读取 key 对应的值，不存在时 ok 为 false
+	Load(key string, value interface{}) (ok bool, err error)
+	Save(key string, value interface{}) error
+}
+
+var (
+	drivers = map[string]func(env *env.Environment) (Store, error){
+		"file": newFileStore,
+	}
+
+	current Store
+)
+
+// Register 注册存储实现，需要在 inited.Initialized 之前调用
+func Register(name string, driver func(env *env.Environment) (Store, error)) {
+	drivers[name] = driver
+}
+
+func init() {
+	// 需要在账号池创建之前完成，依赖本包的 inited 函数总是先注册
+	inited.AddInitialized(func(env *env.Environment) {
+		name := env.GetString("store.type")
+		if name == "" {
+			return
+		}
+
+		driver, ok := drivers[name]
+		if !ok {
+			logger.Fatalf("unsupported store.type: %s", name)
+		}
+
+		s, err := driver(env)
+		if err != nil {
+			logger.Fatalf("failed to initialize the store: %v", err)
+		}
+		current = s
+		loadCredentials()
+	})
+}
+
+func Enabled() bool { return current != nil }
+
+// Load 未启用时返回 false
+func Load(key string, value interface{}) bool {
+	if current == nil {
+		return false
+	}
+
+	ok, err := current.Load(key, value)
+	if err != nil {
+		logger.Errorf("failed to load '%s' from the store: %v", key, err)
+		return false
+	}
+	return ok
+}
+
+func Save(key string, value interface{}) {
+	if current == nil {
+		return
+	}
+
+	if err := current.Save(key, value); err != nil {
+		logger.Errorf("failed to save '%s' to the store: %v", key, err)
+	}
+}
+
+// 文件存储，每个 key 对应 <store.path>/<key>.json
+type fileStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+func newFileStore(env *env.Environment) (Store, error) {
+	path := env.GetString("store.path")
+	if path == "" {
+		path = "data"
+	}
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+	return &fileStore{path: path}, nil
+}
+
+func (s *fileStore) file(key string) string {
+	return filepath.Join(s.path, key+".json")
+}
+
+func (s *fileStore) Load(key string, value interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.file(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, value)
+}
+
+// 先写入临时文件再重命名，避免进程退出时文件不完整
+func (s *fileStore) Save(key string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp := s.file(key) + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file(key))
+}
+
+// 派生凭证，如 coze websdk 登录后的 cookies、cloudflare clearance
+type credential struct {
+	Value json.RawMessage `json:"value"`
+	Time  time.Time       `json:"time"`
+}
+
+const credentialsKey = "credentials"
+
+var (
+	credentialsMu sync.Mutex
+	credentials   = make(map[string]map[string]credential)
+)
+
+func loadCredentials() {
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+	Load(credentialsKey, &credentials)
+	if credentials == nil {
+		credentials = make(map[string]map[string]credential)
+	}
+}
+
+// Credential 读取缓存的凭证，t 为缓存时间
+func Credential(name, key string, value interface{}) (t time.Time, ok bool) {
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+
+	c, ok := credentials[name][key]
+	if !ok {
+		return
+	}
+	if err := json.Unmarshal(c.Value, value); err != nil {
+		logger.Errorf("failed to decode the credential %s/%s: %v", name, key, err)
+		return t, false
+	}
+	return c.Time, true
+}
+
+// SetCredential 缓存凭证并写入存储，value 为 nil 时删除
+func SetCredential(name, key string, value interface{}) {
+	if current == nil {
+		return
+	}
+
+	var data []byte
+	if value != nil {
+		var err error
+		if data, err = json.Marshal(value); err != nil {
+			logger.Errorf("failed to encode the credential %s/%s: %v", name, key, err)
+			return
+		}
+	}
+
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+	if data == nil {
+		delete(credentials[name], key)
+	} else {
+		if credentials[name] == nil {
+			credentials[name] = make(map[string]credential)
+		}
+		credentials[name][key] = credential{Value: data, Time: time.Now()}
+	}
+	Save(credentialsKey, credentials)
+}
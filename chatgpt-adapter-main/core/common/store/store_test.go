@@ -0,0 +1,113 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iocgo/sdk/env"
+	"github.com/spf13/viper"
+)
+
+// 使用临时目录的文件存储，测试结束后关闭
+func withFileStore(t *testing.T) (dir string) {
+	t.Helper()
+	dir = filepath.Join(t.TempDir(), "data")
+	v := viper.New()
+	v.Set("store.path", dir)
+
+	s, err := newFileStore(&env.Environment{Viper: v})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current = s
+	t.Cleanup(func() { current = nil })
+	return
+}
+
+func TestFileStore(t *testing.T) {
+	dir := withFileStore(t)
+
+	type value struct {
+		Name  string    `json:"name"`
+		Items []int     `json:"items"`
+		Time  time.Time `json:"time"`
+	}
+	saved := value{"pool", []int{1, 2}, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)}
+	Save("pool-test", saved)
+
+	var loaded value
+	if !Load("pool-test", &loaded) || loaded.Name != saved.Name || len(loaded.Items) != 2 || !loaded.Time.Equal(saved.Time) {
+		t.Errorf("loaded = %+v", loaded)
+	}
+
+	// 写入临时文件后重命名
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "pool-test.json" {
+		t.Errorf("files = %v", entries)
+	}
+
+	if Load("missing", &loaded) {
+		t.Error("loading a missing key should return false")
+	}
+	_ = os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0600)
+	if Load("broken", &loaded) {
+		t.Error("loading a broken file should return false")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	if Enabled() {
+		t.Fatal("the store should be disabled without store.type")
+	}
+
+	var value string
+	Save("key", "value")
+	if Load("key", &value) {
+		t.Error("Load should return false when the store is disabled")
+	}
+
+	SetCredential("coze", "account", "cookie")
+	if _, ok := Credential("coze", "account", &value); ok {
+		t.Error("credentials should not be cached when the store is disabled")
+	}
+}
+
+func TestCredential(t *testing.T) {
+	withFileStore(t)
+	t.Cleanup(func() { credentials = make(map[string]map[string]credential) })
+
+	type cookies struct {
+		Session string `json:"session"`
+	}
+	SetCredential("coze", "account-1", cookies{"s1"})
+	SetCredential("you", "clearance", "cf")
+
+	// 重新加载后仍然存在
+	credentials = nil
+	loadCredentials()
+
+	var c cookies
+	if at, ok := Credential("coze", "account-1", &c); !ok || c.Session != "s1" || time.Since(at) > time.Minute {
+		t.Errorf("credential = %+v, %v, %v", c, at, ok)
+	}
+	var clearance string
+	if _, ok := Credential("you", "clearance", &clearance); !ok || clearance != "cf" {
+		t.Errorf("clearance = %q", clearance)
+	}
+	if _, ok := Credential("coze", "account-2", &c); ok {
+		t.Error("an unknown credential should not be found")
+	}
+
+	// nil 时删除
+	SetCredential("coze", "account-1", nil)
+	credentials = nil
+	loadCredentials()
+	if _, ok := Credential("coze", "account-1", &c); ok {
+		t.Error("the credential should have been deleted")
+	}
+	if _, ok := Credential("you", "clearance", &clearance); !ok {
+		t.Error("deleting a credential should keep the others")
+	}
+}
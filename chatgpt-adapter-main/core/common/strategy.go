@@ -0,0 +1,154 @@
+package common
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+)
+
+// 账号池的选择策略
+const (
+	StrategyRoundRobin    = "round-robin"
+	StrategyLRU           = "least-recently-used"
+	StrategyLeastInFlight = "least-in-flight"
+	StrategyMostQuota     = "most-remaining-quota"
+	StrategyWeighted      = "weighted"
+	StrategySticky        = "sticky"
+)
+
+type strategyConfig struct {
+	Strategy   string         `mapstructure:"strategy"`
+	Priorities map[string]int `mapstructure:"priorities"` // 成员 Id 的权重，默认 1
+
+	// least-in-flight 策略下成员可以同时处理的请求数，0 为不限制
+	MaxInFlight int `mapstructure:"max-in-flight"`
+}
+
+// 使用中的成员是否可以继续分配
+func (config strategyConfig) shared(inFlight int) bool {
+	return config.Strategy == StrategyLeastInFlight && (config.MaxInFlight <= 0 || inFlight < config.MaxInFlight)
+}
+
+var strategies = make(map[string]strategyConfig)
+
+func strategyOf(name string) strategyConfig {
+	return strategies[name]
+}
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		if err := env.UnmarshalKey("pool-strategies", &strategies); err != nil {
+			logger.Fatal(err)
+		}
+
+		for name, config := range strategies {
+			switch config.Strategy {
+			case "", StrategyRoundRobin, StrategyLeastInFlight, StrategyMostQuota, StrategyWeighted, StrategySticky:
+			case "lru", StrategyLRU:
+				config.Strategy = StrategyLRU
+				strategies[name] = config
+			default:
+				logger.Fatalf("unsupported pool-strategies.%s.strategy: %s", name, config.Strategy)
+			}
+		}
+	})
+}
+
+// StickyKey 用于 sticky 策略的终端用户标识：请求中的 user 字段，其次是网关密钥，最后是客户端 IP
+func StickyKey(ctx *gin.Context) string {
+	if completion := GetGinCompletion(ctx); completion.User != "" {
+		return "user:" + completion.User
+	}
+	if key, ok := GetGinValue[*model.ApiKey](ctx, vars.GinApiKey); ok {
+		return "key:" + CalcHex(key.Key)
+	}
+	return "ip:" + ctx.ClientIP()
+}
+
+// 候选成员的排列顺序，Poll 按顺序检查 Condition
+type candidate struct {
+	index     int
+	id        string
+	lastUsed  time.Time
+	inFlight  int
+	remaining float64 // 剩余额度的比例，未配置额度时为 1
+	draining  bool
+	score     float64
+}
+
+func order(strategy strategyConfig, candidates []candidate, pos int, key string) []candidate {
+	switch strategy.Strategy {
+	case StrategyLRU:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].lastUsed.Before(candidates[j].lastUsed)
+		})
+
+	case StrategyLeastInFlight:
+		// 请求数相同时优先剩余额度多的
+		rotate(candidates, pos)
+		sort.SliceStable(candidates, func(i, j int) bool {
+			if candidates[i].inFlight != candidates[j].inFlight {
+				return candidates[i].inFlight < candidates[j].inFlight
+			}
+			return candidates[i].remaining > candidates[j].remaining
+		})
+
+	case StrategyMostQuota:
+		rotate(candidates, pos)
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].remaining > candidates[j].remaining
+		})
+
+	case StrategyWeighted:
+		// 按权重随机排列：rand^(1/weight) 从大到小
+		for i := range candidates {
+			weight := strategy.Priorities[candidates[i].id]
+			if weight <= 0 {
+				weight = 1
+			}
+			candidates[i].score = math.Pow(rand.Float64(), 1/float64(weight))
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].score > candidates[j].score
+		})
+
+	case StrategySticky:
+		if key == "" {
+			rotate(candidates, pos)
+			break
+		}
+
+		// 一致性哈希：成员增减时只影响落在该成员上的用户
+		for i := range candidates {
+			h := fnv.New64a()
+			_, _ = h.Write([]byte(key + "\x00" + candidates[i].id))
+			candidates[i].score = float64(h.Sum64())
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].score > candidates[j].score
+		})
+
+	default:
+		rotate(candidates, pos)
+	}
+	return candidates
+}
+
+// 从 pos 开始轮询
+func rotate(candidates []candidate, pos int) {
+	if len(candidates) == 0 {
+		return
+	}
+	pos %= len(candidates)
+	rotated := append(append([]candidate(nil), candidates[pos:]...), candidates[:pos]...)
+	copy(candidates, rotated)
+}
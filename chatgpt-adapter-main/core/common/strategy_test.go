@@ -0,0 +1,190 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iocgo/sdk/env"
+)
+
+func ids(candidates []candidate) (result []string) {
+	for _, c := range candidates {
+		result = append(result, c.id)
+	}
+	return
+}
+
+func TestOrder(t *testing.T) {
+	now := time.Now()
+	members := func() []candidate {
+		return []candidate{
+			{index: 0, id: "a", lastUsed: now.Add(-time.Minute), inFlight: 2, remaining: 0.5},
+			{index: 1, id: "b", lastUsed: now.Add(-time.Hour), inFlight: 0, remaining: 0.1},
+			{index: 2, id: "c", lastUsed: now, inFlight: 0, remaining: 0.9},
+			{index: 3, id: "d", inFlight: 1, remaining: 1},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		strategy strategyConfig
+		pos      int
+		want     []string
+	}{
+		{"round robin", strategyConfig{}, 2, []string{"c", "d", "a", "b"}},
+		{"round robin wraps", strategyConfig{Strategy: StrategyRoundRobin}, 5, []string{"b", "c", "d", "a"}},
+		{"least recently used", strategyConfig{Strategy: StrategyLRU}, 2, []string{"d", "b", "a", "c"}},
+		{"least in flight", strategyConfig{Strategy: StrategyLeastInFlight}, 0, []string{"c", "b", "d", "a"}},
+		{"most remaining quota", strategyConfig{Strategy: StrategyMostQuota}, 1, []string{"d", "c", "a", "b"}},
+		{"sticky without key", strategyConfig{Strategy: StrategySticky}, 1, []string{"b", "c", "d", "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(order(tt.strategy, members(), tt.pos, ""))
+			if len(got) != len(tt.want) {
+				t.Fatalf("order = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("order = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderSticky(t *testing.T) {
+	strategy := strategyConfig{Strategy: StrategySticky}
+	members := func(names ...string) (result []candidate) {
+		for i, name := range names {
+			result = append(result, candidate{index: i, id: name})
+		}
+		return
+	}
+
+	// 同一用户总是得到相同的顺序，与轮询位置无关
+	first := ids(order(strategy, members("a", "b", "c", "d"), 0, "user:1"))
+	for pos := 1; pos < 4; pos++ {
+		if got := ids(order(strategy, members("a", "b", "c", "d"), pos, "user:1")); got[0] != first[0] {
+			t.Errorf("sticky order at pos %d = %v, want %s first", pos, got, first[0])
+		}
+	}
+
+	// 移除其它成员不影响该用户的选择
+	var rest []string
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if name == first[0] || len(rest) < 2 {
+			rest = append(rest, name)
+		}
+	}
+	if got := ids(order(strategy, members(rest...), 0, "user:1")); got[0] != first[0] {
+		t.Errorf("sticky order after removing members = %v, want %s first", got, first[0])
+	}
+
+	// 不同用户分散到不同成员
+	chosen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		chosen[ids(order(strategy, members("a", "b", "c", "d"), 0, "user:"+string(rune('A'+i))))[0]] = true
+	}
+	if len(chosen) < 3 {
+		t.Errorf("sticky spread users over %d members, want at least 3", len(chosen))
+	}
+}
+
+func TestOrderWeighted(t *testing.T) {
+	strategy := strategyConfig{Strategy: StrategyWeighted, Priorities: map[string]int{"heavy": 9}}
+	count := 0
+	for i := 0; i < 2000; i++ {
+		candidates := []candidate{{index: 0, id: "light"}, {index: 1, id: "heavy"}}
+		if order(strategy, candidates, 0, "")[0].id == "heavy" {
+			count++
+		}
+	}
+	// 权重 9:1，期望 90%
+	if ratio := float64(count) / 2000; ratio < 0.85 || ratio > 0.95 {
+		t.Errorf("heavy member chosen first %.2f of the time, want about 0.9", ratio)
+	}
+}
+
+func newTestContainer(t *testing.T, strategy strategyConfig, members ...string) *PollContainer[string] {
+	t.Helper()
+	name := "test-" + t.Name()
+	strategies[name] = strategy
+	t.Cleanup(func() { delete(strategies, name) })
+
+	// 不恢复之前运行时保存的状态
+	_ = os.Remove(filepath.Join(env.Env.GetString("store.path"), "pool-"+name+".json"))
+
+	container := NewPollContainer[string](name, members, time.Hour)
+	container.Condition = func(value string, argv ...interface{}) bool {
+		ok, err := container.Available(value)
+		return err == nil && ok
+	}
+	return container
+}
+
+func TestPollShared(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy strategyConfig
+		want     []string // 连续分配的结果，空字符串为没有可用成员
+	}{
+		{"round robin hands out idle members only", strategyConfig{Strategy: StrategyRoundRobin}, []string{"a", "b", ""}},
+		{"least in flight shares members", strategyConfig{Strategy: StrategyLeastInFlight, MaxInFlight: 2}, []string{"a", "b", "a", "b", ""}},
+		{"least in flight unlimited", strategyConfig{Strategy: StrategyLeastInFlight}, []string{"a", "b", "a", "b", "a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			container := newTestContainer(t, tt.strategy, "a", "b")
+			for i, want := range tt.want {
+				got, err := container.Poll()
+				if want == "" {
+					if err == nil {
+						t.Fatalf("poll #%d = %s, want no member", i, got)
+					}
+					continue
+				}
+				if err != nil || got != want {
+					t.Fatalf("poll #%d = %s, %v; want %s", i, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPollSharedRelease(t *testing.T) {
+	container := newTestContainer(t, strategyConfig{Strategy: StrategyLeastInFlight, MaxInFlight: 2}, "a")
+	for i := 0; i < 2; i++ {
+		if _, err := container.Poll(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 一个请求结束后仍在使用中，可以再分配一次
+	if err := container.MarkTo("a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if marker, _ := container.Marked("a"); marker != 1 {
+		t.Errorf("marker after releasing one of two requests = %d, want 1", marker)
+	}
+	if _, err := container.Poll(); err != nil {
+		t.Errorf("poll after releasing one request: %v", err)
+	}
+
+	// 全部结束后复位
+	_ = container.MarkTo("a", 0)
+	_ = container.MarkTo("a", 0)
+	if marker, _ := container.Marked("a"); marker != 0 {
+		t.Errorf("marker after releasing every request = %d, want 0", marker)
+	}
+
+	// 异常状态的成员不会被共享
+	_ = container.MarkTo("a", 2)
+	if ok, _ := container.Available("a"); ok {
+		t.Error("a failed member should not be available")
+	}
+}
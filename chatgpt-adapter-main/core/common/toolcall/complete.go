@@ -2,6 +2,7 @@ package toolcall
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
 	"slices"
@@ -11,13 +12,14 @@ import (
 
 	"chatgpt-adapter/core/cache"
 	"chatgpt-adapter/core/common"
-	"chatgpt-adapter/core/common/agent"
+	"chatgpt-adapter/core/common/jsonschema"
 	"chatgpt-adapter/core/common/vars"
 	"chatgpt-adapter/core/gin/model"
 	"chatgpt-adapter/core/gin/response"
 	"chatgpt-adapter/core/logger"
 	"github.com/dlclark/regexp2"
 	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
 )
 
 var (
@@ -27,6 +29,20 @@ var (
 )
 
 func NeedExec(ctx *gin.Context) bool {
+	completion := common.GetGinCompletion(ctx)
+	messageL := len(completion.Messages)
+	if messageL == 0 || len(completion.Tools) == 0 {
+		return false
+	}
+
+	// tool_choice 显式要求时不受开关限制
+	switch mode, _ := toolChoiceMode(completion); mode {
+	case "none":
+		return false
+	case "required", "function":
+		return true
+	}
+
 	var tool = "-1"
 	{
 		t := common.GetGinToolValue(ctx)
@@ -40,16 +56,6 @@ func NeedExec(ctx *gin.Context) bool {
 		}
 	}
 
-	completion := common.GetGinCompletion(ctx)
-	messageL := len(completion.Messages)
-	if messageL == 0 {
-		return false
-	}
-
-	if len(completion.Tools) == 0 {
-		return false
-	}
-
 	role := completion.Messages[messageL-1]["role"]
 	return (role != "function" && role != "tool") || tool != "-1"
 }
@@ -161,53 +167,161 @@ func ToolChoice(ctx *gin.Context, completion model.Completion, callback func(mes
 		}
 	}
 
-	// toolChoice自推荐toolId处理
-	if completion.ToolChoice != "" && completion.ToolChoice != "auto" {
-		var (
-			keyv       model.Keyv[interface{}]
-			toolChoice model.Keyv[interface{}]
-			ok         = false
-		)
-		toolChoice, ok = completion.ToolChoice.(map[string]interface{})
-		if !ok || !toolChoice.Is("type", "function") {
-			goto label
+	// tool_choice 指定了工具时，只提供该工具给模型
+	mode, forced := toolChoiceMode(completion)
+	if mode == "function" {
+		completion.Tools = filterTools(completion.Tools, forced)
+		if len(completion.Tools) == 0 {
+			return false, fmt.Errorf("tool_choice function '%s' is not found in tools", forced)
 		}
-
-		keyv = toolChoice.GetKeyv("function")
-		if !keyv.Has("name") {
-			goto label
-		}
-
-		if toolId := toolIdWithTools(keyv.GetString("name"), completion.Tools); toolId != "-1" {
-			completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
-				"role": "user", "content": "continue。 工具推荐： toolId = " + toolId,
-			})
-		}
-	label:
 	}
 
-	message, err := buildTemplate(ctx, completion, agent.ToolCall)
+	message, err := buildTemplate(ctx, completion, templateOf(completion).call)
 	if err != nil {
 		return false, err
 	}
 
+	// 流式请求时边生成边输出工具调用，见 Stream
+	s := armStreamer(ctx, completion)
+	defer ctx.Set(tool_streamer, nil)
+
 	content, err := callback(message)
 	if err != nil {
+		if s.started() {
+			logger.Error(err)
+			s.fail(err)
+			return true, nil
+		}
 		return false, err
 	}
 
+	// 解析参数，校验失败或没有按要求选择工具时带上原因重新生成
+	calls, errs := extractToolCalls(ctx, content, completion)
+	retryPrompts := promptsOf(completion)
+	for attempt, retries := 0, toolRetries(); attempt < retries; attempt++ {
+		// 已经开始输出，无法再重新生成
+		if s.started() {
+			break
+		}
+
+		var prompt string
+		if len(errs) > 0 {
+			logger.Warnf("completeTools validation failed (attempt %d): %s", attempt+1, errs)
+			prompt = fmt.Sprintf(retryPrompts.retry, strings.Join(errs, "；"))
+		} else if len(calls) == 0 && mode != "auto" {
+			logger.Warnf("completeTools no tool selected with tool_choice %s (attempt %d)", mode, attempt+1)
+			prompt = retryPrompts.required
+		} else {
+			break
+		}
+
+		retry := message + content + " <|end|>\n" + prompt
+		s = armStreamer(ctx, completion)
+		result, e := callback(retry)
+		if e != nil {
+			logger.Error(e)
+			if s.started() {
+				s.fail(e)
+				return true, nil
+			}
+			break
+		}
+
+		message, content = retry, result
+		calls, errs = extractToolCalls(ctx, content, completion)
+	}
+
+	if len(errs) > 0 {
+		logger.Warnf("completeTools arguments still invalid, respond as is: %s", errs)
+	}
+
 	previousTokens := response.CalcTokens(message)
 	ctx.Set(vars.GinCompletionUsage, response.CalcUsageTokens(content, previousTokens))
+	if s.started() {
+		s.finish(calls, errs)
+		return true, nil
+	}
+
+	switch mode {
+	case "function":
+		// 指定的工具必定返回，模型未给出参数时使用空参数，空参数不符合 schema 时返回错误
+		if len(calls) == 0 {
+			schema := map[string]interface{}(completion.Tools[0].GetKeyv("function").GetKeyv("parameters"))
+			if len(schema) > 0 {
+				if err = jsonschema.Validate(schema, map[string]interface{}{}); err != nil {
+					return false, fmt.Errorf("tool_choice function '%s' was not called and its default arguments are invalid: %v", forced, err)
+				}
+			}
+			calls = append(calls, response.ToolCall{Name: forced, Arguments: "{}"})
+		}
+		return toolCallsResponse(ctx, completion, calls, time.Now().Unix()), nil
+	case "required":
+		if len(calls) == 0 {
+			return false, errors.New("tool_choice is required but the model did not call any tool")
+		}
+	}
+	return parseToTC(ctx, content, calls, completion), nil
+}
 
-	// 解析参数
-	return parseToTC(ctx, content, completion), nil
+// 解析 tool_choice，返回 auto、none、required 或 function，为 function 时 name 为指定的工具名
+func toolChoiceMode(completion model.Completion) (mode, name string) {
+	switch choice := completion.ToolChoice.(type) {
+	case string:
+		if choice == "none" || choice == "required" {
+			return choice, ""
+		}
+	case map[string]interface{}:
+		toolChoice := model.Keyv[interface{}](choice)
+		if toolChoice.Is("type", "function") {
+			if name = toolChoice.GetKeyv("function").GetString("name"); name != "" {
+				return "function", name
+			}
+		}
+	}
+	return "auto", ""
+}
+
+// 过滤出名为 name 的工具
+func filterTools(tools []model.Keyv[interface{}], name string) (result []model.Keyv[interface{}]) {
+	for _, t := range tools {
+		if t.GetKeyv("function").GetString("name") == name {
+			result = append(result, t)
+		}
+	}
+	return
+}
+
+// Render 渲染模型对应的工具提示词但不执行，tasks 为 true 时渲染任务拆解的提示词
+func Render(ctx *gin.Context, completion model.Completion, tasks bool) (t Template, message string, err error) {
+	ctx.Set(exclude_task_contents, "")
+	if mode, forced := toolChoiceMode(completion); mode == "function" {
+		completion.Tools = filterTools(completion.Tools, forced)
+	}
+
+	tpl := templateOf(completion)
+	if tasks {
+		message, err = buildTemplate(ctx, completion, tpl.tasks)
+	} else {
+		message, err = buildTemplate(ctx, completion, tpl.call)
+	}
+	t = *tpl
+	return
+}
+
+// 工具参数校验失败后的重试次数，默认 2 次
+func toolRetries() int {
+	retries := env.Env.GetInt("server.tool-retries")
+	if retries <= 0 {
+		retries = 2
+	}
+	return retries
 }
 
 // 拆解任务, 组装任务提示并返回上下文 (包含缓存已执行的任务逻辑)
 func taskComplete(ctx *gin.Context, completion model.Completion, callback func(message string) (string, error)) (messages []model.Keyv[interface{}], hasTasks bool) {
 	cacheManager := cache.ToolTasksCacheManager()
 	messages = completion.Messages
-	message, err := buildTemplate(ctx, completion, agent.ToolTasks)
+	message, err := buildTemplate(ctx, completion, templateOf(completion).tasks)
 	if err != nil {
 		logger.Error(err)
 		return
@@ -365,10 +479,12 @@ func buildTemplate(ctx *gin.Context, completion model.Completion, template strin
 
 	value, _ := ctx.Get(exclude_task_contents)
 	str, err := newBuilder("tool").
-		Vars("toolDef", getToolId(ctx, completion.Tools)).
+		Vars("toolDef", toolDef(ctx, completion)).
+		Vars("required", toolRequired(completion)).
 		Vars("tools", completion.Tools).
 		Vars("pMessages", pMessages).
 		Vars("excludeTaskContents", value).
+		Vars("parallel", parallelToolCalls(completion)).
 		Vars("content", content).
 		Func("ToolId", func(str string) string {
 			return toolIdWithTools(str, completion.Tools)
@@ -429,25 +545,12 @@ func buildTemplate(ctx *gin.Context, completion model.Completion, template strin
 //
 //	return:
 //	bool  > 是否执行了工具
-func parseToTC(ctx *gin.Context, content string, completion model.Completion) bool {
-	j := ""
+func parseToTC(ctx *gin.Context, content string, calls []response.ToolCall, completion model.Completion) bool {
 	created := time.Now().Unix()
-	slice := strings.Split(content, "TOOL_RESPONSE")
-
-	for _, value := range slice {
-		left := strings.Index(value, "{")
-		right := strings.LastIndex(value, "}")
-		if left >= 0 && right > left {
-			j = value[left : right+1]
-			break
-		}
-	}
-
 	// 非-1值则为有默认选项
 	valueDef := Query(common.GetGinToolValue(ctx).GetString("id"), completion.Tools)
 
-	// 没有解析出 JSON
-	if j == "" {
+	if len(calls) == 0 {
 		if valueDef != "-1" {
 			return toolCallResponse(ctx, completion, valueDef, "{}", created)
 		}
@@ -455,67 +558,167 @@ func parseToTC(ctx *gin.Context, content string, completion model.Completion) bo
 		return false
 	}
 
-	var fn model.Keyv[interface{}]
-	name := ""
-	for _, t := range completion.Tools {
-		fn = t.GetKeyv("function")
-		n := fn.GetString("name")
-		// id 匹配
-		if strings.Contains(j, fn.GetString("id")) {
-			name = n
-			break
+	return toolCallsResponse(ctx, completion, calls, created)
+}
+
+// 提取工具调用，允许并行调用时解析数组形式的多个工具。
+// 参数按工具的 JSON Schema 修复并校验，errs 为未通过校验的原因
+func extractToolCalls(ctx *gin.Context, content string, completion model.Completion) (calls []response.ToolCall, errs []string) {
+	var values []string
+	slice := strings.Split(content, "TOOL_RESPONSE")
+	for _, value := range slice {
+		left := strings.IndexAny(value, "{[")
+		if left < 0 {
+			continue
 		}
-		// name 匹配
-		if strings.Contains(j, n) {
-			name = n
-			break
+
+		if value[left] == '[' {
+			right := strings.LastIndex(value, "]")
+			if right > left {
+				if parsed, _, err := jsonschema.Extract(value[left : right+1]); err == nil {
+					if array, ok := parsed.([]interface{}); ok {
+						for _, item := range array {
+							bytes, _ := json.Marshal(item)
+							values = append(values, string(bytes))
+						}
+						break
+					}
+				}
+			}
+			left = strings.Index(value, "{")
 		}
-	}
 
-	// 没有匹配到工具
-	if name == "" {
-		if valueDef != "-1" {
-			return toolCallResponse(ctx, completion, valueDef, "{}", created)
+		if left < 0 {
+			continue
 		}
-		logger.Infof("completeTools response failed: \n%s", content)
-		return false
+
+		// 输出被截断时交给 jsonschema 补全
+		right := strings.LastIndex(value, "}")
+		if right > left {
+			values = append(values, value[left:right+1])
+		} else {
+			values = append(values, value[left:])
+		}
+		break
 	}
 
-	// 避免AI重复选择相同的工具
-	if names, ok := common.GetGinValues[string](ctx, exclude_tool_names); ok {
+	// 没有解析出 JSON
+	if len(values) == 0 {
+		return
+	}
+
+	// tool_choice 显式要求时允许重复选择
+	names, _ := common.GetGinValues[string](ctx, exclude_tool_names)
+	if mode, _ := toolChoiceMode(completion); mode != "auto" {
+		names = nil
+	}
+	for _, j := range values {
+		name, args, err := parseToolCall(j, completion.Tools)
+		if name == "" {
+			continue
+		}
+
+		// 避免AI重复选择相同的工具
 		if slices.Contains(names, name) {
-			return valueDef != "-1" && toolCallResponse(ctx, completion, valueDef, "{}", created)
+			continue
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+
+		if args != "" {
+			calls = append(calls, response.ToolCall{Name: name, Arguments: args})
+		}
+		if !parallelToolCalls(completion) {
+			break
 		}
 	}
+	return
+}
 
-	// 解析参数
-	var js model.Keyv[interface{}]
-	if err := json.Unmarshal([]byte(j), &js); err != nil {
+// 解析单个工具调用的名称和参数，参数无法解析或不符合 schema 时返回 err
+func parseToolCall(j string, tools []model.Keyv[interface{}]) (name, args string, err error) {
+	// 解析参数，修复多余的逗号、未加引号的键名等
+	value, _, err := jsonschema.Extract(j)
+	js, _ := value.(map[string]interface{})
+
+	fn, ok := toolOf(j, js, tools)
+	// 没有匹配到工具
+	if !ok {
+		return "", "", nil
+	}
+
+	name = fn.GetString("name")
+	if err != nil {
 		logger.Error(err)
-		if valueDef != "-1" {
-			return toolCallResponse(ctx, completion, valueDef, "{}", created)
-		}
-		logger.Infof("completeTools response failed: \n%s", content)
-		return false
+		return
+	}
+
+	if js == nil {
+		err = errors.New("the tool call is not a JSON object")
+		return
 	}
 
 	logger.Infof("completeTools response: \n%s", j)
-	obj, ok := js["arguments"]
-	if !ok {
+	obj, exists := js["arguments"]
+	if !exists {
 		// 尽可能解析，AI貌似十分喜欢将参数改为parameters
-		if js.Has("parameters") &&
+		if _, has := js["parameters"]; has &&
 			!fn.GetKeyv("parameters").
 				GetKeyv("properties").
 				Has("parameters") {
-			obj = js.GetKeyv("parameters")
+			obj = js["parameters"]
 		} else {
 			delete(js, "toolId")
 			obj = js
 		}
 	}
 
+	schema := map[string]interface{}(fn.GetKeyv("parameters"))
+	if len(schema) > 0 {
+		obj = jsonschema.Coerce(schema, obj)
+		err = jsonschema.Validate(schema, obj)
+	}
+
 	bytes, _ := json.Marshal(obj)
-	return toolCallResponse(ctx, completion, name, string(bytes), created)
+	args = string(bytes)
+	return
+}
+
+// 按 toolId、name 精确匹配工具，都不匹配时只有一个工具出现在输出中才使用该工具，
+// 避免 search 与 search_web 这类名称互相包含的工具被混淆
+func toolOf(j string, js map[string]interface{}, tools []model.Keyv[interface{}]) (model.Keyv[interface{}], bool) {
+	for _, key := range []string{"toolId", "name"} {
+		value, _ := js[key].(string)
+		if value == "" {
+			continue
+		}
+		for _, t := range tools {
+			fn := t.GetKeyv("function")
+			if value == fn.GetString("id") || value == fn.GetString("name") {
+				return fn, true
+			}
+		}
+	}
+
+	var matched []model.Keyv[interface{}]
+	for _, t := range tools {
+		fn := t.GetKeyv("function")
+		id, n := fn.GetString("id"), fn.GetString("name")
+		if (id != "" && strings.Contains(j, id)) || (n != "" && strings.Contains(j, n)) {
+			matched = append(matched, fn)
+		}
+	}
+	if len(matched) == 1 {
+		return matched[0], true
+	}
+	return nil, false
+}
+
+// parallel_tool_calls 默认开启
+func parallelToolCalls(completion model.Completion) bool {
+	return completion.ParallelToolCalls == nil || *completion.ParallelToolCalls
 }
 
 // 解析任务
@@ -609,6 +812,29 @@ func toolCallResponse(ctx *gin.Context, completion model.Completion, name string
 	}
 }
 
+func toolCallsResponse(ctx *gin.Context, completion model.Completion, calls []response.ToolCall, created int64) bool {
+	if completion.Stream {
+		response.SSEToolCallsResponse(ctx, completion.Model, calls, created)
+		return true
+	} else {
+		response.ToolCallsResponse(ctx, completion.Model, calls)
+		return true
+	}
+}
+
+// 获取默认的toolId，tool_choice 指定了工具时优先使用
+func toolDef(ctx *gin.Context, completion model.Completion) string {
+	if mode, name := toolChoiceMode(completion); mode == "function" {
+		return toolIdWithTools(name, completion.Tools)
+	}
+	return getToolId(ctx, completion.Tools)
+}
+
+func toolRequired(completion model.Completion) bool {
+	mode, _ := toolChoiceMode(completion)
+	return mode != "auto"
+}
+
 // 获取默认的toolId
 func getToolId(ctx *gin.Context, tools []model.Keyv[interface{}]) (value string) {
 	value = common.GetGinToolValue(ctx).GetString("id")
@@ -714,7 +940,7 @@ func nameWithToolsNotArgs(task model.Keyv[string], tools []model.Keyv[interface{
 
 func tasksIsEnabled(ctx *gin.Context) bool {
 	completion := common.GetGinCompletion(ctx)
-	if completion.ToolChoice != "" && completion.ToolChoice != "auto" {
+	if mode, _ := toolChoiceMode(completion); mode != "auto" {
 		return false
 	}
 
@@ -0,0 +1,291 @@
+package toolcall
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/model"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+	"github.com/spf13/viper"
+)
+
+func TestParseToolCall(t *testing.T) {
+	tools := []model.Keyv[interface{}]{
+		{
+			"type": "function",
+			"function": map[string]interface{}{
+				"id":   "t1",
+				"name": "search",
+				"parameters": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"q":     map[string]interface{}{"type": "string"},
+						"limit": map[string]interface{}{"type": "integer"},
+					},
+					"required": []interface{}{"q"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		j     string
+		tool  string
+		args  string
+		valid bool
+	}{
+		{"valid", `{"toolId": "t1", "arguments": {"q": "go", "limit": 3}}`, "search", `{"limit":3,"q":"go"}`, true},
+		{"repaired and coerced", `{toolId: "t1", arguments: {q: "go", limit: "3",},}`, "search", `{"limit":3,"q":"go"}`, true},
+		{"truncated", `{"toolId": "t1", "arguments": {"q": "go`, "search", `{"q":"go"}`, true},
+		{"parameters key", `{"name": "search", "parameters": {"q": "go"}}`, "search", `{"q":"go"}`, true},
+		{"missing required", `{"toolId": "t1", "arguments": {"limit": 3}}`, "search", `{"limit":3}`, false},
+		{"unknown tool", `{"toolId": "t9"}`, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, args, err := parseToolCall(tt.j, tools)
+			if name != tt.tool || args != tt.args || (err == nil) != tt.valid {
+				t.Errorf("parseToolCall(%s) = %q, %q, %v; want %q, %q, valid %v", tt.j, name, args, err, tt.tool, tt.args, tt.valid)
+			}
+		})
+	}
+}
+
+func TestParseToolCallName(t *testing.T) {
+	tools := []model.Keyv[interface{}]{
+		{"type": "function", "function": map[string]interface{}{"id": "a1", "name": "search"}},
+		{"type": "function", "function": map[string]interface{}{"id": "b2", "name": "search_web"}},
+		{"type": "function", "function": map[string]interface{}{"name": "weather"}},
+	}
+
+	tests := []struct {
+		name string
+		j    string
+		want string
+	}{
+		{"exact name", `{"name": "search_web", "arguments": {}}`, "search_web"},
+		{"exact name after a similar one", `{"name": "search", "arguments": {"q": "search_web"}}`, "search"},
+		{"exact id", `{"toolId": "b2", "arguments": {}}`, "search_web"},
+		{"id before name", `{"toolId": "a1", "arguments": {"name": "weather"}}`, "search"},
+		{"tool without id", `{"toolId": "weather", "arguments": {}}`, "weather"},
+		{"single loose match", `{"tool": "weather", "arguments": {}}`, "weather"},
+		{"ambiguous loose match", `{"tool": "search_web", "arguments": {}}`, ""},
+		{"no match", `{"toolId": "c3", "arguments": {}}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name, _, _ := parseToolCall(tt.j, tools); name != tt.want {
+				t.Errorf("parseToolCall(%s) name = %q, want %q", tt.j, name, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractToolCalls(t *testing.T) {
+	tools := []model.Keyv[interface{}]{
+		{"type": "function", "function": map[string]interface{}{"id": "t1", "name": "search"}},
+		{"type": "function", "function": map[string]interface{}{"id": "t2", "name": "weather"}},
+		{"type": "function", "function": map[string]interface{}{"id": "t3", "name": "calendar"}},
+	}
+	disabled := false
+
+	tests := []struct {
+		name     string
+		content  string
+		parallel *bool
+		excluded []string
+		calls    []string
+	}{
+		{"single object", `1: {"toolId": "t1", "arguments": {"q": "go"}}`, nil, nil, []string{`search {"q":"go"}`}},
+		{"array", `[{"toolId": "t1", "arguments": {"q": "go"}}, {"toolId": "t2", "arguments": {}}]`, nil, nil, []string{`search {"q":"go"}`, "weather {}"}},
+		{"repaired array", `TOOL_RESPONSE 1: [{toolId: "t2", arguments: {}}, {toolId: "t3", arguments: {},},]`, nil, nil, []string{"weather {}", "calendar {}"}},
+		{"parallel disabled", `[{"toolId": "t1", "arguments": {"q": "go"}}, {"toolId": "t2", "arguments": {}}]`, &disabled, nil, []string{`search {"q":"go"}`}},
+		{"skip unknown tools", `[{"toolId": "t9", "arguments": {}}, {"toolId": "t2", "arguments": {}}]`, nil, nil, []string{"weather {}"}},
+		{"skip called tools", `[{"toolId": "t1", "arguments": {"q": "go"}}, {"toolId": "t2", "arguments": {}}]`, nil, []string{"search"}, []string{"weather {}"}},
+		{"no json", "no tool needed", nil, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completion := model.Completion{Tools: tools, ParallelToolCalls: tt.parallel}
+			ctx, _ := newToolContext(t, completion, true)
+			if tt.excluded != nil {
+				ctx.Set(exclude_tool_names, tt.excluded)
+			}
+
+			result, _ := extractToolCalls(ctx, tt.content, completion)
+			var calls []string
+			for _, call := range result {
+				calls = append(calls, call.Name+" "+call.Arguments)
+			}
+			if !reflect.DeepEqual(calls, tt.calls) {
+				t.Errorf("calls = %q, want %q", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestToolChoiceMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		choice interface{}
+		mode   string
+		tool   string
+	}{
+		{"default", nil, "auto", ""},
+		{"auto", "auto", "auto", ""},
+		{"none", "none", "none", ""},
+		{"required", "required", "required", ""},
+		{"function", map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "search"}}, "function", "search"},
+		{"function without name", map[string]interface{}{"type": "function", "function": map[string]interface{}{}}, "auto", ""},
+		{"unknown", "any", "auto", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if mode, tool := toolChoiceMode(model.Completion{ToolChoice: tt.choice}); mode != tt.mode || tool != tt.tool {
+				t.Errorf("toolChoiceMode(%v) = %s, %s; want %s, %s", tt.choice, mode, tool, tt.mode, tt.tool)
+			}
+		})
+	}
+}
+
+func newToolContext(t *testing.T, completion model.Completion, enabled bool) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	old := env.Env
+	env.Env = &env.Environment{Viper: viper.New()}
+	t.Cleanup(func() { env.Env = old })
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Set(vars.GinCompletion, completion)
+	ctx.Set(vars.GinTool, model.Keyv[interface{}]{"id": "-1", "enabled": enabled, "tasks": false})
+	return ctx, w
+}
+
+func TestNeedExec(t *testing.T) {
+	tools := []model.Keyv[interface{}]{{"type": "function", "function": map[string]interface{}{"name": "search"}}}
+	messages := []model.Keyv[interface{}]{{"role": "user", "content": "hi"}}
+	forced := map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "search"}}
+
+	tests := []struct {
+		name    string
+		choice  interface{}
+		tools   []model.Keyv[interface{}]
+		enabled bool
+		want    bool
+	}{
+		{"enabled", nil, tools, true, true},
+		{"disabled", nil, tools, false, false},
+		{"no tools", "required", nil, true, false},
+		{"none", "none", tools, true, false},
+		{"required while disabled", "required", tools, false, true},
+		{"function while disabled", forced, tools, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := newToolContext(t, model.Completion{Messages: messages, Tools: tt.tools, ToolChoice: tt.choice}, tt.enabled)
+			if got := NeedExec(ctx); got != tt.want {
+				t.Errorf("NeedExec = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolChoice(t *testing.T) {
+	tools := []model.Keyv[interface{}]{
+		{"type": "function", "function": map[string]interface{}{
+			"id": "t1", "name": "search", "description": "search the web",
+			"parameters": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"q": map[string]interface{}{"type": "string"}},
+				"required":   []interface{}{"q"},
+			},
+		}},
+		{"type": "function", "function": map[string]interface{}{"id": "t2", "name": "weather", "description": "get the weather"}},
+	}
+	function := func(name string) interface{} {
+		return map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": name}}
+	}
+
+	tests := []struct {
+		name    string
+		choice  interface{}
+		outputs []string
+		calls   int
+		tools   []string // 返回的工具调用
+		err     string
+		hidden  string // 提示词中不应出现的工具
+	}{
+		{"auto without a call", nil, []string{"no tool needed"}, 1, nil, "", ""},
+		{"parallel calls", nil, []string{`1: [{"toolId": "t1", "arguments": {"q": "go"}}, {"toolId": "t2", "arguments": {}}]`}, 1, []string{"search", "weather"}, "", ""},
+		{"required", "required", []string{"let me think", `1: {"toolId": "t2", "arguments": {}}`}, 2, []string{"weather"}, "", ""},
+		{"required never called", "required", []string{"a", "b", "c"}, 3, nil, "did not call any tool", ""},
+		{"forced function", function("search"), []string{`1: {"toolId": "t1", "arguments": {"q": "go"}}`}, 1, []string{"search"}, "", "get the weather"},
+		{"forced default arguments", function("weather"), []string{"a", "b", "c"}, 3, []string{"weather"}, "", "search the web"},
+		{"forced invalid default arguments", function("search"), []string{"a", "b", "c"}, 3, nil, "default arguments are invalid", ""},
+		{"forced unknown function", function("calendar"), nil, 0, nil, "not found in tools", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completion := model.Completion{
+				Model:      "test",
+				Messages:   []model.Keyv[interface{}]{{"role": "user", "content": "search go"}},
+				Tools:      tools,
+				ToolChoice: tt.choice,
+			}
+			ctx, w := newToolContext(t, completion, true)
+
+			var prompts []string
+			ok, err := ToolChoice(ctx, completion, func(message string) (string, error) {
+				prompts = append(prompts, message)
+				return tt.outputs[len(prompts)-1], nil
+			})
+
+			if len(prompts) != tt.calls {
+				t.Errorf("callback called %d times, want %d", len(prompts), tt.calls)
+			}
+			if tt.hidden != "" && len(prompts) > 0 && strings.Contains(prompts[0], tt.hidden) {
+				t.Errorf("the prompt should only contain the forced tool:\n%s", prompts[0])
+			}
+			if tt.choice == nil && (!strings.Contains(prompts[0], "search the web") || !strings.Contains(prompts[0], "get the weather")) {
+				t.Errorf("the prompt should contain every tool:\n%s", prompts[0])
+			}
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("ToolChoice error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || ok != (tt.tools != nil) {
+				t.Fatalf("ToolChoice = %v, %v", ok, err)
+			}
+			if !ok {
+				return
+			}
+
+			var resp model.Response
+			if err = json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid response %s: %v", w.Body, err)
+			}
+			var names []string
+			for _, call := range resp.Choices[0].Message.ToolCalls {
+				names = append(names, call.GetKeyv("function").GetString("name"))
+			}
+			if !reflect.DeepEqual(names, tt.tools) || *resp.Choices[0].FinishReason != "tool_calls" {
+				t.Errorf("tool calls = %v, want %v: %s", names, tt.tools, w.Body)
+			}
+		})
+	}
+}
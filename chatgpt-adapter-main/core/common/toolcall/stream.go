@@ -0,0 +1,335 @@
+package toolcall
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/jsonschema"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+)
+
+const tool_streamer = "__tool-streamer__"
+
+// Stream 返回适配器等待工具调用输出时使用的取消函数，与 Cancel 相同，
+// 流式请求时还会将已解析出的工具名和参数增量输出
+func Stream(ctx *gin.Context) func(str string) bool {
+	return func(str string) bool {
+		if s, ok := common.GetGinValue[*streamer](ctx, tool_streamer); ok && s != nil {
+			s.write(str)
+		}
+		return Cancel(str)
+	}
+}
+
+// 工具调用的增量输出，参数在 finish 中修复和校验
+type streamer struct {
+	ctx        *gin.Context
+	completion model.Completion
+	created    int64
+	excludes   []string
+
+	items []*streamItem // 与模型输出的工具调用一一对应
+	count int           // 已输出的工具调用数
+}
+
+type streamItem struct {
+	name   string
+	index  int    // 输出的索引，-1 为跳过
+	args   string // 已输出的参数
+	closed bool   // 参数已完整输出
+}
+
+// 模型输出中的单个工具调用，可能不完整
+type partialCall struct {
+	id     string
+	args   string
+	object bool // 参数为 JSON 对象，可以增量输出
+	closed bool
+}
+
+func newStreamer(ctx *gin.Context, completion model.Completion) *streamer {
+	excludes, _ := common.GetGinValues[string](ctx, exclude_tool_names)
+	if mode, _ := toolChoiceMode(completion); mode != "auto" {
+		excludes = nil
+	}
+	return &streamer{
+		ctx:        ctx,
+		completion: completion,
+		created:    time.Now().Unix(),
+		excludes:   excludes,
+	}
+}
+
+// 非流式请求返回 nil
+func armStreamer(ctx *gin.Context, completion model.Completion) (s *streamer) {
+	if completion.Stream {
+		s = newStreamer(ctx, completion)
+	}
+	ctx.Set(tool_streamer, s)
+	return
+}
+
+func (s *streamer) started() bool {
+	return s != nil && s.count > 0
+}
+
+func (s *streamer) write(content string) {
+	calls := scanToolCalls(content)
+	for i, call := range calls {
+		if i >= len(s.items) {
+			// 等待工具名
+			if call.id == "" {
+				return
+			}
+
+			item := &streamItem{name: Query(call.id, s.completion.Tools), index: -1}
+			s.items = append(s.items, item)
+			if item.name == "-1" || slices.Contains(s.excludes, item.name) ||
+				(s.count > 0 && !parallelToolCalls(s.completion)) {
+				continue
+			}
+
+			item.index = s.count
+			s.count++
+			response.SSEToolCallDelta(s.ctx, s.completion.Model, item.index, item.name, "", s.created)
+		}
+
+		item := s.items[i]
+		if item.index < 0 || !call.object {
+			continue
+		}
+
+		if len(call.args) > len(item.args) {
+			response.SSEToolCallDelta(s.ctx, s.completion.Model, item.index, "", call.args[len(item.args):], s.created)
+			item.args = call.args
+		}
+		item.closed = call.closed
+	}
+}
+
+// 补全未输出完整的参数以及未能增量输出的工具调用，并输出结束块。
+// calls 为修复、类型转换和校验后的结果，已输出的参数与之不一致或校验失败时输出异常事件
+func (s *streamer) finish(calls []response.ToolCall, errs []string) {
+	used := make([]bool, len(calls))
+	final := func(name string) *response.ToolCall {
+		for i := range calls {
+			if !used[i] && calls[i].Name == name {
+				used[i] = true
+				return &calls[i]
+			}
+		}
+		return nil
+	}
+
+	var mismatched []string
+	for _, item := range s.items {
+		if item.index < 0 {
+			continue
+		}
+
+		call := final(item.name)
+		if item.args == "" {
+			args := "{}"
+			if call != nil {
+				args = call.Arguments
+			}
+			response.SSEToolCallDelta(s.ctx, s.completion.Model, item.index, "", args, s.created)
+			continue
+		}
+
+		streamed := item.args
+		if !item.closed {
+			// 输出被截断，补全剩余的括号
+			_, raw, err := jsonschema.Extract(item.args)
+			if err == nil && strings.HasPrefix(raw, item.args) {
+				if suffix := raw[len(item.args):]; suffix != "" {
+					response.SSEToolCallDelta(s.ctx, s.completion.Model, item.index, "", suffix, s.created)
+				}
+				streamed = raw
+			}
+		}
+
+		// 已输出的参数无法撤回，修复或类型转换改变了参数时只能报告异常
+		if call == nil || !sameJSON(streamed, call.Arguments) {
+			mismatched = append(mismatched, item.name)
+		}
+	}
+
+	for i, call := range calls {
+		if used[i] || !parallelToolCalls(s.completion) {
+			continue
+		}
+		response.SSEToolCallDelta(s.ctx, s.completion.Model, s.count, call.Name, "", s.created)
+		response.SSEToolCallDelta(s.ctx, s.completion.Model, s.count, "", call.Arguments, s.created)
+		s.count++
+	}
+
+	if len(errs) > 0 || len(mismatched) > 0 {
+		message := "the streamed tool call arguments are invalid"
+		if len(mismatched) > 0 {
+			message += fmt.Sprintf(", repaired arguments of %v differ from the streamed ones", mismatched)
+		}
+		if len(errs) > 0 {
+			message += ": " + strings.Join(errs, "; ")
+		}
+		logger.Warn(message)
+		s.fail(errors.New(message))
+		return
+	}
+	response.SSEToolCallsDone(s.ctx, s.completion.Model, s.created)
+}
+
+// 已经开始输出后出错，异常作为事件输出，不再输出结束块
+func (s *streamer) fail(err error) {
+	response.Event(s.ctx, "", map[string]interface{}{
+		"error": map[string]interface{}{"message": err.Error()},
+	})
+}
+
+// 两段 JSON 是否等价，忽略空白和键的顺序
+func sameJSON(a, b string) bool {
+	var x, y interface{}
+	if json.Unmarshal([]byte(a), &x) != nil || json.Unmarshal([]byte(b), &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// 扫描模型已输出的内容，解析出 1: {...} 或 1: [{...}, ...] 中的工具调用
+func scanToolCalls(content string) (calls []partialCall) {
+	start := strings.IndexAny(content, "{[")
+	if start < 0 {
+		return
+	}
+
+	if prefix := strings.TrimSpace(content[:start]); prefix != "" && !strings.HasSuffix(prefix, "1:") {
+		return
+	}
+
+	array := content[start] == '['
+	for i := start; i < len(content); {
+		pos := strings.IndexAny(content[i:], "{]")
+		if pos < 0 || content[i+pos] == ']' {
+			return
+		}
+
+		call, end := scanToolCall(content, i+pos)
+		calls = append(calls, call)
+		if end < 0 || !array {
+			return
+		}
+		i = end
+	}
+	return
+}
+
+// 解析 start 处开始的工具调用对象，end 为对象结束后的位置，对象不完整时为 -1
+func scanToolCall(content string, start int) (call partialCall, end int) {
+	var (
+		depth     = 0
+		key       = ""
+		expectKey = false
+		argsStart = -1
+		argsEnd   = -1
+	)
+
+	for i := start; i < len(content); i++ {
+		ch := content[i]
+		switch ch {
+		case '"':
+			value, next, ok := readString(content, i)
+			if !ok {
+				i = len(content)
+				continue
+			}
+			if depth == 1 {
+				if expectKey {
+					key, expectKey = value, false
+				} else if (key == "toolId" || key == "name") && call.id == "" {
+					call.id = value
+				}
+			}
+			i = next - 1
+
+		case '{', '[':
+			depth++
+			if depth == 1 {
+				expectKey = true
+			}
+
+		case '}', ']':
+			if depth == 1 && argsStart >= 0 && argsEnd < 0 {
+				argsEnd = i
+			}
+			depth--
+			if depth == 1 && call.object && argsEnd < 0 {
+				argsEnd = i + 1
+			}
+			if depth == 0 {
+				call.closed = argsStart < 0 || argsEnd >= 0
+				call.args = args(content, argsStart, argsEnd)
+				return call, i + 1
+			}
+
+		case ',':
+			if depth == 1 {
+				if argsStart >= 0 && argsEnd < 0 {
+					argsEnd = i
+				}
+				expectKey = true
+			}
+
+		case ':':
+			if depth == 1 && (key == "arguments" || key == "parameters") && argsStart < 0 {
+				argsStart = i + 1
+				for argsStart < len(content) && strings.ContainsRune(" \t\r\n", rune(content[argsStart])) {
+					argsStart++
+				}
+				call.object = argsStart < len(content) && content[argsStart] == '{'
+			}
+		}
+	}
+
+	call.closed = argsEnd >= 0
+	call.args = args(content, argsStart, argsEnd)
+	return call, -1
+}
+
+func args(content string, start, end int) string {
+	if start < 0 || start >= len(content) {
+		return ""
+	}
+	if end < 0 {
+		return content[start:]
+	}
+	return strings.TrimSpace(content[start:end])
+}
+
+// 读取 start 处的 JSON 字符串，ok 为 false 时字符串不完整
+func readString(content string, start int) (value string, next int, ok bool) {
+	escape := false
+	for i := start + 1; i < len(content); i++ {
+		ch := content[i]
+		if escape {
+			escape = false
+			continue
+		}
+		if ch == '\\' {
+			escape = true
+			continue
+		}
+		if ch == '"' {
+			return content[start+1 : i], i + 1, true
+		}
+	}
+	return
+}
@@ -0,0 +1,226 @@
+package toolcall
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"chatgpt-adapter/core/gin/model"
+	"github.com/gin-gonic/gin"
+)
+
+func TestScanToolCalls(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []partialCall
+	}{
+		{"no json", "I will search it", nil},
+		{"other prefix", "result: {\"name\": \"a\"}", nil},
+		{
+			"object",
+			`1: {"toolId": "t1", "arguments": {"q": "go"}}`,
+			[]partialCall{{id: "t1", args: `{"q": "go"}`, object: true, closed: true}},
+		},
+		{
+			"object without prefix",
+			`{"name": "search", "arguments": {"q": "go"}}`,
+			[]partialCall{{id: "search", args: `{"q": "go"}`, object: true, closed: true}},
+		},
+		{
+			"array",
+			`1: [{"toolId": "t1", "arguments": {"q": "a"}}, {"toolId": "t2", "arguments": {"q": "b"}}]`,
+			[]partialCall{
+				{id: "t1", args: `{"q": "a"}`, object: true, closed: true},
+				{id: "t2", args: `{"q": "b"}`, object: true, closed: true},
+			},
+		},
+		{
+			"array with a truncated item",
+			`1: [{"toolId": "t1", "arguments": {}}, {"toolId": "t2", "arguments": {"q": "b`,
+			[]partialCall{
+				{id: "t1", args: `{}`, object: true, closed: true},
+				{id: "t2", args: `{"q": "b`, object: true},
+			},
+		},
+		{
+			"truncated arguments",
+			`1: {"toolId": "t1", "arguments": {"q": [1, 2`,
+			[]partialCall{{id: "t1", args: `{"q": [1, 2`, object: true}},
+		},
+		{
+			"arguments closed before the call",
+			`1: {"toolId": "t1", "arguments": {"q": 1}`,
+			[]partialCall{{id: "t1", args: `{"q": 1}`, object: true, closed: true}},
+		},
+		{
+			"braces and quotes in strings",
+			`1: {"toolId": "t1", "arguments": {"q": "} \"{"}}`,
+			[]partialCall{{id: "t1", args: `{"q": "} \"{"}`, object: true, closed: true}},
+		},
+		{
+			"string arguments",
+			`1: {"toolId": "t1", "arguments": "{\"q\": 1}"}`,
+			[]partialCall{{id: "t1", args: `"{\"q\": 1}"`, closed: true}},
+		},
+		{
+			"parameters key",
+			`1: {"name": "search", "parameters": {"q": "go"}}`,
+			[]partialCall{{id: "search", args: `{"q": "go"}`, object: true, closed: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scanToolCalls(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scanToolCalls(%q) =\n%+v\nwant\n%+v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+// 工具调用的 SSE 输出：每个工具调用的名称、拼接后的参数，以及结束块或异常
+type streamed struct {
+	names  []string
+	args   []string
+	done   bool
+	failed string
+}
+
+func parseStreamed(t *testing.T, body string) (result streamed) {
+	t.Helper()
+	for _, line := range strings.Split(body, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			continue
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					ToolCalls []struct {
+						Index    int `json:"index"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %s: %v", data, err)
+		}
+		if chunk.Error != nil {
+			result.failed = chunk.Error.Message
+			continue
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil {
+				result.done = true
+			}
+			for _, call := range choice.Delta.ToolCalls {
+				if call.Function.Name != "" {
+					result.names = append(result.names, call.Function.Name)
+					result.args = append(result.args, "")
+				}
+				result.args[call.Index] += call.Function.Arguments
+			}
+		}
+	}
+	return
+}
+
+func TestStreamer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tools := []model.Keyv[interface{}]{
+		{"type": "function", "function": map[string]interface{}{
+			"id": "t1", "name": "search",
+			"parameters": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"q": map[string]interface{}{"type": "string"}, "n": map[string]interface{}{"type": "integer"}},
+				"required":   []interface{}{"q"},
+			},
+		}},
+		{"type": "function", "function": map[string]interface{}{"id": "t2", "name": "weather"}},
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    streamed
+		deltas  int // 结束前已输出的参数增量块数量的下限
+	}{
+		{
+			"object",
+			`1: {"toolId": "t1", "arguments": {"q": "golang", "n": 3}}`,
+			streamed{names: []string{"search"}, args: []string{`{"q": "golang", "n": 3}`}, done: true},
+			3,
+		},
+		{
+			"parallel calls",
+			`1: [{"toolId": "t1", "arguments": {"q": "go"}}, {"toolId": "t2", "arguments": {"city": "Paris"}}]`,
+			streamed{names: []string{"search", "weather"}, args: []string{`{"q": "go"}`, `{"city": "Paris"}`}, done: true},
+			2,
+		},
+		{
+			"truncated",
+			`1: {"toolId": "t1", "arguments": {"q": "go`,
+			streamed{names: []string{"search"}, args: []string{`{"q": "go"}`}, done: true},
+			1,
+		},
+		{
+			"repaired arguments differ",
+			`1: {"toolId": "t1", "arguments": {"q": "go", "n": "3"}}`,
+			streamed{names: []string{"search"}, args: []string{`{"q": "go", "n": "3"}`}, failed: "differ"},
+			1,
+		},
+		{
+			"invalid arguments",
+			`1: {"toolId": "t1", "arguments": {"n": 3}}`,
+			streamed{names: []string{"search"}, args: []string{`{"n": 3}`}, failed: "missing required"},
+			1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			completion := model.Completion{Model: "test", Stream: true, Tools: tools}
+			s := newStreamer(ctx, completion)
+
+			// 逐字输出，参数应在生成过程中增量输出
+			for i := 1; i <= len(tt.content); i++ {
+				s.write(tt.content[:i])
+			}
+			before := parseStreamed(t, w.Body.String())
+			if len(before.names) == 0 || before.done {
+				t.Fatalf("nothing streamed before finish: %+v", before)
+			}
+			if chunks := strings.Count(w.Body.String(), `"arguments":"`) - strings.Count(w.Body.String(), `"arguments":""`); chunks < tt.deltas {
+				t.Errorf("streamed %d argument deltas before finish, want at least %d", chunks, tt.deltas)
+			}
+
+			calls, errs := extractToolCalls(ctx, tt.content, completion)
+			s.finish(calls, errs)
+
+			got := parseStreamed(t, w.Body.String())
+			if !reflect.DeepEqual(got.names, tt.want.names) || !reflect.DeepEqual(got.args, tt.want.args) || got.done != tt.want.done {
+				t.Errorf("streamed %+v, want %+v", got, tt.want)
+			}
+			if (got.failed == "") != (tt.want.failed == "") || !strings.Contains(got.failed, tt.want.failed) {
+				t.Errorf("error event %q, want %q", got.failed, tt.want.failed)
+			}
+		})
+	}
+}
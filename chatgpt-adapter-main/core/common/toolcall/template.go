@@ -0,0 +1,147 @@
+package toolcall
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"chatgpt-adapter/core/common/agent"
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/logger"
+	"github.com/iocgo/sdk/env"
+)
+
+// 工具提示词模版，按模型匹配，call、tasks 为模版文件路径，为空时使用 lang 对应的内置模版
+type Template struct {
+	Name   string   `mapstructure:"name" json:"name"`
+	Lang   string   `mapstructure:"lang" json:"lang"`
+	Models []string `mapstructure:"models" json:"models,omitempty"`
+	Call   string   `mapstructure:"call" json:"call,omitempty"`
+	Tasks  string   `mapstructure:"tasks" json:"tasks,omitempty"`
+
+	regexps []*regexp.Regexp
+	call    string
+	tasks   string
+}
+
+type prompts struct {
+	call     string
+	tasks    string
+	retry    string
+	required string
+}
+
+var (
+	// 内置模版
+	builtinPrompts = map[string]prompts{
+		"zh": {
+			call:     agent.ToolCall,
+			tasks:    agent.ToolTasks,
+			retry:    "USER: 工具参数校验失败：%s。请根据工具的参数定义修正后重新输出工具调用。 <|end|>\nANSWER: ",
+			required: "USER: 本次必须使用工具，请直接输出工具调用。 <|end|>\nANSWER: ",
+		},
+		"en": {
+			call:     agent.ToolCallEn,
+			tasks:    agent.ToolTasksEn,
+			retry:    "USER: The tool arguments are invalid: %s. Fix them according to the tool parameters and output the tool call again. <|end|>\nANSWER: ",
+			required: "USER: You must use a tool this time, output the tool call directly. <|end|>\nANSWER: ",
+		},
+	}
+
+	templates   []*Template
+	defaultLang = "zh"
+)
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		if lang := env.GetString("server.tool-lang"); lang != "" {
+			if _, ok := builtinPrompts[lang]; !ok {
+				logger.Fatalf("unsupported tool prompt language: server.tool-lang = %s", lang)
+			}
+			defaultLang = lang
+		}
+
+		var objs []*Template
+		if err := env.UnmarshalKey("tool-templates", &objs); err != nil {
+			logger.Fatal(err)
+		}
+		for i, obj := range objs {
+			if err := obj.load(); err != nil {
+				logger.Fatalf("failed to load tool-templates[%d]: %v", i, err)
+			}
+		}
+		templates = objs
+	})
+}
+
+func (t *Template) load() (err error) {
+	if t.Lang == "" {
+		t.Lang = defaultLang
+	}
+
+	builtin, ok := builtinPrompts[t.Lang]
+	if !ok {
+		return fmt.Errorf("unsupported tool prompt language: lang = %s", t.Lang)
+	}
+	t.call, t.tasks = builtin.call, builtin.tasks
+
+	for _, pattern := range t.Models {
+		compile, e := regexp.Compile(pattern)
+		if e != nil {
+			return e
+		}
+		t.regexps = append(t.regexps, compile)
+	}
+
+	if t.Call != "" {
+		bytes, e := os.ReadFile(t.Call)
+		if e != nil {
+			return e
+		}
+		t.call = string(bytes)
+	}
+
+	if t.Tasks != "" {
+		bytes, e := os.ReadFile(t.Tasks)
+		if e != nil {
+			return e
+		}
+		t.tasks = string(bytes)
+	}
+	return
+}
+
+func (t *Template) match(mod string) bool {
+	// 未配置模型的作为默认模版
+	if len(t.regexps) == 0 {
+		return true
+	}
+
+	for _, compile := range t.regexps {
+		if compile.MatchString(mod) {
+			return true
+		}
+	}
+	return false
+}
+
+// 获取模型对应的模版，按配置顺序匹配，都不匹配时使用默认语言的内置模版
+func templateOf(completion model.Completion) *Template {
+	for _, t := range templates {
+		if t.match(completion.Model) {
+			return t
+		}
+	}
+
+	builtin := builtinPrompts[defaultLang]
+	return &Template{Name: "default", Lang: defaultLang, call: builtin.call, tasks: builtin.tasks}
+}
+
+// 模版语言对应的重试提示
+func promptsOf(completion model.Completion) prompts {
+	if builtin, ok := builtinPrompts[templateOf(completion).Lang]; ok {
+		return builtin
+	}
+	return builtinPrompts[defaultLang]
+}
@@ -0,0 +1,147 @@
+package toolcall
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"chatgpt-adapter/core/gin/model"
+)
+
+func TestTemplateLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "call.tmpl")
+	if err := os.WriteFile(file, []byte("custom {{.tools}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		template Template
+		lang     string
+		call     string
+		ok       bool
+	}{
+		{"default language", Template{Name: "a"}, defaultLang, builtinPrompts[defaultLang].call, true},
+		{"english", Template{Name: "a", Lang: "en"}, "en", builtinPrompts["en"].call, true},
+		{"custom file", Template{Name: "a", Lang: "en", Call: file}, "en", "custom {{.tools}}", true},
+		{"unknown language", Template{Name: "a", Lang: "fr"}, "", "", false},
+		{"missing file", Template{Name: "a", Call: file + ".missing"}, "", "", false},
+		{"invalid pattern", Template{Name: "a", Models: []string{"("}}, "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpl := tt.template
+			err := tpl.load()
+			if (err == nil) != tt.ok {
+				t.Fatalf("load = %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && (tpl.Lang != tt.lang || tpl.call != tt.call) {
+				t.Errorf("load = %s %q, want %s %q", tpl.Lang, tpl.call, tt.lang, tt.call)
+			}
+		})
+	}
+}
+
+func TestTemplateOf(t *testing.T) {
+	english := &Template{Name: "english", Lang: "en", Models: []string{"^gpt-", "^claude"}}
+	fallback := &Template{Name: "fallback", Lang: "zh"}
+	for _, tpl := range []*Template{english, fallback} {
+		if err := tpl.load(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		templates []*Template
+		model     string
+		want      string
+		retry     string
+	}{
+		{"first match", []*Template{english, fallback}, "claude-3", "english", builtinPrompts["en"].retry},
+		{"fallback template", []*Template{english, fallback}, "qwen", "fallback", builtinPrompts["zh"].retry},
+		{"builtin default", []*Template{english}, "qwen", "default", builtinPrompts[defaultLang].retry},
+	}
+
+	old := templates
+	t.Cleanup(func() { templates = old })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			templates = tt.templates
+			completion := model.Completion{Model: tt.model}
+			if got := templateOf(completion).Name; got != tt.want {
+				t.Errorf("templateOf(%s) = %s, want %s", tt.model, got, tt.want)
+			}
+			if got := promptsOf(completion).retry; got != tt.retry {
+				t.Errorf("promptsOf(%s).retry = %q, want %q", tt.model, got, tt.retry)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	custom := filepath.Join(t.TempDir(), "tasks.tmpl")
+	if err := os.WriteFile(custom, []byte("TASKS {{range $i, $t := .tools}}{{$t.function.name}} {{end}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	english := &Template{Name: "english", Lang: "en", Models: []string{"^gpt-"}, Tasks: custom}
+	if err := english.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	old := templates
+	templates = []*Template{english}
+	t.Cleanup(func() { templates = old })
+
+	tools := []model.Keyv[interface{}]{
+		{"type": "function", "function": map[string]interface{}{"name": "search", "description": "search the web"}},
+		{"type": "function", "function": map[string]interface{}{"name": "weather", "description": "get the weather"}},
+	}
+	forced := map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "weather"}}
+
+	tests := []struct {
+		name     string
+		model    string
+		choice   interface{}
+		tasks    bool
+		template string
+		contains []string
+		excludes []string
+	}{
+		{"call", "gpt-4o", nil, false, "english", []string{"search the web", "get the weather"}, nil},
+		{"tasks", "gpt-4o", nil, true, "english", []string{"TASKS search weather"}, nil},
+		{"forced function", "gpt-4o", forced, false, "english", []string{"get the weather"}, []string{"search the web"}},
+		{"default template", "qwen", nil, false, "default", []string{"search the web"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completion := model.Completion{
+				Model:      tt.model,
+				Messages:   []model.Keyv[interface{}]{{"role": "user", "content": "hi"}},
+				Tools:      tools,
+				ToolChoice: tt.choice,
+			}
+			ctx, _ := newToolContext(t, completion, true)
+			tpl, prompt, err := Render(ctx, completion, tt.tasks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tpl.Name != tt.template {
+				t.Errorf("template = %s, want %s", tpl.Name, tt.template)
+			}
+			for _, str := range tt.contains {
+				if !strings.Contains(prompt, str) {
+					t.Errorf("prompt does not contain %q:\n%s", str, prompt)
+				}
+			}
+			for _, str := range tt.excludes {
+				if strings.Contains(prompt, str) {
+					t.Errorf("prompt contains %q:\n%s", str, prompt)
+				}
+			}
+		})
+	}
+}
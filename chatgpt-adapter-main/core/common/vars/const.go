@@ -2,6 +2,7 @@ package vars
 
 var (
 	GinCompletion      = "__completion__"
+	GinTextCompletion  = "__text_completion__"
 	GinGeneration      = "__generation__"
 	GinEmbedding       = "__embedding__"
 	GinMatchers        = "__matchers__"
@@ -15,4 +16,9 @@ var (
 	GinCancelFunc      = "__cancelFunc__"
 	GinClaudeMessages  = "__claude_messages__"
 	GinThinkReason     = "__think_reason__"
+	GinCompletionId    = "__completion_id__"
+	GinFinishReason    = "__finish_reason__"
+	GinApiKey          = "__api_key__"
+	GinClaims          = "__claims__"
+	GinAccount         = "__account__"
 )
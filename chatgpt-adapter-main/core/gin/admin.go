@@ -0,0 +1,103 @@
+package gin
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"chatgpt-adapter/core/common/quota"
+	"chatgpt-adapter/core/common/ratelimit"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 管理接口需要使用 server.admin-key 访问，未配置时不开放
+func admin(gtx *gin.Context) bool {
+	key := env.Env.GetString("server.admin-key")
+	if key == "" {
+		response.Error(gtx, http.StatusForbidden, "the admin api is disabled, please configure 'server.admin-key'")
+		return false
+	}
+
+	if gtx.GetString("token") != key {
+		response.Error(gtx, http.StatusUnauthorized, "invalid admin key")
+		return false
+	}
+	return true
+}
+
+// @GET(path = "v1/admin/balancer")
+func (h *Handler) balancers(gtx *gin.Context) {
+	if !admin(gtx) {
+		return
+	}
+
+	aliases := make([]string, 0, len(routes))
+	for alias := range routes {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	data := make([]interface{}, 0, len(aliases))
+	for _, alias := range aliases {
+		data = append(data, routes[alias].snapshot())
+	}
+	gtx.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   data,
+	})
+}
+
+// @GET(path = "v1/admin/breaker")
+func (h *Handler) breakers(gtx *gin.Context) {
+	if !admin(gtx) {
+		return
+	}
+
+	gtx.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   circuitsSnapshot(),
+	})
+}
+
+// @GET(path = "v1/admin/ratelimit")
+func (h *Handler) rateLimiters(gtx *gin.Context) {
+	if !admin(gtx) {
+		return
+	}
+
+	gtx.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   rateSnapshot(ratelimit.Snapshot(gtx.Query("scope"))),
+	})
+}
+
+// 上游账号在当前周期的额度用量，?account= 按账号池或适配器名过滤
+//
+// @GET(path = "v1/admin/quota")
+func (h *Handler) quotas(gtx *gin.Context) {
+	if !admin(gtx) {
+		return
+	}
+
+	prefix := gtx.Query("account")
+	if prefix != "" && !strings.Contains(prefix, ":") {
+		prefix += ":"
+	}
+	gtx.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   quota.Snapshot(prefix),
+	})
+}
+
+// 与管理接口一样需要 server.admin-key，server.public-metrics 为 true 时公开
+//
+// @GET(path = "metrics")
+func (h *Handler) metrics(gtx *gin.Context) {
+	if !env.Env.GetBool("server.public-metrics") && !admin(gtx) {
+		return
+	}
+	promhttp.Handler().ServeHTTP(gtx.Writer, gtx.Request)
+}
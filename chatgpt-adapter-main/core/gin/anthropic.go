@@ -0,0 +1,463 @@
+package gin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// @POST(path = "
+//
+//	v1/messages,
+//	proxies/v1/messages
+//
+// ")
+func (h *Handler) messages(gtx *gin.Context) {
+	conv := &anthropicConverter{gtx: gtx, id: "msg_" + common.Hex(24)}
+	withConverter(gtx, conv, func() {
+		var request model.AnthropicCompletion
+		if err := gtx.BindJSON(&request); err != nil {
+			logger.Error(err)
+			response.Error(gtx, http.StatusBadRequest, err)
+			return
+		}
+
+		conv.model = request.Model
+		h.relay(gtx, convertAnthropicRequest(request))
+	})
+}
+
+// 将 Anthropic Messages 请求转换为 model.Completion
+func convertAnthropicRequest(request model.AnthropicCompletion) (completion model.Completion) {
+	completion = model.Completion{
+		Model:         request.Model,
+		MaxTokens:     request.MaxTokens,
+		StopSequences: request.StopSequences,
+		Temperature:   request.Temperature,
+		TopK:          request.TopK,
+		TopP:          request.TopP,
+		Stream:        request.Stream,
+	}
+
+	switch system := request.System.(type) {
+	case string:
+		if system != "" {
+			completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+				"role": "system", "content": system,
+			})
+		}
+	case []interface{}:
+		if content := joinAnthropicText(system); content != "" {
+			completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+				"role": "system", "content": content,
+			})
+		}
+	}
+
+	// tool_use_id => name
+	toolNames := make(map[string]string)
+	for _, message := range request.Messages {
+		role := message.GetString("role")
+		if message.IsString("content") {
+			completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+				"role": role, "content": message.GetString("content"),
+			})
+			continue
+		}
+
+		var (
+			texts     []string
+			contents  []interface{}
+			toolCalls []interface{}
+			hasImage  = false
+		)
+
+		for _, item := range message.GetSlice("content") {
+			var block model.Keyv[interface{}]
+			block, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			switch block.GetString("type") {
+			case "text":
+				texts = append(texts, block.GetString("text"))
+				contents = append(contents, map[string]interface{}{
+					"type": "text", "text": block.GetString("text"),
+				})
+
+			case "image":
+				source := block.GetKeyv("source")
+				url := source.GetString("url")
+				if source.Is("type", "base64") {
+					url = "data:" + source.GetString("media_type") + ";base64," + source.GetString("data")
+				}
+				hasImage = true
+				contents = append(contents, map[string]interface{}{
+					"type": "image_url", "image_url": map[string]interface{}{"url": url},
+				})
+
+			case "tool_use":
+				id := block.GetString("id")
+				name := block.GetString("name")
+				toolNames[id] = name
+				arguments, _ := json.Marshal(block["input"])
+				toolCalls = append(toolCalls, map[string]interface{}{
+					"id":   id,
+					"type": "function",
+					"function": map[string]interface{}{
+						"name":      name,
+						"arguments": string(arguments),
+					},
+				})
+
+			case "tool_result":
+				id := block.GetString("tool_use_id")
+				content := block.GetString("content")
+				if block.IsSlice("content") {
+					content = joinAnthropicText(block.GetSlice("content"))
+				}
+				completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+					"role":         "tool",
+					"tool_call_id": id,
+					"name":         toolNames[id],
+					"content":      content,
+				})
+			}
+		}
+
+		if len(toolCalls) > 0 {
+			completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+				"role":       "assistant",
+				"content":    strings.Join(texts, "\n"),
+				"tool_calls": toolCalls,
+			})
+			continue
+		}
+
+		if hasImage {
+			completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+				"role": role, "content": contents,
+			})
+			continue
+		}
+
+		if len(texts) > 0 {
+			completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+				"role": role, "content": strings.Join(texts, "\n"),
+			})
+		}
+	}
+
+	for _, tool := range request.Tools {
+		if !tool.Has("input_schema") {
+			continue
+		}
+		completion.Tools = append(completion.Tools, model.Keyv[interface{}]{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        tool.GetString("name"),
+				"description": tool.GetString("description"),
+				"parameters":  tool["input_schema"],
+			},
+		})
+	}
+
+	switch request.ToolChoice.GetString("type") {
+	case "auto":
+		completion.ToolChoice = "auto"
+	case "any":
+		completion.ToolChoice = "required"
+	case "none":
+		completion.ToolChoice = "none"
+	case "tool":
+		completion.ToolChoice = map[string]interface{}{
+			"type":     "function",
+			"function": map[string]interface{}{"name": request.ToolChoice.GetString("name")},
+		}
+	}
+
+	if request.ToolChoice.Is("disable_parallel_tool_use", true) {
+		parallel := false
+		completion.ParallelToolCalls = &parallel
+	}
+	return
+}
+
+func joinAnthropicText(blocks []interface{}) string {
+	var texts []string
+	for _, item := range blocks {
+		var block model.Keyv[interface{}]
+		block, ok := item.(map[string]interface{})
+		if ok && block.Is("type", "text") {
+			texts = append(texts, block.GetString("text"))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// OpenAI => Anthropic 响应转换
+type anthropicConverter struct {
+	gtx   *gin.Context
+	id    string
+	model string
+
+	started    bool
+	index      int    // 当前内容块下标
+	block      string // 当前内容块类型
+	output     string
+	stopReason string
+	usage      map[string]interface{}
+}
+
+func (*anthropicConverter) ContentType() string { return "text/event-stream" }
+
+func (c *anthropicConverter) Chunk(w io.Writer, chunk model.Response) {
+	c.messageStart(w)
+	if chunk.Usage != nil {
+		c.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			c.stopReason = anthropicStopReason(*choice.FinishReason)
+		}
+
+		delta := choice.Delta
+		if delta == nil {
+			continue
+		}
+
+		if delta.ReasoningContent != "" {
+			c.blockStart(w, "thinking", map[string]interface{}{"type": "thinking", "thinking": "", "signature": ""})
+			c.blockDelta(w, map[string]interface{}{"type": "thinking_delta", "thinking": delta.ReasoningContent})
+		}
+
+		if delta.Content != "" {
+			c.output += delta.Content
+			c.blockStart(w, "text", map[string]interface{}{"type": "text", "text": ""})
+			c.blockDelta(w, map[string]interface{}{"type": "text_delta", "text": delta.Content})
+		}
+
+		for _, toolCall := range delta.ToolCalls {
+			fn := toolCall.GetKeyv("function")
+			if toolCall.Has("id") {
+				c.blockStop(w)
+				c.blockStart(w, "tool_use", map[string]interface{}{
+					"type":  "tool_use",
+					"id":    toolCall.GetString("id"),
+					"name":  fn.GetString("name"),
+					"input": map[string]interface{}{},
+				})
+			}
+
+			if arguments := fn.GetString("arguments"); arguments != "" && c.block == "tool_use" {
+				c.blockDelta(w, map[string]interface{}{"type": "input_json_delta", "partial_json": arguments})
+			}
+		}
+	}
+}
+
+func (c *anthropicConverter) Done(w io.Writer) {
+	c.messageStart(w)
+	c.blockStop(w)
+
+	stopReason := c.stopReason
+	if stopReason == "" {
+		stopReason = "end_turn"
+	}
+
+	writeEvent(w, "message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": stopReason, "stop_sequence": nil},
+		"usage": map[string]interface{}{"output_tokens": c.outputTokens()},
+	})
+	writeEvent(w, "message_stop", map[string]interface{}{"type": "message_stop"})
+}
+
+func (c *anthropicConverter) Response(w io.Writer, resp model.Response) {
+	content := make([]model.Keyv[interface{}], 0)
+	stopReason := "end_turn"
+	choice := resp.Choices[0]
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		stopReason = anthropicStopReason(*choice.FinishReason)
+	}
+
+	if message := choice.Message; message != nil {
+		c.output = message.Content
+		if message.ReasoningContent != "" {
+			content = append(content, model.Keyv[interface{}]{
+				"type": "thinking", "thinking": message.ReasoningContent, "signature": "",
+			})
+		}
+
+		if message.Content != "" {
+			content = append(content, model.Keyv[interface{}]{
+				"type": "text", "text": message.Content,
+			})
+		}
+
+		for _, toolCall := range message.ToolCalls {
+			fn := toolCall.GetKeyv("function")
+			var input interface{} = map[string]interface{}{}
+			if arguments := fn.GetString("arguments"); arguments != "" {
+				if err := json.Unmarshal([]byte(arguments), &input); err != nil {
+					logger.Error(err)
+					input = map[string]interface{}{}
+				}
+			}
+
+			content = append(content, model.Keyv[interface{}]{
+				"type":  "tool_use",
+				"id":    toolCall.GetString("id"),
+				"name":  fn.GetString("name"),
+				"input": input,
+			})
+			stopReason = "tool_use"
+		}
+	}
+
+	c.usage = resp.Usage
+	writeJSON(w, model.AnthropicResponse{
+		Id:         c.id,
+		Type:       "message",
+		Role:       "assistant",
+		Model:      c.model,
+		Content:    content,
+		StopReason: &stopReason,
+		Usage: map[string]int{
+			"input_tokens":  c.inputTokens(),
+			"output_tokens": c.outputTokens(),
+		},
+	})
+}
+
+func (c *anthropicConverter) Error(w io.Writer, code int, message string, sse bool) {
+	data := map[string]interface{}{
+		"type": "error",
+		"error": map[string]interface{}{
+			"type":    anthropicErrorType(code),
+			"message": message,
+		},
+	}
+
+	if sse {
+		writeEvent(w, "error", data)
+		return
+	}
+	writeJSON(w, data)
+}
+
+func (c *anthropicConverter) messageStart(w io.Writer) {
+	if c.started {
+		return
+	}
+
+	c.started = true
+	writeEvent(w, "message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": model.AnthropicResponse{
+			Id:      c.id,
+			Type:    "message",
+			Role:    "assistant",
+			Model:   c.model,
+			Content: make([]model.Keyv[interface{}], 0),
+			Usage: map[string]int{
+				"input_tokens":  c.inputTokens(),
+				"output_tokens": 0,
+			},
+		},
+	})
+	writeEvent(w, "ping", map[string]interface{}{"type": "ping"})
+}
+
+// 内容块类型发生变化时结束上一个块，开始新的块
+func (c *anthropicConverter) blockStart(w io.Writer, block string, contentBlock map[string]interface{}) {
+	if c.block == block {
+		return
+	}
+
+	c.blockStop(w)
+	c.block = block
+	writeEvent(w, "content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         c.index,
+		"content_block": contentBlock,
+	})
+}
+
+func (c *anthropicConverter) blockDelta(w io.Writer, delta map[string]interface{}) {
+	writeEvent(w, "content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": c.index,
+		"delta": delta,
+	})
+}
+
+func (c *anthropicConverter) blockStop(w io.Writer) {
+	if c.block == "" {
+		return
+	}
+
+	writeEvent(w, "content_block_stop", map[string]interface{}{
+		"type":  "content_block_stop",
+		"index": c.index,
+	})
+	c.block = ""
+	c.index++
+}
+
+func (c *anthropicConverter) inputTokens() int {
+	if value, ok := c.usage["prompt_tokens"].(float64); ok && value > 0 {
+		return int(value)
+	}
+	return c.gtx.GetInt(ginTokens)
+}
+
+func (c *anthropicConverter) outputTokens() int {
+	if value, ok := c.usage["completion_tokens"].(float64); ok && value > 0 {
+		return int(value)
+	}
+	return response.CalcTokens(c.output)
+}
+
+func anthropicStopReason(finishReason string) string {
+	switch finishReason {
+	case "tool_calls":
+		return "tool_use"
+	case "length":
+		return "max_tokens"
+	default:
+		return "end_turn"
+	}
+}
+
+func anthropicErrorType(code int) string {
+	switch code {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case 529:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
@@ -0,0 +1,199 @@
+package gin
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConvertAnthropicRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  string
+		messages string
+		tools    string
+		choice   interface{}
+	}{
+		{
+			"system blocks",
+			`{"system": [{"type": "text", "text": "be brief"}, {"type": "text", "text": "be kind"}], "messages": [{"role": "user", "content": "hi"}]}`,
+			`[{"content":"be brief\nbe kind","role":"system"},{"content":"hi","role":"user"}]`,
+			`null`, nil,
+		},
+		{
+			"text blocks",
+			`{"system": "sys", "messages": [{"role": "user", "content": [{"type": "text", "text": "a"}, {"type": "text", "text": "b"}]}]}`,
+			`[{"content":"sys","role":"system"},{"content":"a\nb","role":"user"}]`,
+			`null`, nil,
+		},
+		{
+			"image",
+			`{"messages": [{"role": "user", "content": [{"type": "text", "text": "what"}, {"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "AAA"}}]}]}`,
+			`[{"content":[{"text":"what","type":"text"},{"image_url":{"url":"data:image/png;base64,AAA"},"type":"image_url"}],"role":"user"}]`,
+			`null`, nil,
+		},
+		{
+			"tool use and result",
+			`{"messages": [
+				{"role": "user", "content": "weather?"},
+				{"role": "assistant", "content": [{"type": "text", "text": "checking"}, {"type": "tool_use", "id": "tu_1", "name": "weather", "input": {"city": "Paris"}}]},
+				{"role": "user", "content": [{"type": "tool_result", "tool_use_id": "tu_1", "content": [{"type": "text", "text": "sunny"}]}]}
+			],
+			"tools": [{"name": "weather", "description": "get weather", "input_schema": {"type": "object"}}, {"type": "computer_20241022", "name": "computer"}],
+			"tool_choice": {"type": "any", "disable_parallel_tool_use": true}}`,
+			`[{"content":"weather?","role":"user"},` +
+				`{"content":"checking","role":"assistant","tool_calls":[{"function":{"arguments":"{\"city\":\"Paris\"}","name":"weather"},"id":"tu_1","type":"function"}]},` +
+				`{"content":"sunny","name":"weather","role":"tool","tool_call_id":"tu_1"}]`,
+			`[{"function":{"description":"get weather","name":"weather","parameters":{"type":"object"}},"type":"function"}]`,
+			"required",
+		},
+		{
+			"forced tool",
+			`{"messages": [{"role": "user", "content": "hi"}], "tool_choice": {"type": "tool", "name": "weather"}}`,
+			`[{"content":"hi","role":"user"}]`,
+			`null`,
+			map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "weather"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request model.AnthropicCompletion
+			if err := json.Unmarshal([]byte(tt.request), &request); err != nil {
+				t.Fatal(err)
+			}
+			completion := convertAnthropicRequest(request)
+
+			if messages, _ := json.Marshal(completion.Messages); string(messages) != tt.messages {
+				t.Errorf("messages =\n%s\nwant\n%s", messages, tt.messages)
+			}
+			if tools, _ := json.Marshal(completion.Tools); string(tools) != tt.tools {
+				t.Errorf("tools =\n%s\nwant\n%s", tools, tt.tools)
+			}
+			if !reflect.DeepEqual(completion.ToolChoice, tt.choice) {
+				t.Errorf("tool_choice = %v, want %v", completion.ToolChoice, tt.choice)
+			}
+		})
+	}
+
+	var request model.AnthropicCompletion
+	_ = json.Unmarshal([]byte(`{"messages": [], "tool_choice": {"type": "auto", "disable_parallel_tool_use": true}}`), &request)
+	if completion := convertAnthropicRequest(request); completion.ParallelToolCalls == nil || *completion.ParallelToolCalls {
+		t.Error("disable_parallel_tool_use should turn off parallel_tool_calls")
+	}
+}
+
+func TestAnthropicMessages(t *testing.T) {
+	withEnv(t, nil)
+	body := `{"model": "test", "max_tokens": 64, "messages": [{"role": "user", "content": "hi"}]}`
+
+	t.Run("text", func(t *testing.T) {
+		h := &Handler{extensions: []inter.Adapter{&fakeAdapter{models: []string{"test"}, completion: func(gtx *gin.Context) error {
+			response.ReasonResponse(gtx, "test", "hello", "thinking")
+			return nil
+		}}}}
+		gtx, w := newContext(http.MethodPost, "/v1/messages", body)
+		h.messages(gtx)
+
+		var resp model.AnthropicResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid response %s: %v", w.Body, err)
+		}
+		if !strings.HasPrefix(resp.Id, "msg_") || resp.Type != "message" || resp.Model != "test" || resp.StopReason == nil || *resp.StopReason != "end_turn" {
+			t.Errorf("response = %s", w.Body)
+		}
+		if len(resp.Content) != 2 || resp.Content[0].GetString("thinking") != "thinking" || resp.Content[1].GetString("text") != "hello" {
+			t.Errorf("content = %v", resp.Content)
+		}
+		if resp.Usage["output_tokens"] == 0 {
+			t.Errorf("usage = %v", resp.Usage)
+		}
+	})
+
+	t.Run("tool use", func(t *testing.T) {
+		h := &Handler{extensions: []inter.Adapter{&fakeAdapter{models: []string{"test"}, completion: func(gtx *gin.Context) error {
+			response.ToolCallResponse(gtx, "test", "weather", `{"city": "Paris"}`)
+			return nil
+		}}}}
+		gtx, w := newContext(http.MethodPost, "/v1/messages", body)
+		h.messages(gtx)
+
+		var resp model.AnthropicResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid response %s: %v", w.Body, err)
+		}
+		if len(resp.Content) != 1 || resp.Content[0].GetString("type") != "tool_use" || resp.Content[0].GetString("name") != "weather" ||
+			!reflect.DeepEqual(resp.Content[0]["input"], map[string]interface{}{"city": "Paris"}) || *resp.StopReason != "tool_use" {
+			t.Errorf("response = %s", w.Body)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		h := &Handler{extensions: []inter.Adapter{&fakeAdapter{models: []string{"test"}, completion: func(gtx *gin.Context) error {
+			created := time.Now().Unix()
+			response.ReasonSSEResponse(gtx, "test", "", "hmm", created)
+			response.SSEResponse(gtx, "test", "hello", created)
+			response.SSEToolCallsResponse(gtx, "test", []response.ToolCall{{Name: "weather", Arguments: `{"city": "Paris"}`}}, created)
+			return nil
+		}}}}
+		gtx, w := newContext(http.MethodPost, "/v1/messages", strings.Replace(body, `"max_tokens"`, `"stream": true, "max_tokens"`, 1))
+		h.messages(gtx)
+
+		events := parseEvents(w.Body.String())
+		if len(events) < 2 || events[0].name != "message_start" || events[len(events)-1].name != "message_stop" {
+			t.Fatalf("events = %s", w.Body)
+		}
+
+		var names []string
+		var partial, stop string
+		for _, e := range events {
+			var data model.Keyv[interface{}]
+			if err := json.Unmarshal([]byte(e.data), &data); err != nil {
+				t.Fatalf("invalid event %s: %v", e.data, err)
+			}
+			switch e.name {
+			case "content_block_start":
+				names = append(names, data.GetKeyv("content_block").GetString("type"))
+			case "content_block_delta":
+				partial += data.GetKeyv("delta").GetString("partial_json")
+			case "message_delta":
+				stop = data.GetKeyv("delta").GetString("stop_reason")
+			}
+		}
+		if want := []string{"thinking", "text", "tool_use"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("content blocks = %v, want %v", names, want)
+		}
+		if partial != `{"city": "Paris"}` || stop != "tool_use" {
+			t.Errorf("partial json = %q, stop reason = %q", partial, stop)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		h := &Handler{extensions: []inter.Adapter{&fakeAdapter{models: []string{"test"}, completion: func(gtx *gin.Context) error {
+			response.Error(gtx, http.StatusTooManyRequests, "slow down")
+			return nil
+		}}}}
+		gtx, w := newContext(http.MethodPost, "/v1/messages", body)
+		h.messages(gtx)
+
+		var resp struct {
+			Type  string `json:"type"`
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusTooManyRequests ||
+			resp.Type != "error" || resp.Error.Type != "rate_limit_error" || !strings.Contains(resp.Error.Message, "slow down") {
+			t.Errorf("status = %d, body = %s", w.Code, w.Body)
+		}
+	})
+}
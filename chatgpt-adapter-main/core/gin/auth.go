@@ -0,0 +1,195 @@
+package gin
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/common/jwtkey"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+)
+
+var (
+	// 网关密钥，配置了 keys 或 jwt 后所有接口都需要使用密钥访问
+	keyStore = make(map[string]*model.ApiKey)
+
+	// 校验网关签发的 JWT 密钥
+	signer *jwtkey.Signer
+)
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		if !env.IsSet("jwt") {
+			return
+		}
+
+		var err error
+		signer, err = jwtkey.New(
+			env.GetString("jwt.alg"),
+			env.GetString("jwt.secret"),
+			env.GetString("jwt.private-key"),
+			env.GetString("jwt.public-key"),
+			env.GetString("jwt.issuer"))
+		if err != nil {
+			logger.Fatalf("failed to initialize jwt: %v", err)
+		}
+	})
+
+	inited.AddInitialized(func(env *env.Environment) {
+		var objs []struct {
+			model.ApiKey `mapstructure:",squash"`
+			Expires      string `mapstructure:"expires"`
+		}
+		if err := env.UnmarshalKey("keys", &objs); err != nil {
+			logger.Fatal(err)
+		}
+
+		for i := range objs {
+			key := objs[i].ApiKey
+			if key.Key == "" {
+				logger.Fatalf("the key is not configured: keys[%d].key", i)
+			}
+			if err := key.Compile(); err != nil {
+				logger.Fatalf("failed to compile keys[%d]: %v", i, err)
+			}
+			if expires := objs[i].Expires; expires != "" {
+				t, err := parseExpires(expires)
+				if err != nil {
+					logger.Fatalf("failed to parse keys[%d].expires: %v", i, err)
+				}
+				key.Expires = t
+			}
+			keyStore[key.Key] = &key
+		}
+	})
+}
+
+func parseExpires(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, value, time.Local)
+}
+
+// 认证网关密钥，放在 token 之后执行
+func auth(gtx *gin.Context) {
+	if (len(keyStore) == 0 && signer == nil) || gtx.Request.Method == http.MethodOptions {
+		return
+	}
+
+	path := gtx.Request.URL.Path
+	if path == "/" || path == "/favicon.ico" || path == "/metrics" ||
+		strings.HasPrefix(path, "/file/") ||
+		strings.HasPrefix(path, "/v1/admin/") {
+		return
+	}
+
+	token := gtx.GetString("token")
+	key, ok := keyStore[token]
+	if !ok && signer != nil && jwtkey.IsToken(token) {
+		claims, err := signer.Parse(token)
+		if err != nil {
+			response.Error(gtx, http.StatusUnauthorized, "invalid api key: "+err.Error())
+			gtx.Abort()
+			return
+		}
+
+		if key, err = claimsKey(token, claims); err != nil {
+			response.Error(gtx, http.StatusUnauthorized, "invalid api key: "+err.Error())
+			gtx.Abort()
+			return
+		}
+		gtx.Set(vars.GinClaims, claims)
+		ok = true
+	}
+
+	if !ok {
+		response.Error(gtx, http.StatusUnauthorized, "invalid api key")
+		gtx.Abort()
+		return
+	}
+
+	if key.Expired() {
+		response.Error(gtx, http.StatusUnauthorized, "the api key has expired")
+		gtx.Abort()
+		return
+	}
+
+	// 避免将网关密钥当作上游凭证使用
+	gtx.Set("token", "")
+	gtx.Set(vars.GinApiKey, key)
+}
+
+// JWT 密钥转换为 ApiKey，不携带上游凭证，总是使用账号池
+// 限额按 jti 计算，没有 jti 时按密钥本身，同一用户的多个密钥互不影响
+func claimsKey(token string, claims *jwtkey.Claims) (*model.ApiKey, error) {
+	key := &model.ApiKey{
+		Key:      claims.ID,
+		Label:    claims.Subject,
+		Tenant:   claims.Tenant,
+		Models:   claims.Models,
+		Adapters: claims.Adapters,
+		RPM:      claims.RPM,
+		TPD:      claims.TPD,
+		Pool:     true,
+	}
+	if key.Key == "" {
+		key.Key = token
+	}
+	if claims.ExpiresAt != nil {
+		key.Expires = claims.ExpiresAt.Time
+	}
+	return key, key.Compile()
+}
+
+// 校验密钥是否允许访问该模型，并设置对应的上游凭证
+func authorize(gtx *gin.Context, mod string) bool {
+	key, ok := common.GetGinValue[*model.ApiKey](gtx, vars.GinApiKey)
+	if !ok {
+		return true
+	}
+
+	if !key.AllowModel(mod) {
+		response.Error(gtx, http.StatusForbidden, "the api key is not allowed to access model '"+mod+"'")
+		return false
+	}
+	return credential(gtx, key, mod)
+}
+
+// 设置模型对应的上游凭证，没有时使用账号池
+func credential(gtx *gin.Context, key *model.ApiKey, mod string) bool {
+	if token, ok := key.Credential(mod); ok {
+		gtx.Set("token", token)
+		return true
+	}
+
+	if key.Pool {
+		gtx.Set("token", env.Env.GetString("server.password"))
+		return true
+	}
+
+	response.Error(gtx, http.StatusForbidden, "the api key has no upstream credentials for model '"+mod+"'")
+	return false
+}
+
+// 校验密钥是否允许使用该适配器
+func authorizeAdapter(gtx *gin.Context, extension inter.Adapter) bool {
+	key, ok := common.GetGinValue[*model.ApiKey](gtx, vars.GinApiKey)
+	if !ok {
+		return true
+	}
+
+	if name := adapterName(extension); !key.AllowAdapter(name) {
+		response.Error(gtx, http.StatusForbidden, "the api key is not allowed to use adapter '"+name+"'")
+		return false
+	}
+	return true
+}
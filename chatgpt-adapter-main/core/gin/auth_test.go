@@ -0,0 +1,188 @@
+package gin
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/jwtkey"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+)
+
+// 替换全局的密钥库
+func withKeys(t *testing.T, keys ...model.ApiKey) {
+	t.Helper()
+	old := keyStore
+	keyStore = make(map[string]*model.ApiKey)
+	for i := range keys {
+		key := keys[i]
+		if err := key.Compile(); err != nil {
+			t.Fatal(err)
+		}
+		keyStore[key.Key] = &key
+	}
+	t.Cleanup(func() { keyStore = old })
+}
+
+// 依次执行 token、auth 中间件
+func authenticate(path, bearer string) (*gin.Context, int, string) {
+	gtx, w := newContext(http.MethodPost, path, "")
+	if bearer != "" {
+		gtx.Request.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	token(gtx)
+	auth(gtx)
+	return gtx, w.Code, w.Body.String()
+}
+
+func TestAuth(t *testing.T) {
+	withKeys(t,
+		model.ApiKey{Key: "sk-team", Label: "team"},
+		model.ApiKey{Key: "sk-expired", Expires: time.Now().Add(-time.Hour)},
+	)
+
+	t.Run("valid key", func(t *testing.T) {
+		gtx, code, _ := authenticate("/v1/chat/completions", "sk-team")
+		if gtx.IsAborted() || code != http.StatusOK {
+			t.Fatalf("aborted = %v, status = %d", gtx.IsAborted(), code)
+		}
+		key, ok := common.GetGinValue[*model.ApiKey](gtx, vars.GinApiKey)
+		if !ok || key.Label != "team" {
+			t.Errorf("api key = %v", key)
+		}
+		// 网关密钥不能作为上游凭证
+		if gtx.GetString("token") != "" {
+			t.Errorf("token = %q", gtx.GetString("token"))
+		}
+	})
+
+	tests := []struct {
+		name   string
+		bearer string
+		body   string
+	}{
+		{"missing key", "", "invalid api key"},
+		{"unknown key", "sk-unknown", "invalid api key"},
+		{"expired key", "sk-expired", "has expired"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gtx, code, body := authenticate("/v1/chat/completions", tt.bearer)
+			if !gtx.IsAborted() || code != http.StatusUnauthorized || !strings.Contains(body, tt.body) {
+				t.Errorf("aborted = %v, status = %d, body = %s", gtx.IsAborted(), code, body)
+			}
+		})
+	}
+
+	t.Run("public paths", func(t *testing.T) {
+		for _, path := range []string{"/", "/metrics", "/file/a.png", "/v1/admin/pools"} {
+			if gtx, code, _ := authenticate(path, ""); gtx.IsAborted() || code != http.StatusOK {
+				t.Errorf("%s: status = %d", path, code)
+			}
+		}
+	})
+
+	t.Run("no keys", func(t *testing.T) {
+		withKeys(t)
+		gtx, _, _ := authenticate("/v1/chat/completions", "cookie")
+		if gtx.IsAborted() || gtx.GetString("token") != "cookie" {
+			t.Errorf("aborted = %v, token = %q", gtx.IsAborted(), gtx.GetString("token"))
+		}
+	})
+}
+
+func TestAuthorize(t *testing.T) {
+	withEnv(t, map[string]interface{}{"server.password": "pool-password"})
+	var received string
+	h := &Handler{extensions: []inter.Adapter{&fakeAdapter{models: []string{"gpt-4", "gpt-4o", "claude-3"}, completion: func(gtx *gin.Context) error {
+		received = gtx.GetString("token")
+		response.Response(gtx, common.GetGinCompletion(gtx).Model, "hello")
+		return nil
+	}}}}
+
+	request := func(key *model.ApiKey, mod string) (int, string) {
+		received = ""
+		gtx, w := newContext(http.MethodPost, "/v1/chat/completions", `{"model": "`+mod+`", "messages": [{"role": "user", "content": "hi"}]}`)
+		withKey(t, gtx, key)
+		h.completions(gtx)
+		return w.Code, w.Body.String()
+	}
+
+	key := &model.ApiKey{
+		Models:      []string{"gpt-4", "claude-.*"},
+		Credentials: []model.Credential{{Models: "claude-.*", Token: "claude-cookie"}},
+	}
+
+	tests := []struct {
+		name  string
+		key   *model.ApiKey
+		mod   string
+		code  int
+		token string
+		body  string
+	}{
+		{"credential", key, "claude-3", http.StatusOK, "claude-cookie", ""},
+		{"model not allowed", key, "gpt-4o", http.StatusForbidden, "", "not allowed to access model 'gpt-4o'"},
+		{"no credentials", key, "gpt-4", http.StatusForbidden, "", "no upstream credentials"},
+		{"pool", &model.ApiKey{Pool: true}, "gpt-4", http.StatusOK, "pool-password", ""},
+		{"adapter not allowed", &model.ApiKey{Pool: true, Adapters: []string{"cursor"}}, "gpt-4", http.StatusForbidden, "", "not allowed to use adapter 'gin'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := request(tt.key, tt.mod)
+			if code != tt.code || received != tt.token || !strings.Contains(body, tt.body) {
+				t.Errorf("status = %d, token = %q, body = %s", code, received, body)
+			}
+		})
+	}
+}
+
+func TestAuthJWT(t *testing.T) {
+	withKeys(t)
+	old := signer
+	signer, _ = jwtkey.New("HS256", "secret", "", "", "gateway")
+	t.Cleanup(func() { signer = old })
+
+	claims := jwtkey.Claims{Tenant: "acme", Models: []string{"gpt-4"}, Adapters: []string{"coze"}, RPM: 5, TPD: 100}
+	claims.Subject = "alice"
+	claims.ID = "key-1"
+	token, err := signer.Mint(claims, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gtx, code, body := authenticate("/v1/chat/completions", token)
+	if gtx.IsAborted() || code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", code, body)
+	}
+	key, _ := common.GetGinValue[*model.ApiKey](gtx, vars.GinApiKey)
+	if key.Key != "key-1" || key.Label != "alice" || key.Tenant != "acme" || key.RPM != 5 || key.TPD != 100 || !key.Pool || key.Expires.IsZero() {
+		t.Errorf("api key = %+v", key)
+	}
+	if !key.AllowModel("gpt-4") || key.AllowModel("gpt-4o") || key.AllowAdapter("bing") {
+		t.Error("the claims should restrict models and adapters")
+	}
+	if parsed, ok := common.GetGinValue[*jwtkey.Claims](gtx, vars.GinClaims); !ok || parsed.Tenant != "acme" {
+		t.Errorf("claims = %v", parsed)
+	}
+
+	// 签名无效
+	if gtx, code, body = authenticate("/v1/chat/completions", token[:len(token)-2]+"xx"); !gtx.IsAborted() || code != http.StatusUnauthorized {
+		t.Errorf("status = %d, body = %s", code, body)
+	}
+
+	// 没有 jti 时限额按密钥本身计算
+	key, err = claimsKey(token, &jwtkey.Claims{})
+	if err != nil || key.Key != token {
+		t.Errorf("key = %q, err = %v", key.Key, err)
+	}
+	if _, err = claimsKey(token, &jwtkey.Claims{Models: []string{"gpt-("}}); err == nil {
+		t.Error("an invalid model pattern should be rejected")
+	}
+}
@@ -0,0 +1,178 @@
+package gin
+
+import (
+	"math/rand"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 负载均衡策略
+const (
+	strategyPriority       = "priority" // 按配置顺序
+	strategyRoundRobin     = "round-robin"
+	strategyWeightedRandom = "weighted-random"
+	strategyLeastInFlight  = "least-in-flight"
+	strategyEWMA           = "ewma" // 首字耗时的指数加权平均
+
+	// 指数加权平均的平滑系数
+	ewmaAlpha = 0.2
+	// 健康度的下限，避免权重降为 0 后不再被选中
+	minHealth = 0.05
+	// 从未成功输出过的上游按此首字耗时计算
+	penaltyTTFT = 10000.0
+)
+
+// 同一个别名下等价的上游模型
+type balancer struct {
+	mu       sync.Mutex
+	alias    string
+	strategy string
+	counter  int
+	targets  []*upstream
+}
+
+type upstream struct {
+	Model    string  `json:"model"`
+	Weight   float64 `json:"weight"`
+	InFlight int     `json:"in_flight"`
+	TTFT     float64 `json:"ewma_ttft_ms"` // 0 为未观测
+	Health   float64 `json:"health"`       // 成功率的指数加权平均
+	Requests int     `json:"requests"`
+	Failures int     `json:"failures"`
+}
+
+func newBalancer(alias, strategy string, models []string, weights []float64) *balancer {
+	if strategy == "" {
+		strategy = strategyPriority
+	}
+
+	b := &balancer{alias: alias, strategy: strategy}
+	for i, mod := range models {
+		weight := 1.0
+		if i < len(weights) && weights[i] > 0 {
+			weight = weights[i]
+		}
+		b.targets = append(b.targets, &upstream{Model: mod, Weight: weight, Health: 1})
+	}
+	return b
+}
+
+func validStrategy(strategy string) bool {
+	switch strategy {
+	case "", strategyPriority, strategyRoundRobin, strategyWeightedRandom, strategyLeastInFlight, strategyEWMA:
+		return true
+	}
+	return false
+}
+
+// 按策略排列本次请求尝试的顺序，首个为主选，其余作为回退
+func (b *balancer) order() []*upstream {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	targets := slices.Clone(b.targets)
+	switch b.strategy {
+	case strategyRoundRobin:
+		offset := b.counter % len(targets)
+		b.counter++
+		targets = append(targets[offset:], targets[:offset]...)
+
+	case strategyWeightedRandom:
+		for i := range targets {
+			total := 0.0
+			for _, t := range targets[i:] {
+				total += t.score()
+			}
+			r := rand.Float64() * total
+			for j, t := range targets[i:] {
+				if r -= t.score(); r <= 0 || j == len(targets[i:])-1 {
+					targets[i], targets[i+j] = targets[i+j], targets[i]
+					break
+				}
+			}
+		}
+
+	case strategyLeastInFlight:
+		sort.SliceStable(targets, func(i, j int) bool {
+			return targets[i].InFlight < targets[j].InFlight
+		})
+
+	case strategyEWMA:
+		// 未请求过的优先尝试，其余按健康度修正后的首字耗时排序
+		sort.SliceStable(targets, func(i, j int) bool {
+			x, y := targets[i], targets[j]
+			if x.Requests == 0 || y.Requests == 0 {
+				return x.Requests == 0 && y.Requests != 0
+			}
+			return x.latency() < y.latency()
+		})
+	}
+	return targets
+}
+
+func (b *balancer) begin(u *upstream) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	u.InFlight++
+	u.Requests++
+}
+
+// 记录本次请求的结果，ttft 为 0 时表示没有输出
+func (b *balancer) end(u *upstream, ttft time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	u.InFlight--
+
+	success := 0.0
+	if ok {
+		success = 1
+	} else {
+		u.Failures++
+	}
+	u.Health = ewmaAlpha*success + (1-ewmaAlpha)*u.Health
+
+	if ok && ttft > 0 {
+		ms := float64(ttft.Milliseconds())
+		if u.TTFT == 0 {
+			u.TTFT = ms
+		} else {
+			u.TTFT = ewmaAlpha*ms + (1-ewmaAlpha)*u.TTFT
+		}
+	}
+}
+
+// 当前状态的快照
+func (b *balancer) snapshot() map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	targets := make([]upstream, 0, len(b.targets))
+	for _, u := range b.targets {
+		targets = append(targets, *u)
+	}
+	return map[string]interface{}{
+		"alias":    b.alias,
+		"strategy": b.strategy,
+		"targets":  targets,
+	}
+}
+
+func (u *upstream) health() float64 {
+	return max(u.Health, minHealth)
+}
+
+// 健康度修正后的首字耗时
+func (u *upstream) latency() float64 {
+	ttft := u.TTFT
+	if ttft == 0 {
+		ttft = penaltyTTFT
+	}
+	return ttft / u.health()
+}
+
+// 加权随机时的有效权重
+func (u *upstream) score() float64 {
+	return u.Weight * u.health()
+}
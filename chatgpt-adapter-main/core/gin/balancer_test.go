@@ -0,0 +1,120 @@
+package gin
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func targetModels(targets []*upstream) (result []string) {
+	for _, t := range targets {
+		result = append(result, t.Model)
+	}
+	return
+}
+
+func TestBalancerOrder(t *testing.T) {
+	t.Run("priority", func(t *testing.T) {
+		b := newBalancer("alias", "", []string{"a", "b", "c"}, nil)
+		for i := 0; i < 3; i++ {
+			if got := targetModels(b.order()); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+				t.Errorf("order = %v", got)
+			}
+		}
+	})
+
+	t.Run("round robin", func(t *testing.T) {
+		b := newBalancer("alias", strategyRoundRobin, []string{"a", "b", "c"}, nil)
+		want := [][]string{{"a", "b", "c"}, {"b", "c", "a"}, {"c", "a", "b"}, {"a", "b", "c"}}
+		for i, w := range want {
+			if got := targetModels(b.order()); !reflect.DeepEqual(got, w) {
+				t.Errorf("order #%d = %v, want %v", i, got, w)
+			}
+		}
+	})
+
+	t.Run("least in flight", func(t *testing.T) {
+		b := newBalancer("alias", strategyLeastInFlight, []string{"a", "b", "c"}, nil)
+		b.begin(b.targets[0])
+		b.begin(b.targets[0])
+		b.begin(b.targets[2])
+		if got := targetModels(b.order()); !reflect.DeepEqual(got, []string{"b", "c", "a"}) {
+			t.Errorf("order = %v", got)
+		}
+
+		b.end(b.targets[0], 0, true)
+		b.end(b.targets[0], 0, true)
+		if got := targetModels(b.order()); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+			t.Errorf("order after end = %v", got)
+		}
+	})
+
+	t.Run("ewma", func(t *testing.T) {
+		b := newBalancer("alias", strategyEWMA, []string{"slow", "fast", "new"}, nil)
+		for _, u := range b.targets[:2] {
+			b.begin(u)
+		}
+		b.end(b.targets[0], 800*time.Millisecond, true)
+		b.end(b.targets[1], 200*time.Millisecond, true)
+
+		// 未请求过的优先，其余按首字耗时
+		if got := targetModels(b.order()); !reflect.DeepEqual(got, []string{"new", "fast", "slow"}) {
+			t.Errorf("order = %v", got)
+		}
+
+		// 失败降低健康度，修正后的耗时变长
+		b.begin(b.targets[2])
+		b.end(b.targets[2], 100*time.Millisecond, true)
+		for i := 0; i < 10; i++ {
+			b.begin(b.targets[1])
+			b.end(b.targets[1], 0, false)
+		}
+		if got := targetModels(b.order()); !reflect.DeepEqual(got, []string{"new", "slow", "fast"}) {
+			t.Errorf("order after failures = %v", got)
+		}
+	})
+
+	t.Run("weighted random", func(t *testing.T) {
+		b := newBalancer("alias", strategyWeightedRandom, []string{"a", "b"}, []float64{3, 1})
+		first := make(map[string]int)
+		for i := 0; i < 4000; i++ {
+			order := targetModels(b.order())
+			if len(order) != 2 || order[0] == order[1] {
+				t.Fatalf("order = %v", order)
+			}
+			first[order[0]]++
+		}
+		if ratio := float64(first["a"]) / 4000; math.Abs(ratio-0.75) > 0.05 {
+			t.Errorf("a was chosen first %.2f of the time, want about 0.75", ratio)
+		}
+	})
+}
+
+func TestBalancerEnd(t *testing.T) {
+	b := newBalancer("alias", strategyEWMA, []string{"a"}, nil)
+	u := b.targets[0]
+
+	b.begin(u)
+	b.end(u, 100*time.Millisecond, true)
+	b.begin(u)
+	b.end(u, 200*time.Millisecond, true)
+	if want := ewmaAlpha*200 + (1-ewmaAlpha)*100; math.Abs(u.TTFT-want) > 1e-9 {
+		t.Errorf("ttft = %v, want %v", u.TTFT, want)
+	}
+
+	// 失败不更新首字耗时
+	b.begin(u)
+	b.end(u, time.Second, false)
+	if u.InFlight != 0 || u.Requests != 3 || u.Failures != 1 || u.Health != 1-ewmaAlpha {
+		t.Errorf("upstream = %+v", *u)
+	}
+
+	for i := 0; i < 100; i++ {
+		b.begin(u)
+		b.end(u, 0, false)
+	}
+	if u.health() != minHealth || math.IsInf(u.latency(), 0) {
+		t.Errorf("health = %v, latency = %v", u.health(), u.latency())
+	}
+}
@@ -0,0 +1,231 @@
+package gin
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 熔断器状态
+const (
+	circuitClosed = iota
+	circuitHalfOpen
+	circuitOpen
+)
+
+// 请求结果，neutral 通常由单个凭证引起（401、429 等），不影响熔断
+const (
+	outcomeSuccess = iota
+	outcomeFailure
+	outcomeNeutral
+)
+
+var (
+	circuitNames = []string{"closed", "half-open", "open"}
+
+	circuits   = make(map[string]*circuit)
+	circuitsMu sync.Mutex
+
+	circuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "chatgpt_adapter_circuit_state",
+		Help: "State of the upstream circuit breaker: 0 closed, 1 half-open, 2 open.",
+	}, []string{"upstream"})
+	circuitTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chatgpt_adapter_circuit_transitions_total",
+		Help: "State transitions of the upstream circuit breaker.",
+	}, []string{"upstream", "from", "to"})
+)
+
+func init() {
+	prometheus.MustRegister(circuitState, circuitTransitions)
+}
+
+// 按适配器和模型熔断的上游
+type circuit struct {
+	mu  sync.Mutex
+	key string
+
+	state     int
+	failures  int // 连续失败次数
+	successes int // 半开状态下探测成功的次数
+	probing   int // 半开状态下正在探测的请求数
+	openedAt  time.Time
+}
+
+// 未开启熔断时返回 nil
+//
+//	breaker.enabled  是否开启
+//	breaker.failures 连续失败多少次后熔断，默认 5
+//	breaker.interval 熔断后多少秒开始探测，默认 30
+//	breaker.probes   半开状态下探测成功多少次后恢复，默认 1
+func circuitOf(extension inter.Adapter, mod string) *circuit {
+	if !env.Env.GetBool("breaker.enabled") {
+		return nil
+	}
+
+	key := adapterName(extension) + ":" + mod
+	circuitsMu.Lock()
+	defer circuitsMu.Unlock()
+	c, ok := circuits[key]
+	if !ok {
+		c = &circuit{key: key}
+		circuits[key] = c
+		circuitState.WithLabelValues(key).Set(circuitClosed)
+	}
+	return c
+}
+
+// 适配器所在的包名，如 cursor、windsurf
+func adapterName(extension inter.Adapter) string {
+	t := reflect.TypeOf(extension)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return path.Base(t.PkgPath())
+}
+
+func breakerInt(key string, value int) int {
+	if v := env.Env.GetInt(key); v > 0 {
+		return v
+	}
+	return value
+}
+
+// 是否放行请求，probe 为 true 时是半开状态下的探测请求；不放行时 retry 为建议的重试间隔
+func (c *circuit) allow() (probe, ok bool, retry time.Duration) {
+	if c == nil {
+		return false, true, 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.state {
+	case circuitClosed:
+		return false, true, 0
+
+	case circuitOpen:
+		interval := time.Duration(breakerInt("breaker.interval", 30)) * time.Second
+		if elapsed := time.Since(c.openedAt); elapsed < interval {
+			return false, false, interval - elapsed
+		}
+		c.transition(circuitHalfOpen)
+	}
+
+	if c.probing >= breakerInt("breaker.probes", 1) {
+		return false, false, time.Second
+	}
+	c.probing++
+	return true, true, 0
+}
+
+// 记录请求结果
+func (c *circuit) done(probe bool, outcome int) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if probe {
+		c.probing--
+		if c.state != circuitHalfOpen || outcome == outcomeNeutral {
+			return
+		}
+		if outcome == outcomeFailure {
+			c.transition(circuitOpen)
+			return
+		}
+		if c.successes++; c.successes >= breakerInt("breaker.probes", 1) {
+			c.transition(circuitClosed)
+		}
+		return
+	}
+
+	if c.state != circuitClosed || outcome == outcomeNeutral {
+		return
+	}
+	if outcome == outcomeSuccess {
+		c.failures = 0
+		return
+	}
+	if c.failures++; c.failures >= breakerInt("breaker.failures", 5) {
+		c.transition(circuitOpen)
+	}
+}
+
+func (c *circuit) transition(state int) {
+	logger.Warnf("circuit %s: %s -> %s", c.key, circuitNames[c.state], circuitNames[state])
+	circuitTransitions.WithLabelValues(c.key, circuitNames[c.state], circuitNames[state]).Inc()
+	circuitState.WithLabelValues(c.key).Set(float64(state))
+
+	c.state = state
+	c.failures = 0
+	c.successes = 0
+	if state == circuitOpen {
+		c.openedAt = time.Now()
+	}
+}
+
+// 熔断中的请求直接返回 503，配置了别名路由时会换下一个模型
+func (c *circuit) reject(gtx *gin.Context, retry time.Duration) {
+	seconds := int(math.Ceil(retry.Seconds()))
+	gtx.Header("Retry-After", strconv.Itoa(seconds))
+	response.Error(gtx, http.StatusServiceUnavailable, fmt.Sprintf("the upstream '%s' is temporarily unavailable, retry after %ds", c.key, seconds))
+}
+
+// 请求结果：只有 5xx、超时和空响应算作上游失败，其它 4xx 与单个账号或密钥有关，不计入
+func outcomeOf(gtx *gin.Context) int {
+	status := gtx.Writer.Status()
+	switch {
+	case !gtx.Writer.Written() || status >= http.StatusInternalServerError:
+		return outcomeFailure
+	case status >= http.StatusBadRequest:
+		return outcomeNeutral
+	default:
+		return outcomeSuccess
+	}
+}
+
+// 当前状态的快照
+func circuitsSnapshot() []map[string]interface{} {
+	circuitsMu.Lock()
+	keys := make([]string, 0, len(circuits))
+	for key := range circuits {
+		keys = append(keys, key)
+	}
+	circuitsMu.Unlock()
+	sort.Strings(keys)
+
+	data := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		circuitsMu.Lock()
+		c := circuits[key]
+		circuitsMu.Unlock()
+
+		c.mu.Lock()
+		item := map[string]interface{}{
+			"upstream": c.key,
+			"state":    circuitNames[c.state],
+			"failures": c.failures,
+		}
+		if c.state == circuitOpen {
+			item["opened_at"] = c.openedAt.Unix()
+		}
+		c.mu.Unlock()
+		data = append(data, item)
+	}
+	return data
+}
@@ -0,0 +1,162 @@
+package gin
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// 熔断器按适配器和模型共享，测试结束后移除
+func newCircuit(t *testing.T, extension inter.Adapter, mod string) *circuit {
+	t.Helper()
+	c := circuitOf(extension, mod)
+	t.Cleanup(func() {
+		circuitsMu.Lock()
+		delete(circuits, c.key)
+		circuitsMu.Unlock()
+	})
+	return c
+}
+
+func TestCircuit(t *testing.T) {
+	withEnv(t, map[string]interface{}{"breaker.enabled": true, "breaker.failures": 2, "breaker.probes": 2})
+	c := newCircuit(t, &fakeAdapter{}, t.Name())
+
+	request := func(outcome int) bool {
+		probe, ok, _ := c.allow()
+		if ok {
+			c.done(probe, outcome)
+		}
+		return ok
+	}
+
+	// 4xx 不计入，成功清零连续失败次数
+	request(outcomeFailure)
+	request(outcomeNeutral)
+	request(outcomeSuccess)
+	request(outcomeFailure)
+	if c.state != circuitClosed {
+		t.Fatalf("state = %s, want closed", circuitNames[c.state])
+	}
+
+	request(outcomeFailure)
+	if c.state != circuitOpen {
+		t.Fatalf("state = %s, want open", circuitNames[c.state])
+	}
+	if _, ok, retry := c.allow(); ok || retry <= 0 || retry > 30*time.Second {
+		t.Errorf("allow while open = %v, retry %v", ok, retry)
+	}
+	if testutil.ToFloat64(circuitState.WithLabelValues(c.key)) != circuitOpen {
+		t.Error("the state gauge was not updated")
+	}
+
+	// 到达探测时间后放行 breaker.probes 个探测请求
+	c.openedAt = time.Now().Add(-time.Minute)
+	probe1, ok1, _ := c.allow()
+	probe2, ok2, _ := c.allow()
+	if _, ok3, _ := c.allow(); !probe1 || !ok1 || !probe2 || !ok2 || ok3 {
+		t.Fatalf("probes = %v %v %v %v, third allowed %v", probe1, ok1, probe2, ok2, ok3)
+	}
+
+	// 探测时的 4xx 不改变状态，失败重新熔断
+	c.done(probe1, outcomeNeutral)
+	c.done(probe2, outcomeFailure)
+	if c.state != circuitOpen {
+		t.Fatalf("state after a failed probe = %s, want open", circuitNames[c.state])
+	}
+
+	c.openedAt = time.Now().Add(-time.Minute)
+	for i := 0; i < 2; i++ {
+		if !request(outcomeSuccess) {
+			t.Fatalf("probe #%d rejected", i)
+		}
+	}
+	if c.state != circuitClosed {
+		t.Errorf("state after successful probes = %s, want closed", circuitNames[c.state])
+	}
+}
+
+func TestCircuitDisabled(t *testing.T) {
+	withEnv(t, nil)
+	c := circuitOf(&fakeAdapter{}, t.Name())
+	if c != nil {
+		t.Fatal("circuitOf should return nil when the breaker is disabled")
+	}
+	if probe, ok, _ := c.allow(); probe || !ok {
+		t.Error("a nil circuit should allow every request")
+	}
+	c.done(false, outcomeFailure)
+}
+
+func TestOutcomeOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		write   func(gtx *gin.Context)
+		outcome int
+	}{
+		{"success", func(gtx *gin.Context) { gtx.String(http.StatusOK, "ok") }, outcomeSuccess},
+		{"empty response", func(gtx *gin.Context) {}, outcomeFailure},
+		{"server error", func(gtx *gin.Context) { gtx.String(http.StatusBadGateway, "bad") }, outcomeFailure},
+		{"rate limited", func(gtx *gin.Context) { gtx.String(http.StatusTooManyRequests, "slow") }, outcomeNeutral},
+		{"unauthorized", func(gtx *gin.Context) { gtx.String(http.StatusUnauthorized, "who") }, outcomeNeutral},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gtx, _ := newContext(http.MethodPost, "/v1/chat/completions", "")
+			tt.write(gtx)
+			if got := outcomeOf(gtx); got != tt.outcome {
+				t.Errorf("outcomeOf = %d, want %d", got, tt.outcome)
+			}
+		})
+	}
+}
+
+func TestBreakerReject(t *testing.T) {
+	withEnv(t, map[string]interface{}{"breaker.enabled": true, "breaker.failures": 2})
+	status := http.StatusBadGateway
+	adapter := &fakeAdapter{models: []string{t.Name()}, completion: func(gtx *gin.Context) error {
+		response.Error(gtx, status, "upstream failed")
+		return nil
+	}}
+	h := &Handler{extensions: []inter.Adapter{adapter}}
+	newCircuit(t, adapter, t.Name())
+
+	request := func() (int, string) {
+		gtx, w := newContext(http.MethodPost, "/v1/chat/completions", `{"model": "`+t.Name()+`", "messages": [{"role": "user", "content": "hi"}]}`)
+		h.completions(gtx)
+		return w.Code, w.Header().Get("Retry-After")
+	}
+
+	// 429 由单个账号引起，不触发熔断
+	status = http.StatusTooManyRequests
+	for i := 0; i < 3; i++ {
+		if code, _ := request(); code != http.StatusTooManyRequests {
+			t.Fatalf("request #%d status = %d", i, code)
+		}
+	}
+
+	status = http.StatusBadGateway
+	request()
+	request()
+	code, retry := request()
+	if code != http.StatusServiceUnavailable || retry == "" {
+		t.Errorf("status = %d, Retry-After = %q; want 503 with Retry-After", code, retry)
+	}
+	if key := adapterName(adapter) + ":" + t.Name(); !slices.Contains(circuitsSnapshotKeys(), key) {
+		t.Errorf("snapshot does not contain %s", key)
+	}
+}
+
+func circuitsSnapshotKeys() (keys []string) {
+	for _, item := range circuitsSnapshot() {
+		keys = append(keys, item["upstream"].(string))
+	}
+	return
+}
@@ -0,0 +1,251 @@
+package gin
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+
+	"chatgpt-adapter/core/common/toolcall"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+)
+
+// 与 OpenAI 相同，n 最大为 128，可通过 server.max-n 调整
+func maxChoices() int {
+	if n := env.Env.GetInt("server.max-n"); n > 0 {
+		return n
+	}
+	return 128
+}
+
+// 同时执行的 choice 数量，每个 choice 都会占用一个账号，可通过 server.n-concurrency 调整
+func choicesConcurrency() int {
+	if n := env.Env.GetInt("server.n-concurrency"); n > 0 {
+		return n
+	}
+	return 4
+}
+
+// n > 1 时并发执行 n 次补全，合并为带索引的 choices
+func multiCompletion(gtx *gin.Context, extension inter.Adapter, completion model.Completion) {
+	// 保证所有 choice 使用同一个响应 id
+	response.CompletionId(gtx)
+
+	merger := &choicesMerger{gtx: gtx, choices: make([]*model.Choice, completion.N)}
+	single := completion
+	single.N = 1
+
+	// 先复制全部上下文，开始输出后合并结果会写入 gtx
+	copies := make([]*gin.Context, completion.N)
+	writers := make([]*protoWriter, completion.N)
+	for index := range copies {
+		cp := gtx.Copy()
+		cp.Set(vars.GinCompletion, single)
+		cp.Set(vars.GinMatchers, newMatchers(cp, single.Stream))
+		writers[index] = newProtoWriter(&discardWriter{ResponseWriter: gtx.Writer, header: make(http.Header)}, &choiceConverter{merger, index})
+		cp.Writer = writers[index]
+		copies[index] = cp
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, choicesConcurrency())
+	for index, cp := range copies {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem }()
+			defer wg.Done()
+			defer writers[index].Close()
+			if err := completeChoice(cp, extension); err != nil {
+				response.Error(cp, -1, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+	merger.finish(completion.Stream)
+}
+
+// 需要时先由适配器执行工具选择，未产生工具调用再执行补全
+func completeChoice(gtx *gin.Context, extension inter.Adapter) error {
+	if toolcall.NeedExec(gtx) {
+		ok, err := extension.ToolChoice(gtx)
+		if err != nil || ok {
+			return err
+		}
+	}
+	return complete(gtx, extension)
+}
+
+type choicesMerger struct {
+	mu  sync.Mutex
+	gtx *gin.Context
+
+	base     *model.Response
+	choices  []*model.Choice
+	streamed bool
+	usage    map[string]int
+
+	code    int
+	message string
+	failed  []int // 失败的 choice 索引
+}
+
+func (m *choicesMerger) chunk(index int, chunk model.Response) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setBase(chunk)
+
+	// usage 在结束时合并输出
+	m.addUsage(chunk.Usage)
+	chunk.Usage = nil
+	if len(chunk.Choices) == 0 {
+		return
+	}
+
+	for i := range chunk.Choices {
+		chunk.Choices[i].Index = index
+	}
+
+	m.streamed = true
+	response.Event(m.gtx, "", chunk)
+}
+
+func (m *choicesMerger) response(index int, resp model.Response) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setBase(resp)
+	m.addUsage(resp.Usage)
+
+	choice := resp.Choices[0]
+	choice.Index = index
+	m.choices[index] = &choice
+}
+
+func (m *choicesMerger) error(index, code int, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.message == "" {
+		m.code = code
+		m.message = message
+	}
+	m.failed = append(m.failed, index)
+}
+
+func (m *choicesMerger) setBase(resp model.Response) {
+	if m.base == nil {
+		base := resp
+		base.Choices = nil
+		base.Usage = nil
+		m.base = &base
+	}
+}
+
+func (m *choicesMerger) addUsage(usage map[string]interface{}) {
+	if usage == nil {
+		return
+	}
+
+	if m.usage == nil {
+		m.usage = make(map[string]int)
+	}
+
+	// 同一个提示词，prompt_tokens 只计算一次
+	prompt, completion := usageTokens(m.gtx, usage, "")
+	if prompt > m.usage["prompt_tokens"] {
+		m.usage["prompt_tokens"] = prompt
+	}
+	m.usage["completion_tokens"] += completion
+	m.usage["total_tokens"] = m.usage["prompt_tokens"] + m.usage["completion_tokens"]
+}
+
+// 任意一个 choice 失败时整个请求失败，不返回不完整的 choices
+func (m *choicesMerger) finish(stream bool) {
+	if m.base == nil || len(m.failed) > 0 {
+		code := m.code
+		if code == 0 {
+			code = http.StatusInternalServerError
+		}
+		message := m.message
+		if message == "" {
+			message = "empty response"
+		}
+		if len(m.failed) > 0 {
+			slices.Sort(m.failed)
+			message = fmt.Sprintf("%d of %d choices failed %v: %s", len(m.failed), len(m.choices), m.failed, message)
+		}
+
+		// 流式输出已开始，异常作为事件输出
+		if m.streamed {
+			response.Event(m.gtx, "", map[string]interface{}{
+				"error": map[string]interface{}{"message": message, "code": code},
+			})
+			return
+		}
+		response.Error(m.gtx, code, message)
+		return
+	}
+
+	usage := make(map[string]interface{})
+	for k, v := range m.usage {
+		usage[k] = v
+	}
+
+	if stream {
+		resp := *m.base
+		resp.Choices = make([]model.Choice, 0)
+		resp.Usage = usage
+		response.Event(m.gtx, "", resp)
+		response.Event(m.gtx, "", "[DONE]")
+		return
+	}
+
+	resp := *m.base
+	for _, choice := range m.choices {
+		if choice != nil {
+			resp.Choices = append(resp.Choices, *choice)
+		}
+	}
+	resp.Usage = usage
+	m.gtx.JSON(http.StatusOK, resp)
+}
+
+// 单个 choice 的输出转交给 choicesMerger
+type choiceConverter struct {
+	merger *choicesMerger
+	index  int
+}
+
+func (*choiceConverter) ContentType() string { return "text/event-stream" }
+func (*choiceConverter) Done(io.Writer)      {}
+
+func (c *choiceConverter) Chunk(_ io.Writer, chunk model.Response) {
+	c.merger.chunk(c.index, chunk)
+}
+
+func (c *choiceConverter) Response(_ io.Writer, resp model.Response) {
+	c.merger.response(c.index, resp)
+}
+
+func (c *choiceConverter) Error(_ io.Writer, code int, message string, _ bool) {
+	c.merger.error(c.index, code, message)
+}
+
+// 丢弃写出的内容，仅用于承载 protoWriter
+type discardWriter struct {
+	gin.ResponseWriter
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header                 { return w.header }
+func (w *discardWriter) WriteHeader(int)                     {}
+func (w *discardWriter) WriteHeaderNow()                     {}
+func (w *discardWriter) Flush()                              {}
+func (w *discardWriter) Write(data []byte) (int, error)      { return len(data), nil }
+func (w *discardWriter) WriteString(str string) (int, error) { return len(str), nil }
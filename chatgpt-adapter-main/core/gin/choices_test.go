@@ -0,0 +1,163 @@
+package gin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMultiCompletion(t *testing.T) {
+	withEnv(t, map[string]interface{}{"server.n-concurrency": 2})
+
+	var (
+		mu      sync.Mutex
+		count   int
+		running int32
+		peak    int32
+	)
+	adapter := &fakeAdapter{models: []string{"test"}, completion: func(gtx *gin.Context) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		count++
+		content := fmt.Sprintf("answer %d", count)
+		mu.Unlock()
+
+		completion := common.GetGinCompletion(gtx)
+		if completion.Stream {
+			response.SSEResponse(gtx, completion.Model, content, time.Now().Unix())
+			response.SSEResponse(gtx, completion.Model, "[DONE]", time.Now().Unix())
+			return nil
+		}
+		response.Response(gtx, completion.Model, content)
+		return nil
+	}}
+	h := &Handler{extensions: []inter.Adapter{adapter}}
+
+	t.Run("response", func(t *testing.T) {
+		count, peak = 0, 0
+		gtx, w := newContext(http.MethodPost, "/v1/chat/completions", `{"model": "test", "n": 5, "messages": [{"role": "user", "content": "hi"}]}`)
+		h.completions(gtx)
+
+		var resp model.Response
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid response %s: %v", w.Body, err)
+		}
+		if len(resp.Choices) != 5 {
+			t.Fatalf("got %d choices, want 5: %s", len(resp.Choices), w.Body)
+		}
+		for i, choice := range resp.Choices {
+			if choice.Index != i || choice.Message == nil || !strings.HasPrefix(choice.Message.Content, "answer") {
+				t.Errorf("choice %d = %+v", i, choice)
+			}
+		}
+		if peak > 2 {
+			t.Errorf("%d choices ran concurrently, want at most 2", peak)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		count, peak = 0, 0
+		gtx, w := newContext(http.MethodPost, "/v1/chat/completions", `{"model": "test", "n": 3, "stream": true, "messages": [{"role": "user", "content": "hi"}]}`)
+		h.completions(gtx)
+
+		indexes := make(map[int]bool)
+		done := 0
+		for _, line := range strings.Split(w.Body.String(), "\n") {
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok {
+				continue
+			}
+			if data == "[DONE]" {
+				done++
+				continue
+			}
+			var chunk model.Response
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				t.Fatalf("invalid chunk %s: %v", data, err)
+			}
+			for _, choice := range chunk.Choices {
+				indexes[choice.Index] = true
+			}
+		}
+		if len(indexes) != 3 || done != 1 {
+			t.Errorf("streamed choices %v with %d [DONE], want 3 choices and 1 [DONE]: %s", indexes, done, w.Body)
+		}
+	})
+}
+
+func TestMultiCompletionToolChoice(t *testing.T) {
+	withEnv(t, nil)
+	var calls int32
+	adapter := &fakeAdapter{
+		models: []string{"test"},
+		toolChoice: func(gtx *gin.Context) (bool, error) {
+			atomic.AddInt32(&calls, 1)
+			response.ToolCallResponse(gtx, "test", "search", `{"q": "go"}`)
+			return true, nil
+		},
+		completion: func(gtx *gin.Context) error {
+			return errors.New("completion should not run after a tool call")
+		},
+	}
+	h := &Handler{extensions: []inter.Adapter{adapter}}
+
+	gtx, w := newContext(http.MethodPost, "/v1/chat/completions", `{"model": "test", "n": 3, "tool_choice": "required",
+		"messages": [{"role": "user", "content": "search go"}],
+		"tools": [{"type": "function", "function": {"name": "search", "parameters": {"type": "object"}}}]}`)
+	h.completions(gtx)
+
+	var resp model.Response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body, err)
+	}
+	if len(resp.Choices) != 3 || calls != 3 {
+		t.Fatalf("got %d choices from %d tool choices, want 3: %s", len(resp.Choices), calls, w.Body)
+	}
+	for i, choice := range resp.Choices {
+		if choice.Index != i || choice.Message == nil || len(choice.Message.ToolCalls) != 1 {
+			t.Errorf("choice %d = %+v", i, choice)
+		}
+	}
+}
+
+func TestMultiCompletionFailure(t *testing.T) {
+	withEnv(t, nil)
+	var count int32
+	adapter := &fakeAdapter{models: []string{"test"}, completion: func(gtx *gin.Context) error {
+		if atomic.AddInt32(&count, 1) == 2 {
+			return errors.New("upstream failed")
+		}
+		response.Response(gtx, "test", "answer")
+		return nil
+	}}
+	h := &Handler{extensions: []inter.Adapter{adapter}}
+
+	gtx, w := newContext(http.MethodPost, "/v1/chat/completions", `{"model": "test", "n": 3, "messages": [{"role": "user", "content": "hi"}]}`)
+	h.completions(gtx)
+
+	// 任意一个 choice 失败时整个请求失败
+	if w.Code == http.StatusOK || !strings.Contains(w.Body.String(), "1 of 3 choices failed") || !strings.Contains(w.Body.String(), "upstream failed") {
+		t.Errorf("status = %d, body = %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,201 @@
+package gin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/jsonschema"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+)
+
+const (
+	ginFormatError = "__format_error__"
+
+	jsonObjectPrompt = "Respond only with a valid JSON object. Do not wrap it in markdown code blocks and do not add any explanation."
+	jsonSchemaPrompt = "Respond only with a valid JSON value that conforms to the following JSON Schema. " +
+		"Do not wrap it in markdown code blocks and do not add any explanation.\n\nJSON Schema:\n%s"
+	jsonRetryPrompt = "Your previous response is not valid: %v\nRespond again with only the corrected JSON."
+)
+
+// 执行补全，存在 response_format 时校验输出的 JSON
+func complete(gtx *gin.Context, extension inter.Adapter) error {
+	completion := common.GetGinCompletion(gtx)
+	if !jsonFormat(completion) {
+		return extension.Completion(gtx)
+	}
+	return formatCompletion(gtx, extension, completion)
+}
+
+func jsonFormat(completion model.Completion) bool {
+	format := completion.ResponseFormat
+	return format != nil && (format.Type == "json_object" || format.Type == "json_schema")
+}
+
+// 将 response_format 的要求注入到提示词中
+func injectResponseFormat(completion model.Completion) []model.Keyv[interface{}] {
+	if !jsonFormat(completion) {
+		return completion.Messages
+	}
+
+	prompt := jsonObjectPrompt
+	if format := completion.ResponseFormat; format.JsonSchema != nil && format.JsonSchema.Schema != nil {
+		schema, err := json.MarshalIndent(format.JsonSchema.Schema, "", "  ")
+		if err != nil {
+			logger.Error(err)
+		}
+		prompt = fmt.Sprintf(jsonSchemaPrompt, schema)
+	}
+
+	messages := append([]model.Keyv[interface{}]{}, completion.Messages...)
+	if messageL := len(messages); messageL > 0 {
+		message := messages[messageL-1]
+		if message.Is("role", "user") && message.IsString("content") {
+			message = message.Clone()
+			message.Set("content", message.GetString("content")+"\n\n"+prompt)
+			messages[messageL-1] = message
+			return messages
+		}
+	}
+	return append(messages, model.Keyv[interface{}]{"role": "user", "content": prompt})
+}
+
+// 捕获适配器的输出并校验，失败时带上错误原因重试
+func formatCompletion(gtx *gin.Context, extension inter.Adapter, completion model.Completion) error {
+	retries := env.Env.GetInt("server.json-retries")
+	if retries <= 0 {
+		retries = 2
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		single := completion
+		single.Stream = false
+
+		cp := gtx.Copy()
+		cp.Set(vars.GinCompletion, single)
+		cp.Set(vars.GinMatchers, append(newMatchers(cp, false), &jsonMatcher{gtx: cp, format: single.ResponseFormat}))
+
+		conv := &formatConverter{}
+		w := newProtoWriter(&discardWriter{ResponseWriter: gtx.Writer, header: make(http.Header)}, conv)
+		cp.Writer = w
+		err := extension.Completion(cp)
+		w.Close()
+		if err != nil {
+			return err
+		}
+
+		if conv.message != "" {
+			response.Error(gtx, conv.code, conv.message)
+			return nil
+		}
+
+		lastErr, _ = common.GetGinValue[error](cp, ginFormatError)
+		if lastErr == nil && conv.content == "" {
+			lastErr = errors.New("empty response")
+		}
+
+		if lastErr == nil {
+			gtx.Set(vars.GinCompletionUsage, common.GetGinCompletionUsage(cp))
+			if completion.Stream {
+				created := time.Now().Unix()
+				response.SSEResponse(gtx, "", conv.content, created)
+				response.SSEResponse(gtx, "", "[DONE]", created)
+			} else {
+				response.Response(gtx, "", conv.content)
+			}
+			return nil
+		}
+
+		logger.Warnf("response_format validation failed (attempt %d): %v", attempt+1, lastErr)
+		completion.Messages = append(completion.Messages,
+			model.Keyv[interface{}]{"role": "assistant", "content": conv.content},
+			model.Keyv[interface{}]{"role": "user", "content": fmt.Sprintf(jsonRetryPrompt, lastErr)},
+		)
+	}
+
+	response.Error(gtx, http.StatusInternalServerError,
+		fmt.Sprintf("the model output does not match response_format after %d attempts: %v", retries+1, lastErr))
+	return nil
+}
+
+// 缓存全部输出，结束时提取、修复并校验 JSON
+type jsonMatcher struct {
+	gtx    *gin.Context
+	format *model.ResponseFormat
+	buffer string
+}
+
+func (m *jsonMatcher) Match(content string, over bool) (state int, result string) {
+	m.buffer += content
+	if !over {
+		return response.MatMatching, ""
+	}
+
+	text := m.buffer
+	m.buffer = ""
+	value, raw, err := jsonschema.Extract(text)
+	if err == nil {
+		err = m.validate(value)
+	}
+
+	if err != nil {
+		m.gtx.Set(ginFormatError, err)
+		return response.MatMatched, text
+	}
+	return response.MatMatched, raw
+}
+
+func (m *jsonMatcher) validate(value interface{}) error {
+	schema := m.format.JsonSchema
+	if m.format.Type == "json_object" || schema == nil || schema.Schema == nil {
+		if _, ok := value.(map[string]interface{}); !ok {
+			return errors.New("the output is not a JSON object")
+		}
+		return nil
+	}
+
+	if !schema.Strict {
+		return nil
+	}
+	return jsonschema.Validate(schema.Schema, value)
+}
+
+// 收集适配器的输出
+type formatConverter struct {
+	content string
+	code    int
+	message string
+}
+
+func (*formatConverter) ContentType() string { return "text/event-stream" }
+func (*formatConverter) Done(io.Writer)      {}
+
+func (c *formatConverter) Chunk(_ io.Writer, chunk model.Response) {
+	for _, choice := range chunk.Choices {
+		if choice.Index == 0 && choice.Delta != nil {
+			c.content += choice.Delta.Content
+		}
+	}
+}
+
+func (c *formatConverter) Response(_ io.Writer, resp model.Response) {
+	if message := resp.Choices[0].Message; message != nil {
+		c.content = message.Content
+	}
+}
+
+func (c *formatConverter) Error(_ io.Writer, code int, message string, _ bool) {
+	c.code = code
+	c.message = message
+}
@@ -0,0 +1,137 @@
+package gin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+)
+
+func TestInjectResponseFormat(t *testing.T) {
+	jsonObject := &model.ResponseFormat{Type: "json_object"}
+	tests := []struct {
+		name     string
+		format   *model.ResponseFormat
+		messages []model.Keyv[interface{}]
+		count    int
+		last     string
+	}{
+		{"no format", nil, []model.Keyv[interface{}]{{"role": "user", "content": "hi"}}, 1, "hi"},
+		{"text", &model.ResponseFormat{Type: "text"}, []model.Keyv[interface{}]{{"role": "user", "content": "hi"}}, 1, "hi"},
+		{"appended to the last user message", jsonObject, []model.Keyv[interface{}]{{"role": "user", "content": "hi"}}, 1, "hi\n\n" + jsonObjectPrompt},
+		{"new message after a tool result", jsonObject, []model.Keyv[interface{}]{{"role": "tool", "content": "sunny"}}, 2, jsonObjectPrompt},
+		{"new message after multimodal content", jsonObject, []model.Keyv[interface{}]{{"role": "user", "content": []interface{}{}}}, 2, jsonObjectPrompt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := tt.messages[0].Clone()
+			messages := injectResponseFormat(model.Completion{Messages: tt.messages, ResponseFormat: tt.format})
+			if len(messages) != tt.count || messages[len(messages)-1].GetString("content") != tt.last {
+				t.Errorf("messages = %v", messages)
+			}
+			if !jsonEqual(t, tt.messages[0], original) {
+				t.Error("the request messages were modified")
+			}
+		})
+	}
+
+	var format model.ResponseFormat
+	_ = json.Unmarshal([]byte(`{"type": "json_schema", "json_schema": {"name": "city", "schema": {"type": "object"}}}`), &format)
+	messages := injectResponseFormat(model.Completion{ResponseFormat: &format})
+	if content := messages[0].GetString("content"); !strings.Contains(content, "JSON Schema") || !strings.Contains(content, `"type": "object"`) {
+		t.Errorf("schema prompt = %s", content)
+	}
+}
+
+func jsonEqual(t *testing.T, a, b interface{}) bool {
+	t.Helper()
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
+
+func TestFormatCompletion(t *testing.T) {
+	withEnv(t, nil)
+	schema := `{"type": "json_schema", "json_schema": {"name": "city", "strict": true,
+		"schema": {"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}}}`
+
+	tests := []struct {
+		name    string
+		format  string
+		stream  bool
+		outputs []string
+		calls   int
+		content string
+		failed  bool
+	}{
+		{"markdown", `{"type": "json_object"}`, false, []string{"```json\n{\"city\": \"Paris\",}\n```"}, 1, `{"city": "Paris"}`, false},
+		{"retry", `{"type": "json_object"}`, false, []string{"Paris", `{"city": "Paris"}`}, 2, `{"city": "Paris"}`, false},
+		{"stream", `{"type": "json_object"}`, true, []string{`{"city": "Paris"}`}, 1, `{"city": "Paris"}`, false},
+		{"schema", schema, false, []string{`{"town": "Paris"}`, `{"city": "Paris"}`}, 2, `{"city": "Paris"}`, false},
+		{"schema retries exhausted", schema, false, []string{`{"town": "Paris"}`, `{"town": "Paris"}`, `{"town": "Paris"}`}, 3, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prompts []string
+			adapter := &fakeAdapter{models: []string{"test"}, completion: func(gtx *gin.Context) error {
+				completion := common.GetGinCompletion(gtx)
+				prompts = append(prompts, completion.Messages[len(completion.Messages)-1].GetString("content"))
+				output := tt.outputs[len(prompts)-1]
+
+				matchers := common.GetGinMatchers(gtx)
+				content := response.ExecMatchers(matchers, output, false) + response.ExecMatchers(matchers, "", true)
+				response.Response(gtx, "test", content)
+				return nil
+			}}
+			h := &Handler{extensions: []inter.Adapter{adapter}}
+
+			body := fmt.Sprintf(`{"model": "test", "stream": %t, "messages": [{"role": "user", "content": "where"}], "response_format": %s}`, tt.stream, tt.format)
+			gtx, w := newContext(http.MethodPost, "/v1/chat/completions", body)
+			h.completions(gtx)
+
+			if len(prompts) != tt.calls {
+				t.Fatalf("adapter called %d times, want %d", len(prompts), tt.calls)
+			}
+			for _, prompt := range prompts[1:] {
+				if !strings.HasPrefix(prompt, "Your previous response is not valid") {
+					t.Errorf("retry prompt = %q", prompt)
+				}
+			}
+
+			if tt.failed {
+				if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "after 3 attempts") {
+					t.Errorf("status = %d, body = %s", w.Code, w.Body)
+				}
+				return
+			}
+
+			content := ""
+			if tt.stream {
+				for _, e := range parseEvents(w.Body.String()) {
+					var chunk model.Response
+					if json.Unmarshal([]byte(e.data), &chunk) == nil && len(chunk.Choices) > 0 && chunk.Choices[0].Delta != nil {
+						content += chunk.Choices[0].Delta.Content
+					}
+				}
+			} else {
+				var resp model.Response
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("invalid response %s: %v", w.Body, err)
+				}
+				content = resp.Choices[0].Message.Content
+			}
+			if content != tt.content {
+				t.Errorf("content = %q, want %q", content, tt.content)
+			}
+		})
+	}
+}
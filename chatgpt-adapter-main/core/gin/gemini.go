@@ -0,0 +1,476 @@
+package gin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// 路径为 {model}:generateContent 或 {model}:streamGenerateContent
+//
+// @POST(path = "
+//
+//	v1beta/models/*action,
+//	v1/models/*action
+//
+// ")
+func (h *Handler) gemini(gtx *gin.Context) {
+	action := strings.TrimPrefix(gtx.Param("action"), "/")
+	idx := strings.LastIndex(action, ":")
+	if idx < 0 {
+		gtx.JSON(http.StatusNotFound, geminiError(http.StatusNotFound, fmt.Sprintf("unsupported path '%s'", gtx.Request.URL.Path)))
+		return
+	}
+
+	mod, method := action[:idx], action[idx+1:]
+	if method != "generateContent" && method != "streamGenerateContent" {
+		gtx.JSON(http.StatusNotFound, geminiError(http.StatusNotFound, fmt.Sprintf("unsupported method '%s'", method)))
+		return
+	}
+
+	conv := &geminiConverter{
+		gtx:   gtx,
+		id:    common.Hex(24),
+		model: mod,
+		sse:   gtx.Query("alt") == "sse",
+	}
+	withConverter(gtx, conv, func() {
+		var request model.GeminiCompletion
+		if err := gtx.BindJSON(&request); err != nil {
+			logger.Error(err)
+			response.Error(gtx, http.StatusBadRequest, err)
+			return
+		}
+
+		completion := convertGeminiRequest(request)
+		completion.Model = mod
+		completion.Stream = method == "streamGenerateContent"
+		h.relay(gtx, completion)
+	})
+}
+
+// 将 Gemini 请求转换为 model.Completion
+func convertGeminiRequest(request model.GeminiCompletion) (completion model.Completion) {
+	config := request.GenerationConfig
+	completion = model.Completion{
+		MaxTokens:     config.MaxOutputTokens,
+		StopSequences: config.StopSequences,
+		Temperature:   config.Temperature,
+		TopK:          config.TopK,
+		TopP:          config.TopP,
+	}
+
+	if request.SystemInstruction != nil {
+		if system := joinGeminiParts(request.SystemInstruction.GetSlice("parts")); system != "" {
+			completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+				"role": "system", "content": system,
+			})
+		}
+	}
+
+	// name => tool_call_id
+	toolIds := make(map[string]string)
+	for _, content := range request.Contents {
+		role := "user"
+		if content.Is("role", "model") {
+			role = "assistant"
+		}
+
+		var (
+			texts     []string
+			contents  []interface{}
+			toolCalls []interface{}
+			hasImage  = false
+		)
+		for _, value := range content.GetSlice("parts") {
+			var part model.Keyv[interface{}]
+			if part, _ = value.(map[string]interface{}); part == nil {
+				continue
+			}
+
+			switch {
+			case part.Is("thought", true):
+				continue
+
+			case part.Has("text"):
+				texts = append(texts, part.GetString("text"))
+				contents = append(contents, map[string]interface{}{
+					"type": "text", "text": part.GetString("text"),
+				})
+
+			case part.Has("inlineData"):
+				data := part.GetKeyv("inlineData")
+				hasImage = true
+				contents = append(contents, map[string]interface{}{
+					"type":      "image_url",
+					"image_url": map[string]interface{}{"url": "data:" + data.GetString("mimeType") + ";base64," + data.GetString("data")},
+				})
+
+			case part.Has("functionCall"):
+				fn := part.GetKeyv("functionCall")
+				toolId := fn.GetString("id")
+				if toolId == "" {
+					toolId = "call_" + common.Hex(5)
+				}
+
+				arguments, _ := json.Marshal(fn["args"])
+				toolIds[fn.GetString("name")] = toolId
+				toolCalls = append(toolCalls, map[string]interface{}{
+					"id":   toolId,
+					"type": "function",
+					"function": map[string]interface{}{
+						"name":      fn.GetString("name"),
+						"arguments": string(arguments),
+					},
+				})
+
+			case part.Has("functionResponse"):
+				fn := part.GetKeyv("functionResponse")
+				toolId := fn.GetString("id")
+				if toolId == "" {
+					toolId = toolIds[fn.GetString("name")]
+				}
+
+				output, _ := json.Marshal(fn["response"])
+				completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+					"role":         "tool",
+					"tool_call_id": toolId,
+					"name":         fn.GetString("name"),
+					"content":      string(output),
+				})
+			}
+		}
+
+		if len(toolCalls) > 0 {
+			completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+				"role": "assistant", "content": strings.Join(texts, "\n"), "tool_calls": toolCalls,
+			})
+			continue
+		}
+
+		if hasImage {
+			completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+				"role": role, "content": contents,
+			})
+			continue
+		}
+
+		if len(texts) > 0 {
+			completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+				"role": role, "content": strings.Join(texts, "\n"),
+			})
+		}
+	}
+
+	for _, tool := range request.Tools {
+		for _, value := range tool.GetSlice("functionDeclarations") {
+			var declaration model.Keyv[interface{}]
+			if declaration, _ = value.(map[string]interface{}); declaration == nil {
+				continue
+			}
+
+			parameters := declaration["parameters"]
+			if parameters == nil {
+				parameters = declaration["parametersJsonSchema"]
+			}
+			completion.Tools = append(completion.Tools, model.Keyv[interface{}]{
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":        declaration.GetString("name"),
+					"description": declaration.GetString("description"),
+					"parameters":  geminiSchema(parameters),
+				},
+			})
+		}
+	}
+
+	if request.ToolConfig != nil {
+		config := request.ToolConfig.GetKeyv("functionCallingConfig")
+		switch config.GetString("mode") {
+		case "NONE":
+			completion.ToolChoice = "none"
+		case "AUTO":
+			completion.ToolChoice = "auto"
+		case "ANY":
+			completion.ToolChoice = "required"
+			if names := config.GetSlice("allowedFunctionNames"); len(names) == 1 {
+				completion.ToolChoice = map[string]interface{}{
+					"type":     "function",
+					"function": map[string]interface{}{"name": names[0]},
+				}
+			}
+		}
+	}
+	return
+}
+
+func joinGeminiParts(parts []interface{}) string {
+	var texts []string
+	for _, value := range parts {
+		var part model.Keyv[interface{}]
+		if part, _ = value.(map[string]interface{}); part != nil && part.Has("text") {
+			texts = append(texts, part.GetString("text"))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// Gemini 的 Schema 类型为大写（OBJECT、STRING），转换为 JSON Schema 的小写形式
+func geminiSchema(value interface{}) interface{} {
+	switch schema := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(schema))
+		for k, v := range schema {
+			if str, ok := v.(string); ok && k == "type" {
+				result[k] = strings.ToLower(str)
+				continue
+			}
+			result[k] = geminiSchema(v)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(schema))
+		for i, v := range schema {
+			result[i] = geminiSchema(v)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+func geminiError(code int, message string) map[string]interface{} {
+	status := "INTERNAL"
+	switch code {
+	case http.StatusBadRequest:
+		status = "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		status = "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		status = "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		status = "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		status = "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		status = "UNAVAILABLE"
+	}
+
+	return map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"status":  status,
+		},
+	}
+}
+
+// OpenAI chat.completion => Gemini candidates 响应转换
+type geminiConverter struct {
+	gtx   *gin.Context
+	id    string
+	model string
+	sse   bool // alt=sse 时以 SSE 输出，否则输出 JSON 数组
+
+	count        int
+	output       string
+	toolCalls    []model.Keyv[interface{}]
+	finishReason string
+	usage        map[string]interface{}
+}
+
+func (c *geminiConverter) ContentType() string {
+	if c.sse {
+		return "text/event-stream"
+	}
+	return "application/json; charset=utf-8"
+}
+
+func (c *geminiConverter) Chunk(w io.Writer, chunk model.Response) {
+	if chunk.Usage != nil {
+		c.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			c.finishReason = *choice.FinishReason
+		}
+
+		delta := choice.Delta
+		if delta == nil {
+			continue
+		}
+
+		// 工具调用需要完整的参数，在结束时一并输出
+		for _, toolCall := range delta.ToolCalls {
+			fn := toolCall.GetKeyv("function")
+			if toolCall.Has("id") || len(c.toolCalls) == 0 {
+				c.toolCalls = append(c.toolCalls, model.Keyv[interface{}]{
+					"id":       toolCall.GetString("id"),
+					"function": map[string]interface{}{"name": fn.GetString("name"), "arguments": ""},
+				})
+			}
+
+			last := c.toolCalls[len(c.toolCalls)-1].GetKeyv("function")
+			last.Set("arguments", last.GetString("arguments")+fn.GetString("arguments"))
+		}
+
+		if delta.ReasoningContent != "" {
+			c.write(w, c.response([]interface{}{
+				map[string]interface{}{"text": delta.ReasoningContent, "thought": true},
+			}, false))
+		}
+
+		if delta.Content != "" {
+			c.output += delta.Content
+			c.write(w, c.response([]interface{}{
+				map[string]interface{}{"text": delta.Content},
+			}, false))
+		}
+	}
+}
+
+func (c *geminiConverter) Done(w io.Writer) {
+	parts := c.functionCalls()
+	if len(parts) == 0 {
+		parts = []interface{}{map[string]interface{}{"text": ""}}
+	}
+
+	c.write(w, c.response(parts, true))
+	if !c.sse {
+		if _, err := io.WriteString(w, "]"); err != nil {
+			logger.Error(err)
+		}
+	}
+}
+
+func (c *geminiConverter) Response(w io.Writer, resp model.Response) {
+	choice := resp.Choices[0]
+	if choice.FinishReason != nil {
+		c.finishReason = *choice.FinishReason
+	}
+
+	c.usage = resp.Usage
+	parts := make([]interface{}, 0)
+	if message := choice.Message; message != nil {
+		if message.ReasoningContent != "" {
+			parts = append(parts, map[string]interface{}{"text": message.ReasoningContent, "thought": true})
+		}
+
+		c.output = message.Content
+		if message.Content != "" {
+			parts = append(parts, map[string]interface{}{"text": message.Content})
+		}
+
+		for _, toolCall := range message.ToolCalls {
+			fn := toolCall.GetKeyv("function")
+			c.toolCalls = append(c.toolCalls, model.Keyv[interface{}]{
+				"id":       toolCall.GetString("id"),
+				"function": map[string]interface{}{"name": fn.GetString("name"), "arguments": fn.GetString("arguments")},
+			})
+		}
+		parts = append(parts, c.functionCalls()...)
+	}
+
+	writeJSON(w, c.response(parts, true))
+}
+
+func (c *geminiConverter) Error(w io.Writer, code int, message string, sse bool) {
+	if code < http.StatusBadRequest {
+		code = http.StatusInternalServerError
+	}
+
+	data := geminiError(code, message)
+	if sse {
+		c.write(w, data)
+		return
+	}
+	writeJSON(w, data)
+}
+
+func (c *geminiConverter) write(w io.Writer, data interface{}) {
+	if c.sse {
+		writeEvent(w, "", data)
+		return
+	}
+
+	separator := ","
+	if c.count == 0 {
+		separator = "["
+	}
+	c.count++
+
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	if _, err = fmt.Fprintf(w, "%s%s\n", separator, bytes); err != nil {
+		logger.Error(err)
+	}
+}
+
+// Gemini 的工具参数为 JSON 对象
+func (c *geminiConverter) functionCalls() (parts []interface{}) {
+	for _, toolCall := range c.toolCalls {
+		fn := toolCall.GetKeyv("function")
+		var args interface{} = map[string]interface{}{}
+		if str := fn.GetString("arguments"); str != "" {
+			if err := json.Unmarshal([]byte(str), &args); err != nil {
+				logger.Error(err)
+			}
+		}
+
+		parts = append(parts, map[string]interface{}{
+			"functionCall": map[string]interface{}{
+				"id":   toolCall.GetString("id"),
+				"name": fn.GetString("name"),
+				"args": args,
+			},
+		})
+	}
+	return
+}
+
+func (c *geminiConverter) response(parts []interface{}, done bool) model.GeminiResponse {
+	candidate := model.GeminiCandidate{}
+	candidate.Content.Role = "model"
+	candidate.Content.Parts = parts
+	if done {
+		candidate.FinishReason = "STOP"
+		if c.finishReason == "length" {
+			candidate.FinishReason = "MAX_TOKENS"
+		}
+	}
+
+	resp := model.GeminiResponse{
+		Candidates:   []model.GeminiCandidate{candidate},
+		ModelVersion: c.model,
+		ResponseId:   c.id,
+	}
+	if done {
+		resp.UsageMetadata = c.calcUsage()
+	}
+	return resp
+}
+
+func (c *geminiConverter) calcUsage() map[string]int {
+	promptTokens, completionTokens := usageTokens(c.gtx, c.usage, c.output)
+	return map[string]int{
+		"promptTokenCount":     promptTokens,
+		"candidatesTokenCount": completionTokens,
+		"totalTokenCount":      promptTokens + completionTokens,
+	}
+}
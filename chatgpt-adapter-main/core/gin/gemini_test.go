@@ -0,0 +1,145 @@
+package gin
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConvertGeminiRequest(t *testing.T) {
+	var request model.GeminiCompletion
+	err := json.Unmarshal([]byte(`{
+		"systemInstruction": {"parts": [{"text": "be brief"}]},
+		"contents": [
+			{"role": "user", "parts": [{"text": "what is this"}, {"inlineData": {"mimeType": "image/png", "data": "AAA"}}]},
+			{"role": "model", "parts": [{"text": "hmm", "thought": true}, {"functionCall": {"name": "weather", "args": {"city": "Paris"}}}]},
+			{"role": "user", "parts": [{"functionResponse": {"name": "weather", "response": {"sky": "sunny"}}}]}
+		],
+		"tools": [{"functionDeclarations": [{"name": "weather", "parameters": {"type": "OBJECT", "properties": {"city": {"type": "STRING"}}}}]}],
+		"toolConfig": {"functionCallingConfig": {"mode": "ANY", "allowedFunctionNames": ["weather"]}},
+		"generationConfig": {"maxOutputTokens": 32, "stopSequences": ["END"]}
+	}`), &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	completion := convertGeminiRequest(request)
+	if completion.MaxTokens != 32 || !reflect.DeepEqual(completion.StopSequences, []string{"END"}) {
+		t.Errorf("completion = %+v", completion)
+	}
+
+	messages := completion.Messages
+	if len(messages) != 4 || messages[0].GetString("content") != "be brief" {
+		t.Fatalf("messages = %v", messages)
+	}
+	if image := messages[1].GetSlice("content")[1].(map[string]interface{})["image_url"]; !reflect.DeepEqual(image, map[string]interface{}{"url": "data:image/png;base64,AAA"}) {
+		t.Errorf("image = %v", image)
+	}
+
+	// 思考内容被忽略，工具结果按名称关联到调用 id
+	call := messages[2].GetSlice("tool_calls")[0].(map[string]interface{})
+	if messages[2].GetString("content") != "" || call["function"].(map[string]interface{})["arguments"] != `{"city":"Paris"}` {
+		t.Errorf("tool call = %v", messages[2])
+	}
+	if messages[3].GetString("tool_call_id") != call["id"] || messages[3].GetString("content") != `{"sky":"sunny"}` {
+		t.Errorf("tool result = %v, want id %v", messages[3], call["id"])
+	}
+
+	parameters := completion.Tools[0].GetKeyv("function")["parameters"]
+	if want := map[string]interface{}{"type": "object", "properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}}}; !reflect.DeepEqual(parameters, want) {
+		t.Errorf("parameters = %v, want %v", parameters, want)
+	}
+	if want := map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "weather"}}; !reflect.DeepEqual(completion.ToolChoice, want) {
+		t.Errorf("tool_choice = %v, want %v", completion.ToolChoice, want)
+	}
+}
+
+func TestGemini(t *testing.T) {
+	withEnv(t, nil)
+	h := &Handler{extensions: []inter.Adapter{&fakeAdapter{models: []string{"test"}, completion: func(gtx *gin.Context) error {
+		if !common.GetGinCompletion(gtx).Stream {
+			response.Response(gtx, "test", "hello")
+			return nil
+		}
+		created := time.Now().Unix()
+		response.SSEResponse(gtx, "test", "hello", created)
+		response.SSEToolCallsResponse(gtx, "test", []response.ToolCall{{Name: "weather", Arguments: `{"city": "Paris"}`}}, created)
+		return nil
+	}}}}
+	body := `{"contents": [{"role": "user", "parts": [{"text": "hi"}]}]}`
+
+	request := func(path string) (string, int) {
+		gtx, w := newContext(http.MethodPost, path, body)
+		action, _ := strings.CutPrefix(gtx.Request.URL.Path, "/v1beta/models")
+		gtx.Params = gin.Params{{Key: "action", Value: action}}
+		h.gemini(gtx)
+		return w.Body.String(), w.Code
+	}
+
+	t.Run("generate", func(t *testing.T) {
+		body, _ := request("/v1beta/models/test:generateContent")
+		var resp model.GeminiResponse
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			t.Fatalf("invalid response %s: %v", body, err)
+		}
+		candidate := resp.Candidates[0]
+		if candidate.FinishReason != "STOP" || !reflect.DeepEqual(candidate.Content.Parts, []interface{}{map[string]interface{}{"text": "hello"}}) ||
+			resp.ModelVersion != "test" || resp.UsageMetadata["totalTokenCount"] == 0 {
+			t.Errorf("response = %s", body)
+		}
+	})
+
+	check := func(t *testing.T, chunks []model.GeminiResponse) {
+		t.Helper()
+		if len(chunks) < 2 {
+			t.Fatalf("chunks = %+v", chunks)
+		}
+		if parts := chunks[0].Candidates[0].Content.Parts; parts[0].(map[string]interface{})["text"] != "hello" {
+			t.Errorf("first chunk = %+v", chunks[0])
+		}
+
+		last := chunks[len(chunks)-1].Candidates[0]
+		fn := last.Content.Parts[0].(map[string]interface{})["functionCall"].(map[string]interface{})
+		if last.FinishReason != "STOP" || fn["name"] != "weather" || !reflect.DeepEqual(fn["args"], map[string]interface{}{"city": "Paris"}) {
+			t.Errorf("last chunk = %+v", last)
+		}
+	}
+
+	t.Run("stream array", func(t *testing.T) {
+		body, _ := request("/v1beta/models/test:streamGenerateContent")
+		var chunks []model.GeminiResponse
+		if err := json.Unmarshal([]byte(body), &chunks); err != nil {
+			t.Fatalf("invalid array %s: %v", body, err)
+		}
+		check(t, chunks)
+	})
+
+	t.Run("stream sse", func(t *testing.T) {
+		body, _ := request("/v1beta/models/test:streamGenerateContent?alt=sse")
+		var chunks []model.GeminiResponse
+		for _, e := range parseEvents(body) {
+			var chunk model.GeminiResponse
+			if err := json.Unmarshal([]byte(e.data), &chunk); err != nil {
+				t.Fatalf("invalid event %s: %v", e.data, err)
+			}
+			chunks = append(chunks, chunk)
+		}
+		check(t, chunks)
+	})
+
+	t.Run("unsupported method", func(t *testing.T) {
+		body, code := request("/v1beta/models/test:countTokens")
+		if code != http.StatusNotFound || !strings.Contains(body, "NOT_FOUND") {
+			t.Errorf("status = %d, body = %s", code, body)
+		}
+	})
+}
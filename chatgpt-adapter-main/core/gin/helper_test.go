@@ -0,0 +1,111 @@
+package gin
+
+import (
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+	"github.com/spf13/viper"
+)
+
+// 以空配置执行初始化，与不配置任何可选项启动时一致
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	env.Env = &env.Environment{Viper: viper.New()}
+	inited.Initialized(env.Env)
+	os.Exit(m.Run())
+}
+
+// 测试使用的配置，结束后恢复
+func withEnv(t *testing.T, values map[string]interface{}) {
+	t.Helper()
+	old := env.Env
+	v := viper.New()
+	for key, value := range values {
+		v.Set(key, value)
+	}
+	env.Env = &env.Environment{Viper: v}
+	t.Cleanup(func() { env.Env = old })
+}
+
+// 按模型名匹配的适配器，completion 为空时不输出
+type fakeAdapter struct {
+	inter.BaseAdapter
+	models     []string
+	completion func(gtx *gin.Context) error
+	toolChoice func(gtx *gin.Context) (bool, error)
+}
+
+func (a *fakeAdapter) Match(_ *gin.Context, mod string) (bool, error) {
+	return slices.Contains(a.models, mod), nil
+}
+
+func (a *fakeAdapter) Models() (models []model.Model) {
+	for _, mod := range a.models {
+		models = append(models, model.Model{Id: mod, Object: "model", Created: 1700000000, By: "test"})
+	}
+	return
+}
+
+func (a *fakeAdapter) Completion(gtx *gin.Context) error {
+	if a.completion == nil {
+		return nil
+	}
+	return a.completion(gtx)
+}
+
+func (a *fakeAdapter) ToolChoice(gtx *gin.Context) (bool, error) {
+	if a.toolChoice == nil {
+		return false, nil
+	}
+	return a.toolChoice(gtx)
+}
+
+func newContext(method, path, body string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	gtx, _ := gin.CreateTestContext(w)
+	gtx.Request = httptest.NewRequest(method, path, strings.NewReader(body))
+	gtx.Request.Header.Set("Content-Type", "application/json")
+	return gtx, w
+}
+
+// 模拟认证通过的网关密钥
+func withKey(t *testing.T, gtx *gin.Context, key *model.ApiKey) {
+	t.Helper()
+	if err := key.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	gtx.Set(vars.GinApiKey, key)
+}
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+// 解析 SSE 响应中的事件，没有 event 字段时名称为空
+func parseEvents(body string) (events []sseEvent) {
+	for _, block := range strings.Split(body, "\n\n") {
+		var e sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event:"); ok {
+				e.name = strings.TrimSpace(name)
+			}
+			if data, ok := strings.CutPrefix(line, "data:"); ok {
+				e.data += strings.TrimSpace(data)
+			}
+		}
+		if e.name != "" || e.data != "" {
+			events = append(events, e)
+		}
+	}
+	return
+}
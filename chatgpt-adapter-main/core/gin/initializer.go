@@ -30,6 +30,7 @@ func Initialized(env *env.Environment) sdk.Initializer {
 				engine.Use(gin.Recovery())
 				engine.Use(cros)
 				engine.Use(token)
+				engine.Use(auth)
 			}
 			engine.Static("/file/", "tmp")
 			beans := sdk.ListInvokeAs[router.Router](container)
@@ -48,6 +49,13 @@ func token(gtx *gin.Context) {
 	if str == "" {
 		str = strings.TrimPrefix(gtx.Request.Header.Get("Authorization"), "Bearer ")
 	}
+	// Gemini SDK
+	if str == "" {
+		str = gtx.Request.Header.Get("X-Goog-Api-Key")
+	}
+	if str == "" {
+		str = gtx.Query("key")
+	}
 	gtx.Set("token", str)
 }
 
@@ -70,6 +78,8 @@ func cros(gtx *gin.Context) {
 	if gtx.Request.RequestURI == "/" ||
 		gtx.Request.RequestURI == "/favicon.ico" ||
 		strings.Contains(gtx.Request.URL.Path, "/v1/models") ||
+		strings.HasPrefix(gtx.Request.URL.Path, "/api/tags") ||
+		strings.HasPrefix(gtx.Request.URL.Path, "/metrics") ||
 		strings.HasPrefix(gtx.Request.URL.Path, "/file/") {
 		// 处理请求
 		gtx.Next()
@@ -0,0 +1,205 @@
+package gin
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/common/quota"
+	"chatgpt-adapter/core/common/ratelimit"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+)
+
+// 按模型配置的限额
+type modelLimit struct {
+	ratelimit.Limit `mapstructure:",squash"`
+	Model           string `mapstructure:"model"`
+
+	regexp *regexp.Regexp
+}
+
+const (
+	ginLimited        = "__limited__"
+	ginLimitedAccount = "__limited_account__"
+)
+
+var modelLimits []modelLimit
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		if err := env.UnmarshalKey("ratelimit.models", &modelLimits); err != nil {
+			logger.Fatal(err)
+		}
+
+		for i := range modelLimits {
+			compile, err := regexp.Compile(modelLimits[i].Model)
+			if err != nil {
+				logger.Fatalf("failed to compile ratelimit.models[%d]: %v", i, err)
+			}
+			modelLimits[i].regexp = compile
+		}
+	})
+}
+
+// 密钥的标识，使用哈希避免暴露密钥
+func keyId(key *model.ApiKey) string {
+	return common.CalcHex(key.Key)[:12]
+}
+
+// 请求涉及的限额范围：网关密钥、模型，以及直接使用的上游凭证
+func scopesOf(gtx *gin.Context, mod string) (scopes []ratelimit.Scope) {
+	if key, ok := common.GetGinValue[*model.ApiKey](gtx, vars.GinApiKey); ok {
+		scopes = append(scopes, ratelimit.Scope{
+			Name:  "key",
+			Key:   keyId(key),
+			Limit: ratelimit.Limit{RPM: key.RPM, TPD: key.TPD},
+		})
+	}
+
+	for _, l := range modelLimits {
+		if l.regexp.MatchString(mod) {
+			scopes = append(scopes, ratelimit.Scope{Name: "model", Key: mod, Limit: l.Limit})
+			break
+		}
+	}
+
+	// 使用账号池时由 PollContainer 检查
+	if id := tokenAccount(gtx); id != "" {
+		scopes = append(scopes, ratelimit.Account(id))
+	}
+	return
+}
+
+// 检查并消耗限额，n 为上游请求数，通过时返回请求结束后扣除 token 的函数
+func limit(gtx *gin.Context, mod string, n int) (settle func(), ok bool) {
+	// 文本补全转换为对话补全时已经检查过
+	if gtx.GetBool(ginLimited) {
+		return func() {}, true
+	}
+	gtx.Set(ginLimited, true)
+
+	scopes := scopesOf(gtx, mod)
+	st, ok := ratelimit.AcquireN(max(1, n), scopes...)
+	rateHeaders(gtx, st)
+	if !ok {
+		rateLimited(gtx, st)
+		return
+	}
+	gtx.Set(ginLimitedAccount, tokenAccount(gtx))
+
+	settle = func() {
+		if id := accountOf(gtx); id != "" && id != gtx.GetString(ginLimitedAccount) {
+			scopes = append(scopes, ratelimit.Account(id))
+		}
+		promptTokens, completionTokens := usageTokens(gtx, common.GetGinCompletionUsage(gtx), "")
+		ratelimit.Charge(promptTokens+completionTokens, scopes...)
+		quota.Consume(accountOf(gtx), promptTokens+completionTokens)
+	}
+	return
+}
+
+// 别名路由的目标使用了另一个上游凭证时，检查该凭证的限额。超出时返回 429，路由会换下一个模型
+func limitAccount(gtx *gin.Context) bool {
+	id := tokenAccount(gtx)
+	if id == "" || id == gtx.GetString(ginLimitedAccount) {
+		return true
+	}
+
+	st, ok := ratelimit.Acquire(ratelimit.Account(id))
+	if !ok {
+		rateLimited(gtx, st)
+		return false
+	}
+	gtx.Set(ginLimitedAccount, id)
+	return true
+}
+
+func rateHeaders(gtx *gin.Context, st ratelimit.Status) {
+	header := gtx.Writer.Header()
+	if st.Requests > 0 {
+		header.Set("x-ratelimit-limit-requests", strconv.Itoa(st.Requests))
+		header.Set("x-ratelimit-remaining-requests", strconv.Itoa(max(0, st.RemainingRequests)))
+		header.Set("x-ratelimit-reset-requests", resetOf(st.ResetRequests))
+	}
+	if st.Tokens > 0 {
+		header.Set("x-ratelimit-limit-tokens", strconv.Itoa(st.Tokens))
+		header.Set("x-ratelimit-remaining-tokens", strconv.Itoa(max(0, st.RemainingTokens)))
+		header.Set("x-ratelimit-reset-tokens", resetOf(st.ResetTokens))
+	}
+}
+
+func resetOf(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
+
+func rateLimited(gtx *gin.Context, st ratelimit.Status) {
+	kind, limit, unit := "requests", st.Requests, "RPM"
+	if st.RemainingRequests > 0 || st.Requests == 0 {
+		kind, limit, unit = "tokens", st.Tokens, "TPD"
+	}
+
+	gtx.Header("Retry-After", strconv.Itoa(int(math.Ceil(st.RetryAfter.Seconds()))))
+	gtx.JSON(http.StatusTooManyRequests, gin.H{
+		"error": map[string]string{
+			"message": fmt.Sprintf("Rate limit reached for %s %s on %s: Limit %d. Please try again in %s.",
+				st.Scope.Name, st.Scope.Key, kind, limit, resetOf(st.RetryAfter)),
+			"type": kind,
+			"code": "rate_limit_exceeded",
+		},
+	})
+	logger.Warnf("rate limit reached: %s:%s %s %d", st.Scope.Name, st.Scope.Key, unit, limit)
+}
+
+func rateSnapshot(statuses []ratelimit.Status) []map[string]interface{} {
+	data := make([]map[string]interface{}, 0, len(statuses))
+	for _, st := range statuses {
+		item := map[string]interface{}{
+			"scope": st.Scope.Name,
+			"key":   st.Scope.Key,
+		}
+		if st.Requests > 0 {
+			item["requests"] = map[string]interface{}{
+				"limit":     st.Requests,
+				"remaining": max(0, st.RemainingRequests),
+				"reset":     resetOf(st.ResetRequests),
+			}
+		}
+		if st.Tokens > 0 {
+			item["tokens"] = map[string]interface{}{
+				"limit":     st.Tokens,
+				"remaining": st.RemainingTokens,
+				"reset":     resetOf(st.ResetTokens),
+			}
+		}
+		data = append(data, item)
+	}
+	return data
+}
+
+// @GET(path = "v1/ratelimit")
+func (h *Handler) rateLimits(gtx *gin.Context) {
+	key, ok := common.GetGinValue[*model.ApiKey](gtx, vars.GinApiKey)
+	if !ok {
+		response.Error(gtx, http.StatusNotFound, "the api key is not configured")
+		return
+	}
+
+	// 只返回当前密钥的限额
+	statuses := ratelimit.Snapshot("key")
+	statuses = slices.DeleteFunc(statuses, func(st ratelimit.Status) bool { return st.Scope.Key != keyId(key) })
+	gtx.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   rateSnapshot(statuses),
+	})
+}
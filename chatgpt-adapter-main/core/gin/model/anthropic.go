@@ -0,0 +1,27 @@
+package model
+
+type AnthropicCompletion struct {
+	Model         string              `json:"model"`
+	System        interface{}         `json:"system,omitempty"`
+	Messages      []Keyv[interface{}] `json:"messages"`
+	Tools         []Keyv[interface{}] `json:"tools,omitempty"`
+	ToolChoice    Keyv[interface{}]   `json:"tool_choice,omitempty"`
+	MaxTokens     int                 `json:"max_tokens"`
+	StopSequences []string            `json:"stop_sequences,omitempty"`
+	Temperature   float32             `json:"temperature"`
+	TopK          int                 `json:"top_k,omitempty"`
+	TopP          float32             `json:"top_p,omitempty"`
+	Stream        bool                `json:"stream,omitempty"`
+	Metadata      Keyv[interface{}]   `json:"metadata,omitempty"`
+}
+
+type AnthropicResponse struct {
+	Id           string              `json:"id"`
+	Type         string              `json:"type"`
+	Role         string              `json:"role"`
+	Model        string              `json:"model"`
+	Content      []Keyv[interface{}] `json:"content"`
+	StopReason   *string             `json:"stop_reason"`
+	StopSequence *string             `json:"stop_sequence"`
+	Usage        map[string]int      `json:"usage"`
+}
@@ -0,0 +1,31 @@
+package model
+
+type GeminiCompletion struct {
+	Contents          []Keyv[interface{}] `json:"contents"`
+	SystemInstruction Keyv[interface{}]   `json:"systemInstruction,omitempty"`
+	Tools             []Keyv[interface{}] `json:"tools,omitempty"`
+	ToolConfig        Keyv[interface{}]   `json:"toolConfig,omitempty"`
+	GenerationConfig  struct {
+		Temperature     float32  `json:"temperature,omitempty"`
+		TopP            float32  `json:"topP,omitempty"`
+		TopK            int      `json:"topK,omitempty"`
+		MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+		StopSequences   []string `json:"stopSequences,omitempty"`
+	} `json:"generationConfig,omitempty"`
+}
+
+type GeminiResponse struct {
+	Candidates    []GeminiCandidate `json:"candidates"`
+	UsageMetadata map[string]int    `json:"usageMetadata"`
+	ModelVersion  string            `json:"modelVersion"`
+	ResponseId    string            `json:"responseId"`
+}
+
+type GeminiCandidate struct {
+	Content struct {
+		Role  string        `json:"role"`
+		Parts []interface{} `json:"parts"`
+	} `json:"content"`
+	FinishReason string `json:"finishReason,omitempty"`
+	Index        int    `json:"index"`
+}
@@ -0,0 +1,85 @@
+package model
+
+import (
+	"regexp"
+	"slices"
+	"time"
+)
+
+// ApiKey 网关下发的访问密钥，认证通过后保存在 gin.Context 的 vars.GinApiKey 中
+type ApiKey struct {
+	Key      string    `mapstructure:"key" json:"-"`
+	Label    string    `mapstructure:"label" json:"label,omitempty"`
+	Tenant   string    `mapstructure:"tenant" json:"tenant,omitempty"`
+	Models   []string  `mapstructure:"models" json:"models,omitempty"`     // 允许的模型，匹配完整模型名的正则表达式，为空时不限制
+	Adapters []string  `mapstructure:"adapters" json:"adapters,omitempty"` // 允许的适配器，为空时不限制
+	RPM      int       `mapstructure:"rpm" json:"rpm,omitempty"`           // 每分钟请求数，0 为不限制
+	TPD      int       `mapstructure:"tpd" json:"tpd,omitempty"`           // 每天 token 数，0 为不限制
+	Expires  time.Time `mapstructure:"-" json:"expires,omitempty"`
+
+	// 上游凭证，按模型匹配，都不匹配时 Pool 为 true 则使用账号池
+	Credentials []Credential `mapstructure:"credentials" json:"-"`
+	Pool        bool         `mapstructure:"pool" json:"pool"`
+
+	regexps []*regexp.Regexp
+}
+
+type Credential struct {
+	Models string `mapstructure:"models"`
+	Token  string `mapstructure:"token"`
+
+	regexp *regexp.Regexp
+}
+
+// Compile 预编译模型的正则表达式，表达式需要匹配完整的模型名，避免 gpt-4 匹配到 gpt-4o
+func (k *ApiKey) Compile() (err error) {
+	k.regexps = nil
+	for _, pattern := range k.Models {
+		compile, e := anchored(pattern)
+		if e != nil {
+			return e
+		}
+		k.regexps = append(k.regexps, compile)
+	}
+
+	for i := range k.Credentials {
+		if k.Credentials[i].regexp, err = anchored(k.Credentials[i].Models); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func anchored(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+func (k *ApiKey) Expired() bool {
+	return !k.Expires.IsZero() && time.Now().After(k.Expires)
+}
+
+func (k *ApiKey) AllowModel(mod string) bool {
+	if len(k.regexps) == 0 {
+		return true
+	}
+	for _, compile := range k.regexps {
+		if compile.MatchString(mod) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *ApiKey) AllowAdapter(adapter string) bool {
+	return len(k.Adapters) == 0 || slices.Contains(k.Adapters, adapter)
+}
+
+// Credential 模型对应的上游凭证
+func (k *ApiKey) Credential(mod string) (token string, ok bool) {
+	for _, credential := range k.Credentials {
+		if credential.regexp != nil && credential.regexp.MatchString(mod) {
+			return credential.Token, true
+		}
+	}
+	return
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApiKeyAllowModel(t *testing.T) {
+	key := ApiKey{Models: []string{"gpt-4", "claude-.*", "o1|o3"}}
+	if err := key.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"gpt-4":           true,
+		"gpt-4o":          false, // 需要匹配完整的模型名
+		"my-gpt-4":        false,
+		"claude-3-sonnet": true,
+		"o1":              true,
+		"o3":              true,
+		"o3-mini":         false,
+	}
+	for mod, want := range tests {
+		if got := key.AllowModel(mod); got != want {
+			t.Errorf("AllowModel(%q) = %v, want %v", mod, got, want)
+		}
+	}
+
+	if !(&ApiKey{}).AllowModel("anything") {
+		t.Error("a key without models should allow every model")
+	}
+	if err := (&ApiKey{Models: []string{"gpt-("}}).Compile(); err == nil {
+		t.Error("an invalid pattern should fail to compile")
+	}
+}
+
+func TestApiKeyCredential(t *testing.T) {
+	key := ApiKey{Credentials: []Credential{
+		{Models: "claude-.*", Token: "claude-cookie"},
+		{Models: "gpt-4o|o1", Token: "openai-token"},
+	}}
+	if err := key.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		mod   string
+		token string
+		ok    bool
+	}{
+		{"claude-3-opus", "claude-cookie", true},
+		{"o1", "openai-token", true},
+		{"gpt-4o-mini", "", false},
+		{"coze/gpt-4o", "", false},
+	}
+	for _, tt := range tests {
+		if token, ok := key.Credential(tt.mod); token != tt.token || ok != tt.ok {
+			t.Errorf("Credential(%q) = %q, %v; want %q, %v", tt.mod, token, ok, tt.token, tt.ok)
+		}
+	}
+}
+
+func TestApiKeyAllowAdapter(t *testing.T) {
+	key := ApiKey{Adapters: []string{"cursor", "coze"}}
+	if !key.AllowAdapter("coze") || key.AllowAdapter("bing") {
+		t.Error("AllowAdapter should only allow the configured adapters")
+	}
+	if !(&ApiKey{}).AllowAdapter("bing") {
+		t.Error("a key without adapters should allow every adapter")
+	}
+}
+
+func TestApiKeyExpired(t *testing.T) {
+	if (&ApiKey{}).Expired() {
+		t.Error("a key without expiry should never expire")
+	}
+	if !(&ApiKey{Expires: time.Now().Add(-time.Second)}).Expired() {
+		t.Error("the key should have expired")
+	}
+	if (&ApiKey{Expires: time.Now().Add(time.Hour)}).Expired() {
+		t.Error("the key should not have expired yet")
+	}
+}
@@ -0,0 +1,45 @@
+package model
+
+type OllamaChat struct {
+	Model    string              `json:"model"`
+	Messages []Keyv[interface{}] `json:"messages"`
+	Tools    []Keyv[interface{}] `json:"tools,omitempty"`
+	Options  OllamaOptions       `json:"options,omitempty"`
+	Stream   *bool               `json:"stream,omitempty"`
+}
+
+type OllamaGenerate struct {
+	Model   string        `json:"model"`
+	Prompt  string        `json:"prompt"`
+	Suffix  string        `json:"suffix,omitempty"`
+	System  string        `json:"system,omitempty"`
+	Images  []string      `json:"images,omitempty"`
+	Options OllamaOptions `json:"options,omitempty"`
+	Stream  *bool         `json:"stream,omitempty"`
+}
+
+type OllamaOptions struct {
+	Temperature float32  `json:"temperature,omitempty"`
+	TopK        int      `json:"top_k,omitempty"`
+	TopP        float32  `json:"top_p,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+type OllamaModel struct {
+	Name       string             `json:"name"`
+	Model      string             `json:"model"`
+	ModifiedAt string             `json:"modified_at"`
+	Size       int64              `json:"size"`
+	Digest     string             `json:"digest"`
+	Details    OllamaModelDetails `json:"details"`
+}
+
+type OllamaModelDetails struct {
+	ParentModel       string   `json:"parent_model"`
+	Format            string   `json:"format"`
+	Family            string   `json:"family"`
+	Families          []string `json:"families"`
+	ParameterSize     string   `json:"parameter_size"`
+	QuantizationLevel string   `json:"quantization_level"`
+}
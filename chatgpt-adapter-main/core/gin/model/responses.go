@@ -0,0 +1,18 @@
+package model
+
+type ResponsesCompletion struct {
+	Model              string              `json:"model"`
+	Input              interface{}         `json:"input"`
+	Instructions       string              `json:"instructions,omitempty"`
+	Tools              []Keyv[interface{}] `json:"tools,omitempty"`
+	ToolChoice         interface{}         `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool               `json:"parallel_tool_calls,omitempty"`
+	PreviousResponseId string              `json:"previous_response_id,omitempty"`
+	MaxOutputTokens    int                 `json:"max_output_tokens,omitempty"`
+	Temperature        *float32            `json:"temperature,omitempty"`
+	TopP               *float32            `json:"top_p,omitempty"`
+	Stream             bool                `json:"stream,omitempty"`
+	Store              *bool               `json:"store,omitempty"`
+	Metadata           Keyv[interface{}]   `json:"metadata,omitempty"`
+	User               string              `json:"user,omitempty"`
+}
@@ -19,6 +19,39 @@ type Completion struct {
 	TopP          float32             `json:"top_p,omitempty"`
 	Stream        bool                `json:"stream,omitempty"`
 	ToolChoice    interface{}         `json:"tool_choice,omitempty"`
+	StreamOptions *StreamOptions      `json:"stream_options,omitempty"`
+	N             int                 `json:"n,omitempty"`
+	User          string              `json:"user,omitempty"`
+
+	ParallelToolCalls *bool           `json:"parallel_tool_calls,omitempty"`
+	ResponseFormat    *ResponseFormat `json:"response_format,omitempty"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type ResponseFormat struct {
+	Type       string `json:"type"`
+	JsonSchema *struct {
+		Name        string      `json:"name"`
+		Description string      `json:"description,omitempty"`
+		Schema      interface{} `json:"schema,omitempty"`
+		Strict      bool        `json:"strict,omitempty"`
+	} `json:"json_schema,omitempty"`
+}
+
+type TextCompletion struct {
+	Model       string      `json:"model"`
+	Prompt      interface{} `json:"prompt"`
+	Suffix      string      `json:"suffix,omitempty"`
+	Echo        bool        `json:"echo,omitempty"`
+	MaxTokens   int         `json:"max_tokens"`
+	Stop        interface{} `json:"stop,omitempty"`
+	Temperature float32     `json:"temperature"`
+	TopP        float32     `json:"top_p,omitempty"`
+	Stream      bool        `json:"stream,omitempty"`
+	User        string      `json:"user,omitempty"`
 }
 
 type Generation struct {
@@ -48,7 +81,8 @@ type Response struct {
 		Message string `json:"message"`
 		Type    string `json:"type"`
 	} `json:"error,omitempty"`
-	Usage map[string]interface{} `json:"usage,omitempty"`
+	Usage             map[string]interface{} `json:"usage,omitempty"`
+	SystemFingerprint string                 `json:"system_fingerprint,omitempty"`
 }
 
 type Choice struct {
@@ -70,3 +104,19 @@ type Choice struct {
 	} `json:"delta,omitempty"`
 	FinishReason *string `json:"finish_reason"`
 }
+
+type TextResponse struct {
+	Id      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []TextChoice           `json:"choices"`
+	Usage   map[string]interface{} `json:"usage,omitempty"`
+}
+
+type TextChoice struct {
+	Index        int         `json:"index"`
+	Text         string      `json:"text"`
+	Logprobs     interface{} `json:"logprobs"`
+	FinishReason *string     `json:"finish_reason"`
+}
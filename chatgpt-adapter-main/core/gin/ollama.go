@@ -0,0 +1,437 @@
+package gin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// @POST(path = "api/chat")
+func (h *Handler) ollamaChat(gtx *gin.Context) {
+	conv := newOllamaConverter(gtx, "message")
+	withConverter(gtx, conv, func() {
+		var request model.OllamaChat
+		if err := gtx.BindJSON(&request); err != nil {
+			logger.Error(err)
+			response.Error(gtx, http.StatusBadRequest, err)
+			return
+		}
+
+		conv.model = request.Model
+		h.relay(gtx, convertOllamaChat(request))
+	})
+}
+
+// @POST(path = "api/generate")
+func (h *Handler) ollamaGenerate(gtx *gin.Context) {
+	conv := newOllamaConverter(gtx, "response")
+	withConverter(gtx, conv, func() {
+		var request model.OllamaGenerate
+		if err := gtx.BindJSON(&request); err != nil {
+			logger.Error(err)
+			response.Error(gtx, http.StatusBadRequest, err)
+			return
+		}
+
+		conv.model = request.Model
+
+		// 空的 prompt 仅用于加载模型
+		if request.Prompt == "" && request.Suffix == "" {
+			conv.finishReason = "load"
+			gtx.JSON(http.StatusOK, conv.response(nil, true))
+			return
+		}
+		h.relay(gtx, convertOllamaGenerate(request))
+	})
+}
+
+// @GET(path = "api/tags")
+func (h *Handler) ollamaTags(gtx *gin.Context) {
+	models := make([]model.OllamaModel, 0)
+	for _, extension := range h.extensions {
+		for _, mod := range extension.Models() {
+			models = append(models, ollamaModel(mod))
+		}
+	}
+	gtx.JSON(http.StatusOK, gin.H{
+		"models": models,
+	})
+}
+
+// @POST(path = "api/show")
+func (h *Handler) ollamaShow(gtx *gin.Context) {
+	var request model.Keyv[interface{}]
+	if err := gtx.BindJSON(&request); err != nil {
+		logger.Error(err)
+		gtx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := request.GetString("model")
+	if name == "" {
+		name = request.GetString("name")
+	}
+
+	for _, extension := range h.extensions {
+		for _, mod := range extension.Models() {
+			if mod.Id != name {
+				continue
+			}
+
+			tags := ollamaModel(mod)
+			gtx.JSON(http.StatusOK, gin.H{
+				"license":      "",
+				"modelfile":    "# Modelfile generated by chatgpt-adapter\nFROM " + mod.Id + "\n",
+				"parameters":   "",
+				"template":     "{{ .Prompt }}",
+				"details":      tags.Details,
+				"model_info":   gin.H{"general.architecture": mod.By},
+				"capabilities": []string{"completion", "tools"},
+				"modified_at":  tags.ModifiedAt,
+			})
+			return
+		}
+	}
+	gtx.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model '%s' not found", name)})
+}
+
+func ollamaModel(mod model.Model) model.OllamaModel {
+	return model.OllamaModel{
+		Name:       mod.Id,
+		Model:      mod.Id,
+		ModifiedAt: time.Unix(int64(mod.Created), 0).Format(time.RFC3339),
+		Digest:     common.CalcHex(mod.Id),
+		Details: model.OllamaModelDetails{
+			Format:   "api",
+			Family:   mod.By,
+			Families: []string{mod.By},
+		},
+	}
+}
+
+// 将 Ollama chat 请求转换为 model.Completion
+func convertOllamaChat(request model.OllamaChat) (completion model.Completion) {
+	completion = ollamaCompletion(request.Model, request.Options, request.Stream)
+	// name => tool_call_id
+	toolIds := make(map[string]string)
+	lastToolId := ""
+	for _, message := range request.Messages {
+		role := message.GetString("role")
+		switch role {
+		case "assistant":
+			toolCalls := message.GetSlice("tool_calls")
+			if len(toolCalls) == 0 {
+				break
+			}
+
+			calls := make([]interface{}, 0, len(toolCalls))
+			for _, value := range toolCalls {
+				var toolCall model.Keyv[interface{}]
+				if toolCall, _ = value.(map[string]interface{}); toolCall == nil {
+					continue
+				}
+
+				fn := toolCall.GetKeyv("function")
+				arguments, ok := fn["arguments"].(string)
+				if !ok {
+					bytes, _ := json.Marshal(fn["arguments"])
+					arguments = string(bytes)
+				}
+
+				lastToolId = "call_" + common.Hex(24)
+				toolIds[fn.GetString("name")] = lastToolId
+				calls = append(calls, map[string]interface{}{
+					"id":   lastToolId,
+					"type": "function",
+					"function": map[string]interface{}{
+						"name":      fn.GetString("name"),
+						"arguments": arguments,
+					},
+				})
+			}
+
+			completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+				"role": role, "content": message.GetString("content"), "tool_calls": calls,
+			})
+			continue
+
+		case "tool":
+			name := message.GetString("tool_name")
+			toolId, ok := toolIds[name]
+			if !ok {
+				toolId = lastToolId
+			}
+			completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+				"role": role, "tool_call_id": toolId, "name": name, "content": message.GetString("content"),
+			})
+			continue
+		}
+
+		completion.Messages = append(completion.Messages, ollamaMessage(role, message.GetString("content"), message.GetSlice("images")))
+	}
+	completion.Tools = request.Tools
+	return
+}
+
+// 将 Ollama generate 请求转换为 model.Completion
+func convertOllamaGenerate(request model.OllamaGenerate) (completion model.Completion) {
+	completion = ollamaCompletion(request.Model, request.Options, request.Stream)
+	system, content := request.System, request.Prompt
+	if request.Suffix != "" {
+		if system == "" {
+			system = textInsertPrompt
+		}
+		content = "<prefix>\n" + request.Prompt + "\n</prefix>\n<suffix>\n" + request.Suffix + "\n</suffix>"
+	}
+
+	if system != "" {
+		completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+			"role": "system", "content": system,
+		})
+	}
+
+	images := make([]interface{}, 0, len(request.Images))
+	for _, image := range request.Images {
+		images = append(images, image)
+	}
+	completion.Messages = append(completion.Messages, ollamaMessage("user", content, images))
+	return
+}
+
+func ollamaCompletion(mod string, options model.OllamaOptions, stream *bool) model.Completion {
+	return model.Completion{
+		Model:         mod,
+		MaxTokens:     options.NumPredict,
+		StopSequences: options.Stop,
+		Temperature:   options.Temperature,
+		TopK:          options.TopK,
+		TopP:          options.TopP,
+		Stream:        stream == nil || *stream,
+	}
+}
+
+// Ollama 的图片为不带前缀的 base64 编码
+func ollamaMessage(role, content string, images []interface{}) model.Keyv[interface{}] {
+	if len(images) == 0 {
+		return model.Keyv[interface{}]{"role": role, "content": content}
+	}
+
+	contents := []interface{}{
+		map[string]interface{}{"type": "text", "text": content},
+	}
+	for _, value := range images {
+		image, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		mimeType := "image/png"
+		if bytes, err := base64.StdEncoding.DecodeString(image); err == nil {
+			mimeType = http.DetectContentType(bytes)
+		}
+		contents = append(contents, map[string]interface{}{
+			"type":      "image_url",
+			"image_url": map[string]interface{}{"url": "data:" + mimeType + ";base64," + image},
+		})
+	}
+	return model.Keyv[interface{}]{"role": role, "content": contents}
+}
+
+// OpenAI chat.completion => Ollama NDJSON 响应转换
+type ollamaConverter struct {
+	gtx     *gin.Context
+	field   string // chat 接口为 message，generate 接口为 response
+	model   string
+	created time.Time
+
+	evalAt       time.Time
+	output       string
+	toolCalls    []model.Keyv[interface{}]
+	finishReason string
+	usage        map[string]interface{}
+}
+
+func newOllamaConverter(gtx *gin.Context, field string) *ollamaConverter {
+	return &ollamaConverter{gtx: gtx, field: field, created: time.Now()}
+}
+
+func (*ollamaConverter) ContentType() string { return "application/x-ndjson" }
+
+func (c *ollamaConverter) Chunk(w io.Writer, chunk model.Response) {
+	if c.evalAt.IsZero() {
+		c.evalAt = time.Now()
+	}
+
+	if chunk.Usage != nil {
+		c.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			c.finishReason = *choice.FinishReason
+		}
+
+		delta := choice.Delta
+		if delta == nil {
+			continue
+		}
+
+		// 工具调用需要完整的参数，在结束时一并输出
+		for _, toolCall := range delta.ToolCalls {
+			fn := toolCall.GetKeyv("function")
+			if toolCall.Has("id") || len(c.toolCalls) == 0 {
+				c.toolCalls = append(c.toolCalls, model.Keyv[interface{}]{
+					"function": map[string]interface{}{"name": fn.GetString("name"), "arguments": ""},
+				})
+			}
+
+			last := c.toolCalls[len(c.toolCalls)-1].GetKeyv("function")
+			last.Set("arguments", last.GetString("arguments")+fn.GetString("arguments"))
+		}
+
+		if delta.ReasoningContent != "" && c.field == "message" {
+			writeJSON(w, c.response(model.Keyv[interface{}]{
+				"role": "assistant", "content": "", "thinking": delta.ReasoningContent,
+			}, false))
+		}
+
+		if delta.Content != "" {
+			c.output += delta.Content
+			writeJSON(w, c.response(c.content(delta.Content), false))
+		}
+	}
+}
+
+func (c *ollamaConverter) Done(w io.Writer) {
+	if len(c.toolCalls) > 0 && c.field == "message" {
+		writeJSON(w, c.response(model.Keyv[interface{}]{
+			"role": "assistant", "content": "", "tool_calls": c.ollamaToolCalls(),
+		}, false))
+	}
+
+	if c.finishReason == "tool_calls" {
+		c.finishReason = "stop"
+	}
+	writeJSON(w, c.response(c.content(""), true))
+}
+
+func (c *ollamaConverter) Response(w io.Writer, resp model.Response) {
+	choice := resp.Choices[0]
+	if choice.FinishReason != nil {
+		c.finishReason = *choice.FinishReason
+	}
+	if c.finishReason == "tool_calls" {
+		c.finishReason = "stop"
+	}
+
+	c.usage = resp.Usage
+	if choice.Message == nil {
+		writeJSON(w, c.response(c.content(""), true))
+		return
+	}
+
+	c.output = choice.Message.Content
+	c.toolCalls = nil
+	for _, toolCall := range choice.Message.ToolCalls {
+		fn := toolCall.GetKeyv("function")
+		c.toolCalls = append(c.toolCalls, model.Keyv[interface{}]{
+			"function": map[string]interface{}{"name": fn.GetString("name"), "arguments": fn.GetString("arguments")},
+		})
+	}
+
+	value := c.content(c.output)
+	if message, ok := value.(model.Keyv[interface{}]); ok {
+		if choice.Message.ReasoningContent != "" {
+			message.Set("thinking", choice.Message.ReasoningContent)
+		}
+		if len(c.toolCalls) > 0 {
+			message.Set("tool_calls", c.ollamaToolCalls())
+		}
+	}
+	writeJSON(w, c.response(value, true))
+}
+
+func (c *ollamaConverter) Error(w io.Writer, code int, message string, sse bool) {
+	writeJSON(w, map[string]interface{}{
+		"error": message,
+	})
+}
+
+func (c *ollamaConverter) content(text string) interface{} {
+	if c.field == "message" {
+		return model.Keyv[interface{}]{"role": "assistant", "content": text}
+	}
+	return text
+}
+
+// Ollama 的工具参数为 JSON 对象
+func (c *ollamaConverter) ollamaToolCalls() (toolCalls []interface{}) {
+	for _, toolCall := range c.toolCalls {
+		fn := toolCall.GetKeyv("function")
+		var arguments interface{} = map[string]interface{}{}
+		if str := fn.GetString("arguments"); str != "" {
+			if err := json.Unmarshal([]byte(str), &arguments); err != nil {
+				logger.Error(err)
+			}
+		}
+
+		toolCalls = append(toolCalls, map[string]interface{}{
+			"function": map[string]interface{}{"name": fn.GetString("name"), "arguments": arguments},
+		})
+	}
+	return
+}
+
+func (c *ollamaConverter) response(value interface{}, done bool) model.Keyv[interface{}] {
+	if value == nil {
+		value = c.content("")
+	}
+
+	now := time.Now()
+	resp := model.Keyv[interface{}]{
+		"model":      c.model,
+		"created_at": now.UTC().Format(time.RFC3339Nano),
+		c.field:      value,
+		"done":       done,
+	}
+	if !done {
+		return resp
+	}
+
+	finishReason := c.finishReason
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+
+	evalAt := c.evalAt
+	if evalAt.IsZero() {
+		evalAt = now
+	}
+
+	promptTokens, completionTokens := c.calcUsage()
+	resp.Set("done_reason", finishReason)
+	resp.Set("total_duration", now.Sub(c.created).Nanoseconds())
+	resp.Set("load_duration", 0)
+	resp.Set("prompt_eval_count", promptTokens)
+	resp.Set("prompt_eval_duration", evalAt.Sub(c.created).Nanoseconds())
+	resp.Set("eval_count", completionTokens)
+	resp.Set("eval_duration", now.Sub(evalAt).Nanoseconds())
+	return resp
+}
+
+func (c *ollamaConverter) calcUsage() (promptTokens, completionTokens int) {
+	return usageTokens(c.gtx, c.usage, c.output)
+}
@@ -0,0 +1,178 @@
+package gin
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConvertOllamaChat(t *testing.T) {
+	var request model.OllamaChat
+	err := json.Unmarshal([]byte(`{"model": "test", "stream": false, "options": {"num_predict": 32, "stop": ["END"]}, "messages": [
+		{"role": "system", "content": "sys"},
+		{"role": "user", "content": "what is this", "images": ["iVBORw0KGgo="]},
+		{"role": "assistant", "content": "", "tool_calls": [{"function": {"name": "weather", "arguments": {"city": "Paris"}}}]},
+		{"role": "tool", "tool_name": "weather", "content": "sunny"}
+	]}`), &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	completion := convertOllamaChat(request)
+	if completion.Stream || completion.MaxTokens != 32 || len(completion.StopSequences) != 1 {
+		t.Errorf("completion = %+v", completion)
+	}
+
+	messages := completion.Messages
+	if len(messages) != 4 {
+		t.Fatalf("messages = %v", messages)
+	}
+
+	// 图片转换为带 MIME 类型的 data url
+	image := messages[1].GetSlice("content")[1].(map[string]interface{})["image_url"].(map[string]interface{})
+	if image["url"] != "data:image/png;base64,iVBORw0KGgo=" {
+		t.Errorf("image = %v", image)
+	}
+
+	// 工具参数为 JSON 字符串，工具结果按名称关联到调用 id
+	call := messages[2].GetSlice("tool_calls")[0].(map[string]interface{})
+	if fn := call["function"].(map[string]interface{}); fn["arguments"] != `{"city":"Paris"}` {
+		t.Errorf("tool call = %v", call)
+	}
+	if messages[3].GetString("tool_call_id") != call["id"] || messages[3].GetString("name") != "weather" {
+		t.Errorf("tool result = %v, want id %v", messages[3], call["id"])
+	}
+}
+
+func TestConvertOllamaGenerate(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  model.OllamaGenerate
+		messages [][2]string // role, content
+	}{
+		{"prompt", model.OllamaGenerate{Prompt: "hi"}, [][2]string{{"user", "hi"}}},
+		{"system", model.OllamaGenerate{Prompt: "hi", System: "sys"}, [][2]string{{"system", "sys"}, {"user", "hi"}}},
+		{"suffix", model.OllamaGenerate{Prompt: "a", Suffix: "c"},
+			[][2]string{{"system", textInsertPrompt}, {"user", "<prefix>\na\n</prefix>\n<suffix>\nc\n</suffix>"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completion := convertOllamaGenerate(tt.request)
+			if !completion.Stream {
+				t.Error("stream should default to true")
+			}
+
+			var messages [][2]string
+			for _, message := range completion.Messages {
+				messages = append(messages, [2]string{message.GetString("role"), message.GetString("content")})
+			}
+			if !reflect.DeepEqual(messages, tt.messages) {
+				t.Errorf("messages = %q, want %q", messages, tt.messages)
+			}
+		})
+	}
+}
+
+// 解析 NDJSON 响应
+func parseLines(t *testing.T, body string) (lines []model.Keyv[interface{}]) {
+	t.Helper()
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		var value model.Keyv[interface{}]
+		if err := json.Unmarshal([]byte(line), &value); err != nil {
+			t.Fatalf("invalid line %s: %v", line, err)
+		}
+		lines = append(lines, value)
+	}
+	return
+}
+
+func TestOllama(t *testing.T) {
+	withEnv(t, nil)
+	h := &Handler{extensions: []inter.Adapter{&fakeAdapter{models: []string{"test"}, completion: func(gtx *gin.Context) error {
+		if !common.GetGinCompletion(gtx).Stream {
+			response.ToolCallResponse(gtx, "test", "weather", `{"city": "Paris"}`)
+			return nil
+		}
+		created := time.Now().Unix()
+		response.SSEResponse(gtx, "test", "hello", created)
+		response.SSEToolCallsResponse(gtx, "test", []response.ToolCall{{Name: "weather", Arguments: `{"city": "Paris"}`}}, created)
+		return nil
+	}}}}
+
+	t.Run("chat stream", func(t *testing.T) {
+		gtx, w := newContext(http.MethodPost, "/api/chat", `{"model": "test", "messages": [{"role": "user", "content": "hi"}]}`)
+		h.ollamaChat(gtx)
+
+		lines := parseLines(t, w.Body.String())
+		if len(lines) < 3 || lines[0].GetKeyv("message").GetString("content") == "" {
+			t.Fatalf("lines = %s", w.Body)
+		}
+
+		// 工具调用在结束前一并输出，参数为对象
+		calls := lines[len(lines)-2].GetKeyv("message").GetSlice("tool_calls")
+		if len(calls) != 1 || calls[0].(map[string]interface{})["function"].(map[string]interface{})["arguments"].(map[string]interface{})["city"] != "Paris" {
+			t.Errorf("tool calls = %v", calls)
+		}
+
+		last := lines[len(lines)-1]
+		if !last.Is("done", true) || !last.Is("done_reason", "stop") || last["eval_count"] == nil {
+			t.Errorf("last line = %v", last)
+		}
+	})
+
+	t.Run("chat", func(t *testing.T) {
+		gtx, w := newContext(http.MethodPost, "/api/chat", `{"model": "test", "stream": false, "messages": [{"role": "user", "content": "hi"}]}`)
+		h.ollamaChat(gtx)
+
+		lines := parseLines(t, w.Body.String())
+		if len(lines) != 1 || !lines[0].Is("done", true) || len(lines[0].GetKeyv("message").GetSlice("tool_calls")) != 1 {
+			t.Errorf("response = %s", w.Body)
+		}
+	})
+
+	t.Run("generate load", func(t *testing.T) {
+		gtx, w := newContext(http.MethodPost, "/api/generate", `{"model": "test"}`)
+		h.ollamaGenerate(gtx)
+
+		lines := parseLines(t, w.Body.String())
+		if len(lines) != 1 || !lines[0].Is("done_reason", "load") {
+			t.Errorf("response = %s", w.Body)
+		}
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		gtx, w := newContext(http.MethodGet, "/api/tags", "")
+		h.ollamaTags(gtx)
+
+		var resp struct {
+			Models []model.OllamaModel `json:"models"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Models) != 1 || resp.Models[0].Name != "test" || resp.Models[0].Details.Family != "test" {
+			t.Errorf("response = %s", w.Body)
+		}
+	})
+
+	t.Run("show", func(t *testing.T) {
+		gtx, w := newContext(http.MethodPost, "/api/show", `{"model": "test"}`)
+		h.ollamaShow(gtx)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "FROM test") {
+			t.Errorf("status = %d, body = %s", w.Code, w.Body)
+		}
+
+		gtx, w = newContext(http.MethodPost, "/api/show", `{"name": "unknown"}`)
+		h.ollamaShow(gtx)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("status = %d, body = %s", w.Code, w.Body)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package gin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+)
+
+// @GET(path = "v1/admin/pools")
+func (h *Handler) pools(gtx *gin.Context) {
+	if !admin(gtx) {
+		return
+	}
+
+	data := make([]interface{}, 0)
+	for _, pool := range common.Pools() {
+		data = append(data, gin.H{
+			"name":     pool.Name(),
+			"strategy": pool.Strategy(),
+			"members":  pool.Members(),
+		})
+	}
+	gtx.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   data,
+	})
+}
+
+// 请求体为 {"value": ...}，value 与配置文件中账号的格式相同
+//
+// @POST(path = "v1/admin/pools/:name")
+func (h *Handler) addPoolMember(gtx *gin.Context) {
+	pool, ok := adminPool(gtx)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := gtx.BindJSON(&body); err != nil || len(body.Value) == 0 {
+		response.Error(gtx, http.StatusBadRequest, "the request body must be {\"value\": ...}")
+		return
+	}
+
+	if err := pool.AddMember(body.Value); err != nil {
+		response.Error(gtx, http.StatusBadRequest, err)
+		return
+	}
+	gtx.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// @DEL(path = "v1/admin/pools/:name/:id")
+func (h *Handler) removePoolMember(gtx *gin.Context) {
+	poolMember(gtx, common.Pool.RemoveMember)
+}
+
+// @POST(path = "v1/admin/pools/:name/:id/reset")
+func (h *Handler) resetPoolMember(gtx *gin.Context) {
+	poolMember(gtx, common.Pool.ResetMember)
+}
+
+// @POST(path = "v1/admin/pools/:name/:id/drain")
+func (h *Handler) drainPoolMember(gtx *gin.Context) {
+	poolMember(gtx, common.Pool.DrainMember)
+}
+
+func adminPool(gtx *gin.Context) (pool common.Pool, ok bool) {
+	if !admin(gtx) {
+		return
+	}
+
+	name := gtx.Param("name")
+	if pool, ok = common.PoolOf(name); !ok {
+		response.Error(gtx, http.StatusNotFound, "pool not found: "+name)
+	}
+	return
+}
+
+func poolMember(gtx *gin.Context, apply func(common.Pool, string) error) {
+	pool, ok := adminPool(gtx)
+	if !ok {
+		return
+	}
+
+	if err := apply(pool, gtx.Param("id")); err != nil {
+		response.Error(gtx, http.StatusNotFound, err)
+		return
+	}
+	gtx.JSON(http.StatusOK, gin.H{"ok": true})
+}
@@ -0,0 +1,106 @@
+package gin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"github.com/gin-gonic/gin"
+)
+
+func TestPoolAdmin(t *testing.T) {
+	withEnv(t, map[string]interface{}{"server.admin-key": "admin"})
+	h := &Handler{}
+	name := "test-" + t.Name()
+	container := common.NewPollContainer[string](name, []string{"cookie-a", "cookie-b"}, time.Hour)
+	_ = container.MarkTo("cookie-b", 2)
+
+	request := func(method, path, body, token string, handler gin.HandlerFunc, params ...string) (int, string) {
+		gtx, w := newContext(method, path, body)
+		gtx.Set("token", token)
+		for i := 0; i+1 < len(params); i += 2 {
+			gtx.Params = append(gtx.Params, gin.Param{Key: params[i], Value: params[i+1]})
+		}
+		handler(gtx)
+		return w.Code, w.Body.String()
+	}
+
+	t.Run("admin key", func(t *testing.T) {
+		if code, _ := request(http.MethodGet, "/v1/admin/pools", "", "wrong", h.pools); code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", code)
+		}
+
+		withEnv(t, nil)
+		if code, body := request(http.MethodGet, "/v1/admin/pools", "", "", h.pools); code != http.StatusForbidden || !strings.Contains(body, "server.admin-key") {
+			t.Errorf("status = %d, body = %s", code, body)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		code, body := request(http.MethodGet, "/v1/admin/pools", "", "admin", h.pools)
+		if code != http.StatusOK || strings.Contains(body, "cookie-a") {
+			t.Fatalf("status = %d, body = %s", code, body)
+		}
+
+		var resp struct {
+			Data []struct {
+				Name     string          `json:"name"`
+				Strategy string          `json:"strategy"`
+				Members  []common.Member `json:"members"`
+			} `json:"data"`
+		}
+		_ = json.Unmarshal([]byte(body), &resp)
+		for _, pool := range resp.Data {
+			if pool.Name != name {
+				continue
+			}
+			if len(pool.Members) != 2 || pool.Members[0].State != "ready" || pool.Members[1].State != "error" || pool.Members[1].Cooldown == 0 {
+				t.Errorf("members = %+v", pool.Members)
+			}
+			return
+		}
+		t.Errorf("pool %s not listed: %s", name, body)
+	})
+
+	t.Run("members", func(t *testing.T) {
+		path := "/v1/admin/pools/" + name
+		if code, body := request(http.MethodPost, path, `{"value": "cookie-c"}`, "admin", h.addPoolMember, "name", name); code != http.StatusOK {
+			t.Fatalf("add: status = %d, body = %s", code, body)
+		}
+		if code, _ := request(http.MethodPost, path, `{"value": "cookie-c"}`, "admin", h.addPoolMember, "name", name); code != http.StatusBadRequest {
+			t.Errorf("add again: status = %d, want 400", code)
+		}
+		if code, _ := request(http.MethodPost, path, `{}`, "admin", h.addPoolMember, "name", name); code != http.StatusBadRequest {
+			t.Errorf("add without value: status = %d, want 400", code)
+		}
+		if container.Len() != 3 {
+			t.Fatalf("len = %d, want 3", container.Len())
+		}
+
+		id := container.Id("cookie-b")
+		if code, _ := request(http.MethodPost, path+"/"+id+"/reset", "", "admin", h.resetPoolMember, "name", name, "id", id); code != http.StatusOK {
+			t.Errorf("reset: status = %d", code)
+		}
+		if marker, _ := container.Marked("cookie-b"); marker != 0 {
+			t.Errorf("marker after reset = %d", marker)
+		}
+
+		if code, _ := request(http.MethodPost, path+"/"+id+"/drain", "", "admin", h.drainPoolMember, "name", name, "id", id); code != http.StatusOK || container.Len() != 2 {
+			t.Errorf("drain: status = %d, len = %d", code, container.Len())
+		}
+		id = container.Id("cookie-c")
+		if code, _ := request(http.MethodDelete, path+"/"+id, "", "admin", h.removePoolMember, "name", name, "id", id); code != http.StatusOK || container.Len() != 1 {
+			t.Errorf("remove: status = %d, len = %d", code, container.Len())
+		}
+
+		if code, _ := request(http.MethodDelete, path+"/"+id, "", "admin", h.removePoolMember, "name", name, "id", id); code != http.StatusNotFound {
+			t.Errorf("remove unknown member: status = %d, want 404", code)
+		}
+		if code, _ := request(http.MethodPost, "/v1/admin/pools/unknown", `{"value": "x"}`, "admin", h.addPoolMember, "name", "unknown"); code != http.StatusNotFound {
+			t.Errorf("unknown pool: status = %d, want 404", code)
+		}
+	})
+}
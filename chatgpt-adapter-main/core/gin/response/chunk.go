@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/bincooo/emit.io"
+	"github.com/google/uuid"
 	"github.com/iocgo/sdk/env"
 	"math/rand"
 	"net/http"
@@ -20,6 +21,7 @@ import (
 
 var (
 	stop        = "stop"
+	length      = "length"
 	toolCalls   = "tool_calls"
 	canResponse = "__can-response__"
 
@@ -163,32 +165,27 @@ func ReasonResponse(ctx *gin.Context, mod, content, reasoningContent string) {
 	}
 
 	ctx.Set(canResponse, "No!")
-	created := time.Now().Unix()
 	usage := common.GetGinCompletionUsage(ctx)
 	if env.Env.GetBool("server.no-usage") {
 		usage = DefaultUsage
 	}
 
-	ctx.JSON(http.StatusOK, model.Response{
-		Model:   "LLM",
-		Created: created,
-		Id:      fmt.Sprintf("chatcmpl-%d", created),
-		Object:  "chat.completion",
-		Choices: []model.Choice{
-			{
-				Index: 0,
-				Message: &struct {
-					Role             string `json:"role,omitempty"`
-					Content          string `json:"content,omitempty"`
-					ReasoningContent string `json:"reasoning_content,omitempty"`
-
-					ToolCalls []model.Keyv[interface{}] `json:"tool_calls,omitempty"`
-				}{"assistant", content, reasoningContent, nil},
-				FinishReason: &stop,
-			},
+	response := newResponse(ctx, mod, "chat.completion", time.Now().Unix())
+	response.Choices = []model.Choice{
+		{
+			Index: 0,
+			Message: &struct {
+				Role             string `json:"role,omitempty"`
+				Content          string `json:"content,omitempty"`
+				ReasoningContent string `json:"reasoning_content,omitempty"`
+
+				ToolCalls []model.Keyv[interface{}] `json:"tool_calls,omitempty"`
+			}{"assistant", content, reasoningContent, nil},
+			FinishReason: finishReason(ctx, usage),
 		},
-		Usage: usage,
-	})
+	}
+	response.Usage = usage
+	ctx.JSON(http.StatusOK, response)
 }
 
 func Echo(ctx *gin.Context, mode, content string, sse bool) {
@@ -227,7 +224,6 @@ func ReasonSSEResponse(ctx *gin.Context, mod, content, reasoningContent string,
 	setSSEHeader(ctx)
 
 	done := false
-	finishReason := ""
 	usage := common.GetGinCompletionUsage(ctx)
 	if env.Env.GetBool("server.no-usage") {
 		usage = DefaultUsage
@@ -236,28 +232,22 @@ func ReasonSSEResponse(ctx *gin.Context, mod, content, reasoningContent string,
 	if content == "[DONE]" {
 		done = true
 		content = ""
-		finishReason = "stop"
 	}
 
 	if reasoningContent != "" {
 		splitEach(reasoningContent, func(value string) {
-			response := model.Response{
-				Model:   mod,
-				Created: created,
-				Id:      fmt.Sprintf("chatcmpl-%d", created),
-				Object:  "chat.completion.chunk",
-				Choices: []model.Choice{
-					{
-						Index: 0,
-						Delta: &struct {
-							Type             string `json:"type,omitempty"`
-							Role             string `json:"role,omitempty"`
-							Content          string `json:"content,omitempty"`
-							ReasoningContent string `json:"reasoning_content,omitempty"`
-
-							ToolCalls []model.Keyv[interface{}] `json:"tool_calls,omitempty"`
-						}{"text", "assistant", "", value, nil},
-					},
+			response := newResponse(ctx, mod, "chat.completion.chunk", created)
+			response.Choices = []model.Choice{
+				{
+					Index: 0,
+					Delta: &struct {
+						Type             string `json:"type,omitempty"`
+						Role             string `json:"role,omitempty"`
+						Content          string `json:"content,omitempty"`
+						ReasoningContent string `json:"reasoning_content,omitempty"`
+
+						ToolCalls []model.Keyv[interface{}] `json:"tool_calls,omitempty"`
+					}{"text", "assistant", "", value, nil},
 				},
 			}
 
@@ -269,38 +259,8 @@ func ReasonSSEResponse(ctx *gin.Context, mod, content, reasoningContent string,
 
 	if content != "" {
 		splitEach(content, func(value string) {
-			response := model.Response{
-				Model:   "LLM",
-				Created: created,
-				Id:      fmt.Sprintf("chatcmpl-%d", created),
-				Object:  "chat.completion.chunk",
-				Choices: []model.Choice{
-					{
-						Index: 0,
-						Delta: &struct {
-							Type             string `json:"type,omitempty"`
-							Role             string `json:"role,omitempty"`
-							Content          string `json:"content,omitempty"`
-							ReasoningContent string `json:"reasoning_content,omitempty"`
-
-							ToolCalls []model.Keyv[interface{}] `json:"tool_calls,omitempty"`
-						}{"text", "assistant", value, "", nil},
-					},
-				},
-			}
-
-			Event(ctx, "", response)
-		})
-	}
-
-label:
-	if done {
-		response := model.Response{
-			Model:   "LLM",
-			Created: created,
-			Id:      fmt.Sprintf("chatcmpl-%d", created),
-			Object:  "chat.completion.chunk",
-			Choices: []model.Choice{
+			response := newResponse(ctx, mod, "chat.completion.chunk", created)
+			response.Choices = []model.Choice{
 				{
 					Index: 0,
 					Delta: &struct {
@@ -310,105 +270,225 @@ label:
 						ReasoningContent string `json:"reasoning_content,omitempty"`
 
 						ToolCalls []model.Keyv[interface{}] `json:"tool_calls,omitempty"`
-					}{"text", "assistant", "", "", nil},
+					}{"text", "assistant", value, "", nil},
 				},
+			}
+
+			Event(ctx, "", response)
+		})
+	}
+
+label:
+	if done {
+		response := newResponse(ctx, mod, "chat.completion.chunk", created)
+		response.Choices = []model.Choice{
+			{
+				Index: 0,
+				Delta: &struct {
+					Type             string `json:"type,omitempty"`
+					Role             string `json:"role,omitempty"`
+					Content          string `json:"content,omitempty"`
+					ReasoningContent string `json:"reasoning_content,omitempty"`
+
+					ToolCalls []model.Keyv[interface{}] `json:"tool_calls,omitempty"`
+				}{"text", "assistant", "", "", nil},
+				FinishReason: finishReason(ctx, usage),
 			},
 		}
-		response.Usage = usage
-		response.Choices[0].FinishReason = &finishReason
-		Event(ctx, "", response)
-		Event(ctx, "", "[DONE]")
+		doneEvent(ctx, response, usage)
 	}
 }
 
+// ToolCall 工具调用的名称及参数
+type ToolCall struct {
+	Name      string
+	Arguments string
+}
+
 func ToolCallResponse(ctx *gin.Context, mod, name, args string) {
+	ToolCallsResponse(ctx, mod, []ToolCall{{name, args}})
+}
+
+func ToolCallsResponse(ctx *gin.Context, mod string, calls []ToolCall) {
 	ctx.Set(canResponse, "No!")
-	created := time.Now().Unix()
 	usage := common.GetGinCompletionUsage(ctx)
 
-	ctx.JSON(http.StatusOK, model.Response{
-		Model:   "LLM",
-		Created: created,
-		Id:      fmt.Sprintf("chatcmpl-%d", created),
-		Object:  "chat.completion",
-		Choices: []model.Choice{
-			{
-				Index: 0,
-				Message: &struct {
-					Role             string `json:"role,omitempty"`
-					Content          string `json:"content,omitempty"`
-					ReasoningContent string `json:"reasoning_content,omitempty"`
+	toolCallSlice := make([]model.Keyv[interface{}], 0, len(calls))
+	for _, call := range calls {
+		toolCallSlice = append(toolCallSlice, model.Keyv[interface{}]{
+			"id":   "call_" + hex(24),
+			"type": "function",
+			"function": map[string]string{
+				"name":      call.Name,
+				"arguments": call.Arguments,
+			},
+		})
+	}
 
-					ToolCalls []model.Keyv[interface{}] `json:"tool_calls,omitempty"`
-				}{
-					Role: "assistant",
-					ToolCalls: []model.Keyv[interface{}]{
-						{
-							"id":   "call_" + hex(5),
-							"type": "function",
-							"function": map[string]string{
-								"name":      name,
-								"arguments": args,
-							},
-						},
-					},
-				},
-				FinishReason: &stop,
+	response := newResponse(ctx, mod, "chat.completion", time.Now().Unix())
+	response.Choices = []model.Choice{
+		{
+			Index: 0,
+			Message: &struct {
+				Role             string `json:"role,omitempty"`
+				Content          string `json:"content,omitempty"`
+				ReasoningContent string `json:"reasoning_content,omitempty"`
+
+				ToolCalls []model.Keyv[interface{}] `json:"tool_calls,omitempty"`
+			}{
+				Role:      "assistant",
+				ToolCalls: toolCallSlice,
 			},
+			FinishReason: &toolCalls,
 		},
-		Usage: usage,
-	})
+	}
+	response.Usage = usage
+	ctx.JSON(http.StatusOK, response)
 }
 
 func SSEToolCallResponse(ctx *gin.Context, mod, name, args string, created int64) {
+	SSEToolCallsResponse(ctx, mod, []ToolCall{{name, args}}, created)
+}
+
+func SSEToolCallsResponse(ctx *gin.Context, mod string, calls []ToolCall, created int64) {
+	for index, call := range calls {
+		SSEToolCallDelta(ctx, mod, index, call.Name, "", created)
+		SSEToolCallDelta(ctx, mod, index, "", call.Arguments, created)
+	}
+	SSEToolCallsDone(ctx, mod, created)
+}
+
+// SSEToolCallDelta 输出第 index 个工具调用的增量块，name 不为空时为该工具调用的首个块
+func SSEToolCallDelta(ctx *gin.Context, mod string, index int, name, args string, created int64) {
 	ctx.Set(canResponse, "No!")
 	setSSEHeader(ctx)
-	usage := common.GetGinCompletionUsage(ctx)
 
-	response := model.Response{
-		Model:   "LLM",
-		Created: created,
-		Id:      fmt.Sprintf("chatcmpl-%d", created),
-		Object:  "chat.completion.chunk",
-		Choices: []model.Choice{
-			{Index: 0},
+	toolCall := make(map[string]interface{})
+	toolCall["index"] = index
+	toolCall["function"] = map[string]string{"arguments": args}
+
+	role := ""
+	if name != "" {
+		toolCall["type"] = "function"
+		toolCall["id"] = "call_" + hex(24)
+		toolCall["function"] = map[string]string{"name": name, "arguments": args}
+		if index == 0 {
+			role = "assistant"
+		}
+	}
+
+	response := newResponse(ctx, mod, "chat.completion.chunk", created)
+	response.Choices = []model.Choice{
+		{
+			Index: 0,
+			Delta: &struct {
+				Type             string `json:"type,omitempty"`
+				Role             string `json:"role,omitempty"`
+				Content          string `json:"content,omitempty"`
+				ReasoningContent string `json:"reasoning_content,omitempty"`
+
+				ToolCalls []model.Keyv[interface{}] `json:"tool_calls,omitempty"`
+			}{
+				Role:      role,
+				ToolCalls: []model.Keyv[interface{}]{toolCall},
+			},
 		},
 	}
+	Event(ctx, "", response)
+}
 
-	toolCall := make(map[string]interface{})
-	toolCall["index"] = 0
-	toolCall["type"] = "function"
-	toolCall["id"] = "call_" + hex(5)
-	toolCall["function"] = map[string]string{"name": name, "arguments": ""}
-	response.Choices[0].Delta = &struct {
-		Type             string `json:"type,omitempty"`
-		Role             string `json:"role,omitempty"`
-		Content          string `json:"content,omitempty"`
-		ReasoningContent string `json:"reasoning_content,omitempty"`
-
-		ToolCalls []model.Keyv[interface{}] `json:"tool_calls,omitempty"`
-	}{
-		Role:      "assistant",
-		ToolCalls: []model.Keyv[interface{}]{toolCall},
+// SSEToolCallsDone 输出工具调用的结束块
+func SSEToolCallsDone(ctx *gin.Context, mod string, created int64) {
+	ctx.Set(canResponse, "No!")
+	setSSEHeader(ctx)
+	usage := common.GetGinCompletionUsage(ctx)
+
+	response := newResponse(ctx, mod, "chat.completion.chunk", created)
+	response.Choices = []model.Choice{
+		{Index: 0, FinishReason: &toolCalls},
 	}
+	doneEvent(ctx, response, usage)
+}
 
-	Event(ctx, "", response)
+// 输出结束块，stream_options.include_usage 为 true 时 usage 单独作为最后一个块输出
+func doneEvent(ctx *gin.Context, response model.Response, usage map[string]interface{}) {
+	if !includeUsage(ctx) {
+		response.Usage = usage
+		Event(ctx, "", response)
+		Event(ctx, "", "[DONE]")
+		return
+	}
 
-	delete(toolCall, "id")
-	delete(toolCall, "type")
-	toolCall["function"] = map[string]string{"arguments": args}
-	response.Choices[0].Delta.ToolCalls[0] = toolCall
-	response.Choices[0].Delta.Role = ""
 	Event(ctx, "", response)
-
-	response.Choices[0].FinishReason = &toolCalls
-	response.Choices[0].Delta = nil
+	if usage == nil {
+		usage = DefaultUsage
+	}
+	response.Choices = make([]model.Choice, 0)
 	response.Usage = usage
 	Event(ctx, "", response)
-
 	Event(ctx, "", "[DONE]")
 }
 
+func newResponse(ctx *gin.Context, mod, object string, created int64) model.Response {
+	return model.Response{
+		Id:                CompletionId(ctx),
+		Object:            object,
+		Created:           created,
+		Model:             modelId(ctx, mod),
+		SystemFingerprint: fingerprint(modelId(ctx, mod)),
+	}
+}
+
+// CompletionId 响应 id，同一请求内的所有响应块保持一致
+func CompletionId(ctx *gin.Context) string {
+	if id := ctx.GetString(vars.GinCompletionId); id != "" {
+		return id
+	}
+
+	id := "chatcmpl-" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	ctx.Set(vars.GinCompletionId, id)
+	return id
+}
+
+// 回显请求中路由的模型，没有时使用适配器名称
+func modelId(ctx *gin.Context, mod string) string {
+	if completion := common.GetGinCompletion(ctx); completion.Model != "" {
+		return completion.Model
+	}
+	return mod
+}
+
+func fingerprint(mod string) string {
+	return "fp_" + common.CalcHex(mod)[:10]
+}
+
+func includeUsage(ctx *gin.Context) bool {
+	options := common.GetGinCompletion(ctx).StreamOptions
+	return options != nil && options.IncludeUsage
+}
+
+// 适配器标记了结束原因，或输出的 token 数达到 max_tokens 时为 length
+func finishReason(ctx *gin.Context, usage map[string]interface{}) *string {
+	if reason := ctx.GetString(vars.GinFinishReason); reason != "" {
+		return &reason
+	}
+
+	maxTokens := common.GetGinCompletion(ctx).MaxTokens
+	if maxTokens > 0 && usage != nil {
+		tokens := 0
+		switch value := usage["completion_tokens"].(type) {
+		case int:
+			tokens = value
+		case float64:
+			tokens = int(value)
+		}
+		if tokens >= maxTokens {
+			return &length
+		}
+	}
+	return &stop
+}
+
 func NotResponse(ctx *gin.Context) bool {
 	return ctx.GetString(canResponse) == "" && NotSSEHeader(ctx)
 }
@@ -504,12 +584,12 @@ func splitEach(content string, cb func(value string)) {
 	}
 }
 
+// 使用全局的随机源，同一时刻生成的多个 id 不会重复
 func hex(n int) string {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	var runes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
 	bytes := make([]rune, n)
 	for i := range bytes {
-		bytes[i] = runes[r.Intn(len(runes))]
+		bytes[i] = runes[rand.Intn(len(runes))]
 	}
 	return string(bytes)
 }
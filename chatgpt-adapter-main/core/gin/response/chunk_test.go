@@ -0,0 +1,184 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/model"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+	"github.com/spf13/viper"
+)
+
+func newContext(t *testing.T, completion model.Completion, usage map[string]interface{}) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	old := env.Env
+	env.Env = &env.Environment{Viper: viper.New()}
+	t.Cleanup(func() { env.Env = old })
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Set(vars.GinCompletion, completion)
+	if usage != nil {
+		ctx.Set(vars.GinCompletionUsage, usage)
+	}
+	return ctx, w
+}
+
+func chunks(t *testing.T, body string) (result []model.Response, done bool) {
+	t.Helper()
+	for _, line := range strings.Split(body, "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+
+		var chunk model.Response
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %s: %v", data, err)
+		}
+		result = append(result, chunk)
+	}
+	return
+}
+
+func TestSSEResponse(t *testing.T) {
+	usage := map[string]interface{}{"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5}
+	tests := []struct {
+		name         string
+		completion   model.Completion
+		usageChunk   bool
+		finishReason string
+	}{
+		{"usage in the final chunk", model.Completion{Model: "alias"}, false, "stop"},
+		{"include usage", model.Completion{Model: "alias", StreamOptions: &model.StreamOptions{IncludeUsage: true}}, true, "stop"},
+		{"max tokens", model.Completion{Model: "alias", MaxTokens: 2}, false, "length"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, w := newContext(t, tt.completion, usage)
+			created := time.Now().Unix()
+			SSEResponse(ctx, "upstream-model", "hello", created)
+			SSEResponse(ctx, "upstream-model", "[DONE]", created)
+
+			result, done := chunks(t, w.Body.String())
+			if !done || len(result) < 2 {
+				t.Fatalf("body = %s", w.Body)
+			}
+
+			// 同一请求内 id 一致，回显请求的模型
+			for _, chunk := range result {
+				if chunk.Id != result[0].Id || !strings.HasPrefix(chunk.Id, "chatcmpl-") || chunk.Model != "alias" || chunk.Created != created {
+					t.Errorf("chunk = %+v", chunk)
+				}
+			}
+
+			last := result[len(result)-1]
+			finish := last
+			if tt.usageChunk {
+				if len(last.Choices) != 0 || last.Usage == nil {
+					t.Errorf("usage chunk = %+v", last)
+				}
+				finish = result[len(result)-2]
+				if finish.Usage != nil {
+					t.Errorf("finish chunk with usage = %+v", finish)
+				}
+			} else if last.Usage == nil {
+				t.Errorf("finish chunk without usage = %+v", last)
+			}
+
+			if len(finish.Choices) != 1 || finish.Choices[0].FinishReason == nil || *finish.Choices[0].FinishReason != tt.finishReason {
+				t.Errorf("finish chunk = %+v, want finish reason %s", finish, tt.finishReason)
+			}
+		})
+	}
+}
+
+func TestResponse(t *testing.T) {
+	ctx, w := newContext(t, model.Completion{}, nil)
+	ctx.Set(vars.GinFinishReason, "content_filter")
+	Response(ctx, "upstream-model", "hello")
+
+	var resp model.Response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// 请求中没有模型时使用适配器的模型名
+	if resp.Model != "upstream-model" || resp.Id != CompletionId(ctx) || !strings.HasPrefix(resp.SystemFingerprint, "fp_") {
+		t.Errorf("response = %s", w.Body)
+	}
+	if reason := resp.Choices[0].FinishReason; reason == nil || *reason != "content_filter" {
+		t.Errorf("finish reason = %v", reason)
+	}
+}
+
+func TestToolCallsResponse(t *testing.T) {
+	calls := []ToolCall{{"search", `{"q":"go"}`}, {"weather", "{}"}}
+
+	t.Run("response", func(t *testing.T) {
+		ctx, w := newContext(t, model.Completion{}, nil)
+		ToolCallsResponse(ctx, "test", calls)
+
+		var resp model.Response
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		toolCalls := resp.Choices[0].Message.ToolCalls
+		if len(toolCalls) != 2 || *resp.Choices[0].FinishReason != "tool_calls" {
+			t.Fatalf("response = %s", w.Body)
+		}
+		if toolCalls[0].GetString("id") == toolCalls[1].GetString("id") {
+			t.Errorf("tool call ids should be unique: %s", w.Body)
+		}
+		for i, call := range calls {
+			fn := toolCalls[i].GetKeyv("function")
+			if fn.GetString("name") != call.Name || fn.GetString("arguments") != call.Arguments {
+				t.Errorf("tool call #%d = %v", i, toolCalls[i])
+			}
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		ctx, w := newContext(t, model.Completion{}, nil)
+		SSEToolCallsResponse(ctx, "test", calls, time.Now().Unix())
+
+		result, done := chunks(t, w.Body.String())
+		if !done {
+			t.Fatalf("body = %s", w.Body)
+		}
+
+		// 按 index 拼接每个工具调用的增量
+		names := make(map[int]string)
+		arguments := make(map[int]string)
+		for _, chunk := range result {
+			if chunk.Choices[0].Delta == nil {
+				continue
+			}
+			for _, call := range chunk.Choices[0].Delta.ToolCalls {
+				index := int(call["index"].(float64))
+				fn := call.GetKeyv("function")
+				names[index] += fn.GetString("name")
+				arguments[index] += fn.GetString("arguments")
+			}
+		}
+		for i, call := range calls {
+			if names[i] != call.Name || arguments[i] != call.Arguments {
+				t.Errorf("tool call #%d = %s %s", i, names[i], arguments[i])
+			}
+		}
+		if reason := result[len(result)-1].Choices[0].FinishReason; reason == nil || *reason != "tool_calls" {
+			t.Errorf("finish reason = %v", reason)
+		}
+	})
+}
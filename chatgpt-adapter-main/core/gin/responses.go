@@ -0,0 +1,637 @@
+package gin
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"chatgpt-adapter/core/cache"
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// 上下文缓存时长，用于 previous_response_id 续接对话
+const responsesExpiration = 30 * time.Minute
+
+// @POST(path = "
+//
+//	v1/responses,
+//	proxies/v1/responses
+//
+// ")
+func (h *Handler) responses(gtx *gin.Context) {
+	var request model.ResponsesCompletion
+	if err := gtx.BindJSON(&request); err != nil {
+		logger.Error(err)
+		response.Error(gtx, -1, err)
+		return
+	}
+
+	completion, err := convertResponsesRequest(request)
+	if err != nil {
+		response.Error(gtx, http.StatusBadRequest, err)
+		return
+	}
+
+	conv := &responsesConverter{
+		gtx:      gtx,
+		id:       "resp_" + common.Hex(24),
+		created:  time.Now().Unix(),
+		request:  request,
+		messages: completion.Messages,
+	}
+	withConverter(gtx, conv, func() {
+		h.relay(gtx, completion)
+	})
+}
+
+// 将 Responses 请求转换为 model.Completion
+func convertResponsesRequest(request model.ResponsesCompletion) (completion model.Completion, err error) {
+	completion = model.Completion{
+		Model:      request.Model,
+		MaxTokens:  request.MaxOutputTokens,
+		Stream:     request.Stream,
+		ToolChoice: request.ToolChoice,
+
+		ParallelToolCalls: request.ParallelToolCalls,
+	}
+
+	if request.Temperature != nil {
+		completion.Temperature = *request.Temperature
+	}
+	if request.TopP != nil {
+		completion.TopP = *request.TopP
+	}
+
+	if request.Instructions != "" {
+		completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+			"role": "system", "content": request.Instructions,
+		})
+	}
+
+	// 续接上一轮对话，instructions 不会被继承
+	if request.PreviousResponseId != "" {
+		messages, e := cache.ResponsesCacheManager().GetValue(request.PreviousResponseId)
+		if e != nil {
+			logger.Error(e)
+		}
+		if messages == nil {
+			err = fmt.Errorf("previous response with id '%s' not found", request.PreviousResponseId)
+			return
+		}
+		for _, message := range messages {
+			if !message.Is("role", "system") {
+				completion.Messages = append(completion.Messages, message)
+			}
+		}
+	}
+
+	switch input := request.Input.(type) {
+	case string:
+		completion.Messages = append(completion.Messages, model.Keyv[interface{}]{
+			"role": "user", "content": input,
+		})
+	case []interface{}:
+		completion.Messages = append(completion.Messages, convertResponsesInput(input, completion.Messages)...)
+	}
+
+	for _, tool := range request.Tools {
+		if !tool.Is("type", "function") {
+			continue
+		}
+		completion.Tools = append(completion.Tools, model.Keyv[interface{}]{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        tool.GetString("name"),
+				"description": tool.GetString("description"),
+				"parameters":  tool["parameters"],
+			},
+		})
+	}
+
+	if toolChoice, ok := request.ToolChoice.(map[string]interface{}); ok {
+		var keyv model.Keyv[interface{}] = toolChoice
+		if keyv.Is("type", "function") {
+			completion.ToolChoice = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]interface{}{"name": keyv.GetString("name")},
+			}
+		}
+	}
+	return
+}
+
+func convertResponsesInput(items []interface{}, previous []model.Keyv[interface{}]) (messages []model.Keyv[interface{}]) {
+	// call_id => name
+	toolNames := make(map[string]string)
+	for _, message := range previous {
+		for _, item := range message.GetSlice("tool_calls") {
+			var toolCall model.Keyv[interface{}]
+			if toolCall, _ = item.(map[string]interface{}); toolCall != nil {
+				toolNames[toolCall.GetString("id")] = toolCall.GetKeyv("function").GetString("name")
+			}
+		}
+	}
+
+	for _, value := range items {
+		var item model.Keyv[interface{}]
+		item, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		switch item.GetString("type") {
+		case "function_call":
+			callId := item.GetString("call_id")
+			toolNames[callId] = item.GetString("name")
+			toolCall := map[string]interface{}{
+				"id":   callId,
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":      item.GetString("name"),
+					"arguments": item.GetString("arguments"),
+				},
+			}
+
+			// 连续的工具调用合并到同一条消息中
+			if messageL := len(messages); messageL > 0 && messages[messageL-1].Has("tool_calls") {
+				last := messages[messageL-1]
+				last.Set("tool_calls", append(last.GetSlice("tool_calls"), toolCall))
+				continue
+			}
+
+			messages = append(messages, model.Keyv[interface{}]{
+				"role":       "assistant",
+				"content":    "",
+				"tool_calls": []interface{}{toolCall},
+			})
+
+		case "function_call_output":
+			callId := item.GetString("call_id")
+			messages = append(messages, model.Keyv[interface{}]{
+				"role":         "tool",
+				"tool_call_id": callId,
+				"name":         toolNames[callId],
+				"content":      item.GetString("output"),
+			})
+
+		case "message", "":
+			role := item.GetString("role")
+			if role == "developer" {
+				role = "system"
+			}
+			if role == "" {
+				continue
+			}
+
+			if item.IsString("content") {
+				messages = append(messages, model.Keyv[interface{}]{
+					"role": role, "content": item.GetString("content"),
+				})
+				continue
+			}
+
+			var (
+				texts    []string
+				contents []interface{}
+				hasImage = false
+			)
+			for _, part := range item.GetSlice("content") {
+				var keyv model.Keyv[interface{}]
+				keyv, ok = part.(map[string]interface{})
+				if !ok {
+					continue
+				}
+
+				switch keyv.GetString("type") {
+				case "input_text", "output_text", "text":
+					texts = append(texts, keyv.GetString("text"))
+					contents = append(contents, map[string]interface{}{
+						"type": "text", "text": keyv.GetString("text"),
+					})
+				case "input_image":
+					hasImage = true
+					contents = append(contents, map[string]interface{}{
+						"type": "image_url", "image_url": map[string]interface{}{"url": keyv.GetString("image_url")},
+					})
+				}
+			}
+
+			if hasImage {
+				messages = append(messages, model.Keyv[interface{}]{
+					"role": role, "content": contents,
+				})
+				continue
+			}
+
+			messages = append(messages, model.Keyv[interface{}]{
+				"role": role, "content": strings.Join(texts, "\n"),
+			})
+		}
+	}
+	return
+}
+
+// OpenAI chat.completion => Responses 响应转换
+type responsesConverter struct {
+	gtx      *gin.Context
+	id       string
+	created  int64
+	request  model.ResponsesCompletion
+	messages []model.Keyv[interface{}]
+
+	sequence     int
+	started      bool
+	item         model.Keyv[interface{}] // 当前输出项
+	text         string                  // 当前输出项的文本或参数
+	output       []model.Keyv[interface{}]
+	outputText   string
+	finishReason string
+	usage        map[string]interface{}
+	failed       model.Keyv[interface{}] // 流式输出中途的异常
+}
+
+func (*responsesConverter) ContentType() string { return "text/event-stream" }
+
+func (c *responsesConverter) Chunk(w io.Writer, chunk model.Response) {
+	c.start(w)
+	if chunk.Usage != nil {
+		c.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			c.finishReason = *choice.FinishReason
+		}
+
+		delta := choice.Delta
+		if delta == nil {
+			continue
+		}
+
+		if delta.ReasoningContent != "" {
+			c.open(w, "reasoning", model.Keyv[interface{}]{
+				"id": "rs_" + common.Hex(24), "type": "reasoning", "summary": []interface{}{},
+			})
+			c.text += delta.ReasoningContent
+			c.event(w, "response.reasoning_summary_text.delta", model.Keyv[interface{}]{
+				"item_id": c.item["id"], "output_index": len(c.output), "summary_index": 0, "delta": delta.ReasoningContent,
+			})
+		}
+
+		if delta.Content != "" {
+			c.open(w, "message", model.Keyv[interface{}]{
+				"id": "msg_" + common.Hex(24), "type": "message", "status": "in_progress", "role": "assistant", "content": []interface{}{},
+			})
+			c.text += delta.Content
+			c.outputText += delta.Content
+			c.event(w, "response.output_text.delta", model.Keyv[interface{}]{
+				"item_id": c.item["id"], "output_index": len(c.output), "content_index": 0, "delta": delta.Content,
+			})
+		}
+
+		for _, toolCall := range delta.ToolCalls {
+			fn := toolCall.GetKeyv("function")
+			if toolCall.Has("id") {
+				c.close(w)
+				c.open(w, "function_call", model.Keyv[interface{}]{
+					"id":        "fc_" + common.Hex(24),
+					"type":      "function_call",
+					"status":    "in_progress",
+					"call_id":   toolCall.GetString("id"),
+					"name":      fn.GetString("name"),
+					"arguments": "",
+				})
+			}
+
+			arguments := fn.GetString("arguments")
+			if arguments == "" || c.item == nil || !c.item.Is("type", "function_call") {
+				continue
+			}
+
+			c.text += arguments
+			c.event(w, "response.function_call_arguments.delta", model.Keyv[interface{}]{
+				"item_id": c.item["id"], "output_index": len(c.output), "delta": arguments,
+			})
+		}
+	}
+}
+
+func (c *responsesConverter) Done(w io.Writer) {
+	c.start(w)
+	c.close(w)
+
+	resp := c.snapshot()
+	// 异常中断的回合不缓存，不能作为 previous_response_id
+	if c.failed != nil {
+		resp.Set("status", "failed")
+		resp.Set("error", c.failed)
+		c.event(w, "response.failed", model.Keyv[interface{}]{"response": resp})
+		return
+	}
+
+	eventType := "response.completed"
+	if resp.Is("status", "incomplete") {
+		eventType = "response.incomplete"
+	}
+
+	c.event(w, eventType, model.Keyv[interface{}]{"response": resp})
+	c.store()
+}
+
+func (c *responsesConverter) Response(w io.Writer, resp model.Response) {
+	choice := resp.Choices[0]
+	if choice.FinishReason != nil {
+		c.finishReason = *choice.FinishReason
+	}
+
+	if message := choice.Message; message != nil {
+		if message.ReasoningContent != "" {
+			c.output = append(c.output, model.Keyv[interface{}]{
+				"id":   "rs_" + common.Hex(24),
+				"type": "reasoning",
+				"summary": []interface{}{
+					map[string]interface{}{"type": "summary_text", "text": message.ReasoningContent},
+				},
+			})
+		}
+
+		if message.Content != "" {
+			c.outputText = message.Content
+			c.output = append(c.output, model.Keyv[interface{}]{
+				"id":      "msg_" + common.Hex(24),
+				"type":    "message",
+				"status":  "completed",
+				"role":    "assistant",
+				"content": []interface{}{outputText(message.Content)},
+			})
+		}
+
+		for _, toolCall := range message.ToolCalls {
+			fn := toolCall.GetKeyv("function")
+			c.output = append(c.output, model.Keyv[interface{}]{
+				"id":        "fc_" + common.Hex(24),
+				"type":      "function_call",
+				"status":    "completed",
+				"call_id":   toolCall.GetString("id"),
+				"name":      fn.GetString("name"),
+				"arguments": fn.GetString("arguments"),
+			})
+		}
+	}
+
+	c.usage = resp.Usage
+	writeJSON(w, c.snapshot())
+	c.store()
+}
+
+func (c *responsesConverter) Error(w io.Writer, code int, message string, sse bool) {
+	if sse {
+		c.failed = model.Keyv[interface{}]{"code": fmt.Sprintf("%d", code), "message": message}
+		c.event(w, "error", model.Keyv[interface{}]{
+			"code": fmt.Sprintf("%d", code), "message": message, "param": nil,
+		})
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+		},
+	})
+}
+
+func (c *responsesConverter) start(w io.Writer) {
+	if c.started {
+		return
+	}
+
+	c.started = true
+	resp := c.snapshot()
+	resp.Set("status", "in_progress")
+	c.event(w, "response.created", model.Keyv[interface{}]{"response": resp})
+	c.event(w, "response.in_progress", model.Keyv[interface{}]{"response": resp})
+}
+
+// 开始新的输出项，类型相同时沿用当前输出项
+func (c *responsesConverter) open(w io.Writer, itemType string, item model.Keyv[interface{}]) {
+	if c.item != nil && c.item.Is("type", itemType) {
+		return
+	}
+
+	c.close(w)
+	c.item = item
+	c.text = ""
+	outputIndex := len(c.output)
+	c.event(w, "response.output_item.added", model.Keyv[interface{}]{
+		"output_index": outputIndex, "item": item.Clone(),
+	})
+
+	switch itemType {
+	case "message":
+		c.event(w, "response.content_part.added", model.Keyv[interface{}]{
+			"item_id": item["id"], "output_index": outputIndex, "content_index": 0, "part": outputText(""),
+		})
+	case "reasoning":
+		c.event(w, "response.reasoning_summary_part.added", model.Keyv[interface{}]{
+			"item_id": item["id"], "output_index": outputIndex, "summary_index": 0,
+			"part": map[string]interface{}{"type": "summary_text", "text": ""},
+		})
+	}
+}
+
+// 结束当前输出项
+func (c *responsesConverter) close(w io.Writer) {
+	item := c.item
+	if item == nil {
+		return
+	}
+
+	outputIndex := len(c.output)
+	switch item.GetString("type") {
+	case "message":
+		part := outputText(c.text)
+		c.event(w, "response.output_text.done", model.Keyv[interface{}]{
+			"item_id": item["id"], "output_index": outputIndex, "content_index": 0, "text": c.text,
+		})
+		c.event(w, "response.content_part.done", model.Keyv[interface{}]{
+			"item_id": item["id"], "output_index": outputIndex, "content_index": 0, "part": part,
+		})
+		item.Set("status", "completed")
+		item.Set("content", []interface{}{part})
+
+	case "reasoning":
+		part := map[string]interface{}{"type": "summary_text", "text": c.text}
+		c.event(w, "response.reasoning_summary_text.done", model.Keyv[interface{}]{
+			"item_id": item["id"], "output_index": outputIndex, "summary_index": 0, "text": c.text,
+		})
+		c.event(w, "response.reasoning_summary_part.done", model.Keyv[interface{}]{
+			"item_id": item["id"], "output_index": outputIndex, "summary_index": 0, "part": part,
+		})
+		item.Set("summary", []interface{}{part})
+
+	case "function_call":
+		c.event(w, "response.function_call_arguments.done", model.Keyv[interface{}]{
+			"item_id": item["id"], "output_index": outputIndex, "arguments": c.text,
+		})
+		item.Set("status", "completed")
+		item.Set("arguments", c.text)
+	}
+
+	c.event(w, "response.output_item.done", model.Keyv[interface{}]{
+		"output_index": outputIndex, "item": item,
+	})
+	c.output = append(c.output, item)
+	c.item = nil
+	c.text = ""
+}
+
+func (c *responsesConverter) event(w io.Writer, eventType string, data model.Keyv[interface{}]) {
+	data.Set("type", eventType)
+	data.Set("sequence_number", c.sequence)
+	c.sequence++
+	writeEvent(w, eventType, data)
+}
+
+// 当前的 response 对象
+func (c *responsesConverter) snapshot() model.Keyv[interface{}] {
+	request := c.request
+	status := "completed"
+	var incompleteDetails interface{}
+	if c.finishReason == "length" {
+		status = "incomplete"
+		incompleteDetails = map[string]interface{}{"reason": "max_output_tokens"}
+	}
+
+	output := c.output
+	if output == nil {
+		output = make([]model.Keyv[interface{}], 0)
+	}
+
+	tools := request.Tools
+	if tools == nil {
+		tools = make([]model.Keyv[interface{}], 0)
+	}
+
+	toolChoice := request.ToolChoice
+	if toolChoice == nil {
+		toolChoice = "auto"
+	}
+
+	parallelToolCalls := true
+	if request.ParallelToolCalls != nil {
+		parallelToolCalls = *request.ParallelToolCalls
+	}
+
+	var instructions, previousResponseId, maxOutputTokens interface{}
+	if request.Instructions != "" {
+		instructions = request.Instructions
+	}
+	if request.PreviousResponseId != "" {
+		previousResponseId = request.PreviousResponseId
+	}
+	if request.MaxOutputTokens > 0 {
+		maxOutputTokens = request.MaxOutputTokens
+	}
+
+	metadata := request.Metadata
+	if metadata == nil {
+		metadata = model.Keyv[interface{}]{}
+	}
+
+	var temperature, topP float32 = 1, 1
+	if request.Temperature != nil {
+		temperature = *request.Temperature
+	}
+	if request.TopP != nil {
+		topP = *request.TopP
+	}
+
+	return model.Keyv[interface{}]{
+		"id":                   c.id,
+		"object":               "response",
+		"created_at":           c.created,
+		"status":               status,
+		"error":                nil,
+		"incomplete_details":   incompleteDetails,
+		"instructions":         instructions,
+		"max_output_tokens":    maxOutputTokens,
+		"model":                request.Model,
+		"output":               output,
+		"parallel_tool_calls":  parallelToolCalls,
+		"previous_response_id": previousResponseId,
+		"temperature":          temperature,
+		"top_p":                topP,
+		"tool_choice":          toolChoice,
+		"tools":                tools,
+		"metadata":             metadata,
+		"usage":                c.calcUsage(),
+	}
+}
+
+func (c *responsesConverter) calcUsage() map[string]interface{} {
+	inputTokens := c.gtx.GetInt(ginTokens)
+	outputTokens := 0
+	if value, ok := c.usage["prompt_tokens"].(float64); ok && value > 0 {
+		inputTokens = int(value)
+	}
+	if value, ok := c.usage["completion_tokens"].(float64); ok && value > 0 {
+		outputTokens = int(value)
+	} else {
+		outputTokens = response.CalcTokens(c.outputText)
+	}
+
+	return map[string]interface{}{
+		"input_tokens":          inputTokens,
+		"input_tokens_details":  map[string]interface{}{"cached_tokens": 0},
+		"output_tokens":         outputTokens,
+		"output_tokens_details": map[string]interface{}{"reasoning_tokens": 0},
+		"total_tokens":          inputTokens + outputTokens,
+	}
+}
+
+// 缓存本轮对话，供 previous_response_id 使用
+func (c *responsesConverter) store() {
+	if c.request.Store != nil && !*c.request.Store {
+		return
+	}
+
+	var toolCalls []interface{}
+	for _, item := range c.output {
+		if item.Is("type", "function_call") {
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":   item.GetString("call_id"),
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":      item.GetString("name"),
+					"arguments": item.GetString("arguments"),
+				},
+			})
+		}
+	}
+
+	message := model.Keyv[interface{}]{
+		"role": "assistant", "content": c.outputText,
+	}
+	if len(toolCalls) > 0 {
+		message.Set("tool_calls", toolCalls)
+	}
+
+	messages := append(append([]model.Keyv[interface{}]{}, c.messages...), message)
+	if err := cache.ResponsesCacheManager().SetWithExpiration(c.id, messages, responsesExpiration); err != nil {
+		logger.Error(err)
+	}
+}
+
+func outputText(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "output_text", "text": text, "annotations": []interface{}{}}
+}
@@ -0,0 +1,202 @@
+package gin
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConvertResponsesRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  string
+		messages string
+		tools    string
+		choice   interface{}
+	}{
+		{
+			"string input",
+			`{"instructions": "be brief", "input": "hi"}`,
+			`[{"content":"be brief","role":"system"},{"content":"hi","role":"user"}]`,
+			`null`, nil,
+		},
+		{
+			"message items",
+			`{"input": [
+				{"role": "developer", "content": "sys"},
+				{"type": "message", "role": "user", "content": [{"type": "input_text", "text": "a"}, {"type": "input_text", "text": "b"}]},
+				{"role": "user", "content": [{"type": "input_text", "text": "look"}, {"type": "input_image", "image_url": "https://example.com/a.png"}]}
+			]}`,
+			`[{"content":"sys","role":"system"},{"content":"a\nb","role":"user"},` +
+				`{"content":[{"text":"look","type":"text"},{"image_url":{"url":"https://example.com/a.png"},"type":"image_url"}],"role":"user"}]`,
+			`null`, nil,
+		},
+		{
+			"function calls",
+			`{"input": [
+				{"role": "user", "content": "weather?"},
+				{"type": "function_call", "call_id": "c1", "name": "weather", "arguments": "{\"city\":\"Paris\"}"},
+				{"type": "function_call", "call_id": "c2", "name": "time", "arguments": "{}"},
+				{"type": "function_call_output", "call_id": "c1", "output": "sunny"}
+			],
+			"tools": [{"type": "function", "name": "weather", "parameters": {"type": "object"}}, {"type": "web_search_preview"}],
+			"tool_choice": {"type": "function", "name": "weather"}}`,
+			`[{"content":"weather?","role":"user"},` +
+				`{"content":"","role":"assistant","tool_calls":[` +
+				`{"function":{"arguments":"{\"city\":\"Paris\"}","name":"weather"},"id":"c1","type":"function"},` +
+				`{"function":{"arguments":"{}","name":"time"},"id":"c2","type":"function"}]},` +
+				`{"content":"sunny","name":"weather","role":"tool","tool_call_id":"c1"}]`,
+			`[{"function":{"description":"","name":"weather","parameters":{"type":"object"}},"type":"function"}]`,
+			map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "weather"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request model.ResponsesCompletion
+			if err := json.Unmarshal([]byte(tt.request), &request); err != nil {
+				t.Fatal(err)
+			}
+			completion, err := convertResponsesRequest(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if messages, _ := json.Marshal(completion.Messages); string(messages) != tt.messages {
+				t.Errorf("messages =\n%s\nwant\n%s", messages, tt.messages)
+			}
+			if tools, _ := json.Marshal(completion.Tools); string(tools) != tt.tools {
+				t.Errorf("tools =\n%s\nwant\n%s", tools, tt.tools)
+			}
+			if !reflect.DeepEqual(completion.ToolChoice, tt.choice) {
+				t.Errorf("tool_choice = %v, want %v", completion.ToolChoice, tt.choice)
+			}
+		})
+	}
+
+	if _, err := convertResponsesRequest(model.ResponsesCompletion{PreviousResponseId: "resp_unknown"}); err == nil {
+		t.Error("an unknown previous_response_id should be rejected")
+	}
+}
+
+func TestResponses(t *testing.T) {
+	withEnv(t, nil)
+
+	var received []model.Keyv[interface{}]
+	reply := func(gtx *gin.Context) error {
+		completion := common.GetGinCompletion(gtx)
+		received = completion.Messages
+		if !completion.Stream {
+			response.Response(gtx, "test", "hello")
+			return nil
+		}
+
+		created := time.Now().Unix()
+		response.SSEResponse(gtx, "test", "hello", created)
+		if completion.Messages[len(completion.Messages)-1].GetString("content") == "fail" {
+			response.Error(gtx, http.StatusBadGateway, "upstream closed")
+			return nil
+		}
+		response.SSEToolCallsResponse(gtx, "test", []response.ToolCall{{Name: "weather", Arguments: `{"city": "Paris"}`}}, created)
+		return nil
+	}
+	h := &Handler{extensions: []inter.Adapter{&fakeAdapter{models: []string{"test"}, completion: reply}}}
+
+	request := func(body string) (model.Keyv[interface{}], string) {
+		gtx, w := newContext(http.MethodPost, "/v1/responses", body)
+		h.responses(gtx)
+		var resp model.Keyv[interface{}]
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp, w.Body.String()
+	}
+
+	t.Run("previous response", func(t *testing.T) {
+		first, body := request(`{"model": "test", "instructions": "be brief", "input": "hi"}`)
+		if !strings.HasPrefix(first.GetString("id"), "resp_") || !first.Is("status", "completed") || len(first.GetSlice("output")) != 1 {
+			t.Fatalf("response = %s", body)
+		}
+		var output model.Keyv[interface{}] = first.GetSlice("output")[0].(map[string]interface{})
+		if !output.Is("type", "message") || output.GetSlice("content")[0].(map[string]interface{})["text"] != "hello" {
+			t.Errorf("output = %v", output)
+		}
+
+		// instructions 不会被继承
+		if _, body = request(`{"model": "test", "previous_response_id": "` + first.GetString("id") + `", "input": "again"}`); !strings.Contains(body, `"completed"`) {
+			t.Fatalf("response = %s", body)
+		}
+		messages, _ := json.Marshal(received)
+		if want := `[{"content":"hi","role":"user"},{"content":"hello","role":"assistant"},{"content":"again","role":"user"}]`; string(messages) != want {
+			t.Errorf("messages =\n%s\nwant\n%s", messages, want)
+		}
+	})
+
+	t.Run("not stored", func(t *testing.T) {
+		first, _ := request(`{"model": "test", "input": "hi", "store": false}`)
+		_, body := request(`{"model": "test", "previous_response_id": "` + first.GetString("id") + `", "input": "again"}`)
+		if !strings.Contains(body, "not found") {
+			t.Errorf("response = %s", body)
+		}
+	})
+
+	stream := func(input string) (events []string, data map[string]model.Keyv[interface{}], arguments string) {
+		gtx, w := newContext(http.MethodPost, "/v1/responses", `{"model": "test", "stream": true, "input": "`+input+`"}`)
+		h.responses(gtx)
+
+		data = make(map[string]model.Keyv[interface{}])
+		for _, e := range parseEvents(w.Body.String()) {
+			var value model.Keyv[interface{}]
+			if err := json.Unmarshal([]byte(e.data), &value); err != nil {
+				t.Fatalf("invalid event %s: %v", e.data, err)
+			}
+			if e.name == "response.function_call_arguments.delta" {
+				arguments += value.GetString("delta")
+			}
+			events = append(events, e.name)
+			data[e.name] = value
+		}
+		return
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		events, data, arguments := stream("hi")
+		if len(events) < 3 || events[0] != "response.created" || events[1] != "response.in_progress" || events[len(events)-1] != "response.completed" {
+			t.Fatalf("events = %v", events)
+		}
+		for _, name := range []string{"response.output_text.delta", "response.output_text.done", "response.function_call_arguments.done"} {
+			if _, ok := data[name]; !ok {
+				t.Errorf("missing %s in %v", name, events)
+			}
+		}
+		if arguments != `{"city": "Paris"}` || data["response.function_call_arguments.done"].GetString("arguments") != arguments {
+			t.Errorf("arguments = %q", arguments)
+		}
+
+		resp := data["response.completed"].GetKeyv("response")
+		if output := resp.GetSlice("output"); len(output) != 2 {
+			t.Errorf("output = %v", output)
+		}
+	})
+
+	t.Run("stream failed", func(t *testing.T) {
+		events, data, _ := stream("fail")
+		if events[len(events)-1] != "response.failed" || !slices.Contains(events, "error") {
+			t.Fatalf("events = %v", events)
+		}
+
+		// 失败的回合不能被续接
+		resp := data["response.failed"].GetKeyv("response")
+		if _, body := request(`{"model": "test", "previous_response_id": "` + resp.GetString("id") + `", "input": "again"}`); !strings.Contains(body, "not found") {
+			t.Errorf("response = %s", body)
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package gin
+
+import (
+	"net/http"
+	"time"
+
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+)
+
+// 响应头，返回实际提供服务的模型
+const servedModelHeader = "X-Served-Model"
+
+// 模型别名路由，按 strategy 排列 targets 中的适配器模型后依次尝试
+type route struct {
+	Alias    string    `mapstructure:"alias"`
+	Strategy string    `mapstructure:"strategy"`
+	Targets  []string  `mapstructure:"targets"`
+	Weights  []float64 `mapstructure:"weights"`
+}
+
+var routes = make(map[string]*balancer)
+
+func init() {
+	inited.AddInitialized(func(env *env.Environment) {
+		var objs []route
+		if err := env.UnmarshalKey("routes", &objs); err != nil {
+			logger.Fatal(err)
+		}
+
+		for i, obj := range objs {
+			if obj.Alias == "" || len(obj.Targets) == 0 {
+				logger.Errorf("the route is not configured correctly: routes[%d]", i)
+				continue
+			}
+			if !validStrategy(obj.Strategy) {
+				logger.Fatalf("unsupported balance strategy: routes[%d].strategy = %s", i, obj.Strategy)
+			}
+			routes[obj.Alias] = newBalancer(obj.Alias, obj.Strategy, obj.Targets, obj.Weights)
+		}
+	})
+}
+
+// 别名对应的负载均衡，不是别名时返回 nil
+func routeOf(alias string) *balancer {
+	return routes[alias]
+}
+
+// 依次尝试别名对应的模型，失败且尚未向客户端输出时换下一个
+func (h *Handler) fallback(gtx *gin.Context, completion model.Completion, b *balancer) {
+	alias := completion.Model
+	targets := b.order()
+	for index, target := range targets {
+		single := completion
+		single.Model = target.Model
+
+		cp := gtx.Copy()
+		w := &fallbackWriter{
+			ResponseWriter: gtx.Writer,
+			header:         make(http.Header),
+			status:         http.StatusOK,
+			served:         target.Model,
+			last:           index == len(targets)-1,
+		}
+		cp.Writer = w
+
+		logger.Infof("route %s => %s", alias, target.Model)
+		start := time.Now()
+		b.begin(target)
+		h.dispatch(cp, single)
+
+		var ttft time.Duration
+		if w.committed {
+			ttft = w.firstByte.Sub(start)
+		}
+		b.end(target, ttft, w.committed && w.status < http.StatusBadRequest)
+		if w.committed {
+			// 限额在 relay 中结算，需要实际提供服务的账号和用量
+			for k, v := range cp.Keys {
+				gtx.Set(k, v)
+			}
+			return
+		}
+
+		logger.Warnf("route %s => %s failed with status %d, try the next one", alias, target.Model, w.status)
+	}
+
+	response.Error(gtx, http.StatusBadGateway, "all the models of '"+alias+"' failed: empty response")
+}
+
+// 401、429、5xx 的响应换下一个模型重试
+func shouldFallback(status int) bool {
+	return status == http.StatusUnauthorized ||
+		status == http.StatusTooManyRequests ||
+		status >= http.StatusInternalServerError
+}
+
+// 在第一次写出前判断响应是否失败，失败的响应被丢弃，成功则原样写出
+type fallbackWriter struct {
+	gin.ResponseWriter
+
+	header http.Header
+	status int
+	served string
+	last   bool
+
+	committed bool // 已向客户端输出
+	failed    bool
+	firstByte time.Time
+}
+
+func (w *fallbackWriter) Header() http.Header {
+	if w.committed {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *fallbackWriter) WriteHeader(code int) {
+	if code > 0 && !w.committed {
+		w.status = code
+	}
+}
+
+func (w *fallbackWriter) WriteHeaderNow() {}
+
+func (w *fallbackWriter) Status() int {
+	if w.committed {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *fallbackWriter) Written() bool { return w.committed || w.failed }
+
+func (w *fallbackWriter) WriteString(str string) (int, error) {
+	return w.Write([]byte(str))
+}
+
+func (w *fallbackWriter) Write(data []byte) (int, error) {
+	if w.failed {
+		return len(data), nil
+	}
+
+	if !w.committed {
+		if !w.last && shouldFallback(w.status) {
+			w.failed = true
+			return len(data), nil
+		}
+		w.commit()
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *fallbackWriter) Flush() {
+	if w.committed {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *fallbackWriter) commit() {
+	w.committed = true
+	w.firstByte = time.Now()
+	h := w.ResponseWriter.Header()
+	for k, v := range w.header {
+		h[k] = v
+	}
+	h.Set(servedModelHeader, w.served)
+	w.ResponseWriter.WriteHeader(w.status)
+}
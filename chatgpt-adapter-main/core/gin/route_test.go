@@ -0,0 +1,121 @@
+package gin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+)
+
+// 注册测试使用的别名路由，结束后移除
+func withRoute(t *testing.T, alias, strategy string, targets ...string) *balancer {
+	t.Helper()
+	b := newBalancer(alias, strategy, targets, nil)
+	routes[alias] = b
+	t.Cleanup(func() { delete(routes, alias) })
+	return b
+}
+
+func TestFallback(t *testing.T) {
+	withEnv(t, nil)
+
+	var tried []string
+	adapter := &fakeAdapter{models: []string{"limited", "broken", "midway", "ok"}, completion: func(gtx *gin.Context) error {
+		completion := common.GetGinCompletion(gtx)
+		tried = append(tried, completion.Model)
+		switch completion.Model {
+		case "limited":
+			response.Error(gtx, http.StatusTooManyRequests, "rate limited")
+		case "broken":
+			response.Error(gtx, http.StatusBadGateway, "upstream failed")
+		case "midway":
+			// 已经开始输出后失败，不能再换模型
+			created := time.Now().Unix()
+			response.SSEResponse(gtx, completion.Model, "partial", created)
+			response.Error(gtx, http.StatusBadGateway, "upstream closed")
+		default:
+			if completion.Stream {
+				created := time.Now().Unix()
+				response.SSEResponse(gtx, completion.Model, "hello", created)
+				response.SSEResponse(gtx, completion.Model, "[DONE]", created)
+				return nil
+			}
+			response.Response(gtx, completion.Model, "hello")
+		}
+		return nil
+	}}
+	h := &Handler{extensions: []inter.Adapter{adapter}}
+
+	tests := []struct {
+		name    string
+		targets []string
+		stream  bool
+		tried   []string
+		served  string
+		code    int
+	}{
+		{"first target", []string{"ok", "limited"}, false, []string{"ok"}, "ok", http.StatusOK},
+		{"fallback", []string{"limited", "broken", "ok"}, false, []string{"limited", "broken", "ok"}, "ok", http.StatusOK},
+		{"fallback stream", []string{"limited", "ok"}, true, []string{"limited", "ok"}, "ok", http.StatusOK},
+		{"all failed", []string{"limited", "broken"}, false, []string{"limited", "broken"}, "broken", http.StatusBadGateway},
+		{"failed after streaming", []string{"midway", "ok"}, true, []string{"midway"}, "midway", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tried = nil
+			withRoute(t, "alias", strategyPriority, tt.targets...)
+
+			body := `{"model": "alias", "messages": [{"role": "user", "content": "hi"}]}`
+			if tt.stream {
+				body = strings.Replace(body, `"model"`, `"stream": true, "model"`, 1)
+			}
+			gtx, w := newContext(http.MethodPost, "/v1/chat/completions", body)
+			h.completions(gtx)
+
+			if strings.Join(tried, ",") != strings.Join(tt.tried, ",") {
+				t.Errorf("tried %v, want %v", tried, tt.tried)
+			}
+			if w.Code != tt.code || w.Header().Get(servedModelHeader) != tt.served {
+				t.Errorf("status = %d, served by %q; want %d, %q: %s", w.Code, w.Header().Get(servedModelHeader), tt.code, tt.served, w.Body)
+			}
+			if tt.code == http.StatusOK && !tt.stream {
+				// 响应中的模型为实际提供服务的模型
+				var resp model.Response
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Model != tt.served {
+					t.Errorf("response = %s", w.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestTextCompletionsRoute(t *testing.T) {
+	withEnv(t, nil)
+	withRoute(t, "alias", strategyPriority, "limited", "ok")
+	adapter := &fakeAdapter{models: []string{"limited", "ok"}, completion: func(gtx *gin.Context) error {
+		if common.GetGinCompletion(gtx).Model == "limited" {
+			response.Error(gtx, http.StatusTooManyRequests, "rate limited")
+			return nil
+		}
+		response.Response(gtx, "ok", " there")
+		return nil
+	}}
+	h := &Handler{extensions: []inter.Adapter{adapter}}
+
+	gtx, w := newContext(http.MethodPost, "/v1/completions", `{"model": "alias", "prompt": "hello"}`)
+	h.textCompletions(gtx)
+
+	var resp model.TextResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Object != "text_completion" || resp.Choices[0].Text != " there" ||
+		w.Header().Get(servedModelHeader) != "ok" {
+		t.Errorf("status = %d, body = %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,209 @@
+package gin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	textSystemPrompt = "You are a text completion engine. Continue the text given by the user exactly where it ends. " +
+		"Output only the continuation, do not repeat the given text and do not add any explanation."
+	textInsertPrompt = "You are a text completion engine. Write the text that belongs between <prefix> and <suffix>. " +
+		"Output only the inserted text, do not repeat the prefix or suffix and do not add any explanation."
+)
+
+// 将文本补全请求包装为对话补全
+func convertTextRequest(request model.TextCompletion) (completion model.Completion, err error) {
+	prompt, err := textPrompt(request.Prompt)
+	if err != nil {
+		return
+	}
+
+	completion = model.Completion{
+		Model:       request.Model,
+		MaxTokens:   request.MaxTokens,
+		Temperature: request.Temperature,
+		TopP:        request.TopP,
+		Stream:      request.Stream,
+	}
+
+	switch stop := request.Stop.(type) {
+	case string:
+		completion.StopSequences = []string{stop}
+	case []interface{}:
+		for _, value := range stop {
+			if str, ok := value.(string); ok {
+				completion.StopSequences = append(completion.StopSequences, str)
+			}
+		}
+	}
+
+	system, content := textSystemPrompt, prompt
+	if request.Suffix != "" {
+		system = textInsertPrompt
+		content = "<prefix>\n" + prompt + "\n</prefix>\n<suffix>\n" + request.Suffix + "\n</suffix>"
+	}
+
+	completion.Messages = []model.Keyv[interface{}]{
+		{"role": "system", "content": system},
+		{"role": "user", "content": content},
+	}
+	return
+}
+
+func textPrompt(prompt interface{}) (string, error) {
+	switch value := prompt.(type) {
+	case string:
+		return value, nil
+	case []interface{}:
+		if len(value) == 1 {
+			if str, ok := value[0].(string); ok {
+				return str, nil
+			}
+		}
+		if len(value) > 1 {
+			return "", errors.New("only a single prompt is supported - 'prompt'")
+		}
+	}
+	return "", errors.New("prompt must be a string - 'prompt'")
+}
+
+// OpenAI chat.completion => text_completion 响应转换
+type textConverter struct {
+	gtx     *gin.Context
+	id      string
+	created int64
+	model   string
+	prompt  string
+	echo    bool
+
+	started      bool
+	output       string
+	finishReason string
+	usage        map[string]interface{}
+}
+
+func newTextConverter(gtx *gin.Context, request model.TextCompletion) *textConverter {
+	prompt, _ := textPrompt(request.Prompt)
+	return &textConverter{
+		gtx:     gtx,
+		id:      "cmpl-" + common.Hex(24),
+		created: time.Now().Unix(),
+		model:   request.Model,
+		prompt:  prompt,
+		echo:    request.Echo,
+	}
+}
+
+func (*textConverter) ContentType() string { return "text/event-stream" }
+
+func (c *textConverter) Chunk(w io.Writer, chunk model.Response) {
+	if !c.started {
+		c.started = true
+		if c.echo && c.prompt != "" {
+			writeEvent(w, "", c.response(c.prompt, nil))
+		}
+	}
+
+	if chunk.Usage != nil {
+		c.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			c.finishReason = *choice.FinishReason
+		}
+
+		if choice.Delta == nil || choice.Delta.Content == "" {
+			continue
+		}
+
+		c.output += choice.Delta.Content
+		writeEvent(w, "", c.response(choice.Delta.Content, nil))
+	}
+}
+
+func (c *textConverter) Done(w io.Writer) {
+	finishReason := c.finishReason
+	if finishReason == "" {
+		finishReason = "stop"
+	}
+
+	resp := c.response("", &finishReason)
+	resp.Usage = c.calcUsage()
+	writeEvent(w, "", resp)
+	if _, err := fmt.Fprint(w, "data: [DONE]\n\n"); err != nil {
+		logger.Error(err)
+	}
+}
+
+func (c *textConverter) Response(w io.Writer, resp model.Response) {
+	finishReason := "stop"
+	choice := resp.Choices[0]
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		finishReason = *choice.FinishReason
+	}
+
+	if choice.Message != nil {
+		c.output = choice.Message.Content
+	}
+
+	text := c.output
+	if c.echo {
+		text = c.prompt + text
+	}
+
+	c.usage = resp.Usage
+	result := c.response(text, &finishReason)
+	result.Usage = c.calcUsage()
+	writeJSON(w, result)
+}
+
+func (c *textConverter) Error(w io.Writer, code int, message string, sse bool) {
+	data := map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+		},
+	}
+
+	if sse {
+		writeEvent(w, "", data)
+		return
+	}
+	writeJSON(w, data)
+}
+
+func (c *textConverter) response(text string, finishReason *string) model.TextResponse {
+	return model.TextResponse{
+		Id:      c.id,
+		Object:  "text_completion",
+		Created: c.created,
+		Model:   c.model,
+		Choices: []model.TextChoice{
+			{
+				Index:        0,
+				Text:         text,
+				FinishReason: finishReason,
+			},
+		},
+	}
+}
+
+func (c *textConverter) calcUsage() map[string]interface{} {
+	if c.usage != nil {
+		return c.usage
+	}
+	return response.CalcUsageTokens(c.output, c.gtx.GetInt(ginTokens))
+}
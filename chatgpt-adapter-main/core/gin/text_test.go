@@ -0,0 +1,125 @@
+package gin
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConvertTextRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		system  string
+		content string
+		stop    []string
+		ok      bool
+	}{
+		{"string", `{"prompt": "once upon", "stop": "\n"}`, textSystemPrompt, "once upon", []string{"\n"}, true},
+		{"single item array", `{"prompt": ["once upon"], "stop": ["a", 1, "b"]}`, textSystemPrompt, "once upon", []string{"a", "b"}, true},
+		{"suffix", `{"prompt": "func main() {", "suffix": "}"}`, textInsertPrompt, "<prefix>\nfunc main() {\n</prefix>\n<suffix>\n}\n</suffix>", nil, true},
+		{"several prompts", `{"prompt": ["a", "b"]}`, "", "", nil, false},
+		{"token ids", `{"prompt": [1, 2, 3]}`, "", "", nil, false},
+		{"missing prompt", `{}`, "", "", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request model.TextCompletion
+			if err := json.Unmarshal([]byte(tt.request), &request); err != nil {
+				t.Fatal(err)
+			}
+			completion, err := convertTextRequest(request)
+			if (err == nil) != tt.ok {
+				t.Fatalf("convertTextRequest = %v, want ok %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+
+			messages := completion.Messages
+			if len(messages) != 2 || messages[0].GetString("content") != tt.system || messages[1].GetString("content") != tt.content {
+				t.Errorf("messages = %v", messages)
+			}
+			if !reflect.DeepEqual(completion.StopSequences, tt.stop) {
+				t.Errorf("stop = %q, want %q", completion.StopSequences, tt.stop)
+			}
+		})
+	}
+}
+
+func TestTextCompletions(t *testing.T) {
+	withEnv(t, nil)
+	h := &Handler{extensions: []inter.Adapter{&fakeAdapter{models: []string{"test"}, completion: func(gtx *gin.Context) error {
+		if common.GetGinCompletion(gtx).Stream {
+			created := time.Now().Unix()
+			response.SSEResponse(gtx, "test", " there", created)
+			response.SSEResponse(gtx, "test", "[DONE]", created)
+			return nil
+		}
+		response.Response(gtx, "test", " there")
+		return nil
+	}}}}
+
+	t.Run("echo", func(t *testing.T) {
+		gtx, w := newContext(http.MethodPost, "/v1/completions", `{"model": "test", "prompt": "hello", "echo": true}`)
+		h.textCompletions(gtx)
+
+		var resp model.TextResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid response %s: %v", w.Body, err)
+		}
+		if !strings.HasPrefix(resp.Id, "cmpl-") || resp.Object != "text_completion" || len(resp.Choices) != 1 ||
+			resp.Choices[0].Text != "hello there" || resp.Choices[0].FinishReason == nil || *resp.Choices[0].FinishReason != "stop" {
+			t.Errorf("response = %s", w.Body)
+		}
+		if resp.Usage == nil {
+			t.Error("response without usage")
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		gtx, w := newContext(http.MethodPost, "/v1/completions", `{"model": "test", "prompt": "hello", "stream": true}`)
+		h.textCompletions(gtx)
+
+		events := parseEvents(w.Body.String())
+		if len(events) == 0 || events[len(events)-1].data != "[DONE]" {
+			t.Fatalf("events = %s", w.Body)
+		}
+
+		text, finish := "", ""
+		for _, e := range events[:len(events)-1] {
+			var chunk model.TextResponse
+			if err := json.Unmarshal([]byte(e.data), &chunk); err != nil {
+				t.Fatalf("invalid chunk %s: %v", e.data, err)
+			}
+			if chunk.Object != "text_completion" {
+				t.Errorf("object = %q", chunk.Object)
+			}
+			text += chunk.Choices[0].Text
+			if chunk.Choices[0].FinishReason != nil {
+				finish = *chunk.Choices[0].FinishReason
+			}
+		}
+		if text != " there" || finish != "stop" {
+			t.Errorf("text = %q, finish reason = %q", text, finish)
+		}
+	})
+
+	t.Run("invalid prompt", func(t *testing.T) {
+		gtx, w := newContext(http.MethodPost, "/v1/completions", `{"model": "test", "prompt": ["a", "b"]}`)
+		h.textCompletions(gtx)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "single prompt") {
+			t.Errorf("status = %d, body = %s", w.Code, w.Body)
+		}
+	})
+}
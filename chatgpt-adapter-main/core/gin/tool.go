@@ -0,0 +1,68 @@
+package gin
+
+import (
+	"fmt"
+	"net/http"
+
+	"chatgpt-adapter/core/common/toolcall"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// @POST(path = "v1/tool/prompt")
+func (h *Handler) toolPrompt(gtx *gin.Context) {
+	var completion model.Completion
+	if err := gtx.BindJSON(&completion); err != nil {
+		logger.Error(err)
+		response.Error(gtx, -1, err)
+		return
+	}
+
+	// 只渲染工具提示词，不调用上游。?tasks=true 时渲染任务拆解的提示词
+	gtx.Set(vars.GinCompletion, completion)
+	if !authorize(gtx, completion.Model) {
+		return
+	}
+
+	for _, extension := range h.extensions {
+		ok, err := extension.Match(gtx, completion.Model)
+		if err != nil {
+			response.Error(gtx, -1, err)
+			return
+		}
+		if !ok {
+			continue
+		}
+		if !authorizeAdapter(gtx, extension) {
+			return
+		}
+
+		messages, err := extension.HandleMessages(gtx, completion)
+		if err != nil {
+			response.Error(gtx, http.StatusInternalServerError, err)
+			return
+		}
+
+		completion.Messages = messages
+		gtx.Set(vars.GinCompletion, completion)
+
+		t, prompt, err := toolcall.Render(gtx, completion, gtx.Query("tasks") == "true")
+		if err != nil {
+			response.Error(gtx, http.StatusBadRequest, err)
+			return
+		}
+
+		gtx.JSON(http.StatusOK, gin.H{
+			"model":     completion.Model,
+			"template":  t.Name,
+			"lang":      t.Lang,
+			"need_exec": toolcall.NeedExec(gtx),
+			"prompt":    prompt,
+		})
+		return
+	}
+	response.Error(gtx, -1, fmt.Sprintf("model '%s' is not not yet supported", completion.Model))
+}
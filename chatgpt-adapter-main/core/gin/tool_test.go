@@ -0,0 +1,55 @@
+package gin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+)
+
+func TestToolPromptAuthorization(t *testing.T) {
+	withEnv(t, nil)
+	h := &Handler{extensions: []inter.Adapter{&fakeAdapter{models: []string{"allowed", "other"}}}}
+	body := `{"model": "%s", "messages": [{"role": "user", "content": "hi"}],
+		"tools": [{"type": "function", "function": {"name": "search", "description": "search the web", "parameters": {"type": "object"}}}]}`
+
+	tests := []struct {
+		name  string
+		model string
+		key   *model.ApiKey
+		code  int
+	}{
+		{"no key", "allowed", nil, http.StatusOK},
+		{"allowed", "allowed", &model.ApiKey{Models: []string{"allowed"}, Pool: true}, http.StatusOK},
+		{"model not allowed", "other", &model.ApiKey{Models: []string{"allowed"}, Pool: true}, http.StatusForbidden},
+		{"adapter not allowed", "allowed", &model.ApiKey{Adapters: []string{"cursor"}, Pool: true}, http.StatusForbidden},
+		{"no credentials", "allowed", &model.ApiKey{}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gtx, w := newContext(http.MethodPost, "/v1/tool/prompt", fmt.Sprintf(body, tt.model))
+			if tt.key != nil {
+				withKey(t, gtx, tt.key)
+			}
+			h.toolPrompt(gtx)
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var result struct {
+				Template string `json:"template"`
+				Prompt   string `json:"prompt"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || result.Template != "default" || result.Prompt == "" {
+				t.Errorf("response = %s, %v", w.Body, err)
+			}
+		})
+	}
+}
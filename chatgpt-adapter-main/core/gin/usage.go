@@ -0,0 +1,157 @@
+package gin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/ledger"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/inter"
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"github.com/gin-gonic/gin"
+	"github.com/iocgo/sdk/env"
+)
+
+const (
+	ginAdapter  = "__adapter__"
+	ginRecorded = "__recorded__"
+
+	maxUsageDays = 366
+)
+
+// 直接使用的上游凭证，使用账号池时为空
+func tokenAccount(gtx *gin.Context) string {
+	token := gtx.GetString("token")
+	if token == "" || token == env.Env.GetString("server.password") {
+		return ""
+	}
+	return "token:" + common.CalcHex(token)[:12]
+}
+
+// 本次请求使用的上游账号
+func accountOf(gtx *gin.Context) string {
+	if id := gtx.GetString(vars.GinAccount); id != "" {
+		return id
+	}
+	return tokenAccount(gtx)
+}
+
+func matched(gtx *gin.Context, extension inter.Adapter) {
+	gtx.Set(ginAdapter, adapterName(extension))
+}
+
+// 记录本次请求的用量，返回请求结束后写入的函数
+func record(gtx *gin.Context, mod string) func() {
+	// 文本补全转换为对话补全时已经记录
+	if !ledger.Enabled() || gtx.GetBool(ginRecorded) {
+		return func() {}
+	}
+	gtx.Set(ginRecorded, true)
+
+	start := time.Now()
+	return func() {
+		row := ledger.Row{
+			Time:    start,
+			Model:   mod,
+			Adapter: gtx.GetString(ginAdapter),
+			Account: accountOf(gtx),
+			Latency: time.Since(start).Milliseconds(),
+			Status:  gtx.Writer.Status(),
+		}
+
+		if key, ok := common.GetGinValue[*model.ApiKey](gtx, vars.GinApiKey); ok {
+			row.Key, row.Label, row.Tenant = keyId(key), key.Label, key.Tenant
+		}
+
+		if gtx.Writer.Written() {
+			row.PromptTokens, row.CompletionTokens = usageTokens(gtx, common.GetGinCompletionUsage(gtx), "")
+		}
+		ledger.Record(row)
+	}
+}
+
+// @GET(path = "v1/usage")
+func (h *Handler) usage(gtx *gin.Context) {
+	key, ok := common.GetGinValue[*model.ApiKey](gtx, vars.GinApiKey)
+	if !ok {
+		response.Error(gtx, http.StatusNotFound, "the api key is not configured")
+		return
+	}
+
+	id := keyId(key)
+	summarize(gtx, func(row ledger.Row) bool { return row.Key == id })
+}
+
+// @GET(path = "v1/admin/usage")
+func (h *Handler) usages(gtx *gin.Context) {
+	if !admin(gtx) {
+		return
+	}
+
+	var (
+		key    = gtx.Query("key")
+		tenant = gtx.Query("tenant")
+		mod    = gtx.Query("model")
+	)
+	summarize(gtx, func(row ledger.Row) bool {
+		return (key == "" || row.Key == key || row.Label == key) &&
+			(tenant == "" || row.Tenant == tenant) &&
+			(mod == "" || row.Model == mod)
+	})
+}
+
+// 按 from、to 日期以及 group_by 汇总用量，默认最近 30 天按天和模型分组
+func summarize(gtx *gin.Context, filter func(ledger.Row) bool) {
+	if !ledger.Enabled() {
+		response.Error(gtx, http.StatusNotFound, "the usage ledger is disabled, please configure 'usage.enabled'")
+		return
+	}
+
+	to := time.Now()
+	if value := gtx.Query("to"); value != "" {
+		t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+		if err != nil {
+			response.Error(gtx, http.StatusBadRequest, "invalid 'to' date: "+value)
+			return
+		}
+		to = t
+	}
+
+	from := to.AddDate(0, 0, -29)
+	if value := gtx.Query("from"); value != "" {
+		t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+		if err != nil {
+			response.Error(gtx, http.StatusBadRequest, "invalid 'from' date: "+value)
+			return
+		}
+		from = t
+	}
+
+	// 每一天对应一个文件，限制扫描的范围
+	if to.Before(from) || to.Sub(from) > maxUsageDays*24*time.Hour {
+		response.Error(gtx, http.StatusBadRequest, fmt.Sprintf("the range from 'from' to 'to' must be within %d days", maxUsageDays))
+		return
+	}
+
+	groupBy := []string{"day", "model"}
+	if value := gtx.Query("group_by"); value != "" {
+		groupBy = strings.Split(value, ",")
+	}
+
+	data, err := ledger.Summarize(ledger.Path(env.Env), from, to, groupBy, filter)
+	if err != nil {
+		response.Error(gtx, http.StatusInternalServerError, err)
+		return
+	}
+
+	gtx.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"from":   from.Format(time.DateOnly),
+		"to":     to.Format(time.DateOnly),
+		"data":   data,
+	})
+}
@@ -0,0 +1,66 @@
+package gin
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/vars"
+	"chatgpt-adapter/core/gin/model"
+)
+
+func TestAccountOf(t *testing.T) {
+	withEnv(t, map[string]interface{}{"server.password": "pool-password"})
+
+	tests := []struct {
+		name    string
+		token   string
+		account string
+		want    string
+	}{
+		{"pool account", "pool-password", "coze:0123456789ab", "coze:0123456789ab"},
+		{"direct token", "cookie", "", "token:" + common.CalcHex("cookie")[:12]},
+		{"pool without account", "pool-password", "", ""},
+		{"no token", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gtx, _ := newContext(http.MethodPost, "/v1/chat/completions", "")
+			gtx.Set("token", tt.token)
+			if tt.account != "" {
+				gtx.Set(vars.GinAccount, tt.account)
+			}
+			if got := accountOf(gtx); got != tt.want {
+				t.Errorf("accountOf = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsage(t *testing.T) {
+	withEnv(t, map[string]interface{}{"server.admin-key": "admin"})
+	h := &Handler{}
+
+	// 没有使用网关密钥
+	gtx, w := newContext(http.MethodGet, "/v1/usage", "")
+	h.usage(gtx)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "api key is not configured") {
+		t.Errorf("status = %d, body = %s", w.Code, w.Body)
+	}
+
+	gtx, w = newContext(http.MethodGet, "/v1/usage", "")
+	withKey(t, gtx, &model.ApiKey{Key: "sk-team"})
+	h.usage(gtx)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "usage.enabled") {
+		t.Errorf("status = %d, body = %s", w.Code, w.Body)
+	}
+
+	gtx, w = newContext(http.MethodGet, "/v1/admin/usage", "")
+	gtx.Set("token", "wrong")
+	h.usages(gtx)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+}
@@ -1,7 +1,7 @@
 package gin
 
 import (
-	"chatgpt-adapter/core/common/toolcall"
+	"chatgpt-adapter/core/common"
 	"chatgpt-adapter/core/common/vars"
 	"chatgpt-adapter/core/gin/inter"
 	"chatgpt-adapter/core/gin/model"
@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/iocgo/sdk"
+	"net/http"
+	"slices"
 	"time"
 )
 
@@ -44,12 +46,59 @@ func (h *Handler) completions(gtx *gin.Context) {
 		return
 	}
 
+	h.relay(gtx, completion)
+}
+
+// 遍历适配器执行对话补全，其它协议的接口转换为 model.Completion 后也由此分发
+func (h *Handler) relay(gtx *gin.Context, completion model.Completion) {
 	gtx.Set(vars.GinCompletion, completion)
 	logger.Infof("curr model: %s", completion.Model)
 	if !response.MessageValidator(gtx) {
 		return
 	}
 
+	if completion.N > maxChoices() {
+		response.Error(gtx, http.StatusBadRequest, fmt.Sprintf("n must be at most %d", maxChoices()))
+		return
+	}
+
+	completion.Messages = injectResponseFormat(completion)
+	key, hasKey := common.GetGinValue[*model.ApiKey](gtx, vars.GinApiKey)
+	if hasKey && !key.AllowModel(completion.Model) {
+		response.Error(gtx, http.StatusForbidden, "the api key is not allowed to access model '"+completion.Model+"'")
+		return
+	}
+
+	// 限额在路由之前检查一次，网关自身的 429 不会触发别名路由的重试
+	b := routeOf(completion.Model)
+	if b == nil && hasKey && !credential(gtx, key, completion.Model) {
+		return
+	}
+
+	settle, ok := limit(gtx, completion.Model, completion.N)
+	if !ok {
+		return
+	}
+	defer settle()
+
+	if b != nil {
+		h.fallback(gtx, completion, b)
+		return
+	}
+	h.dispatch(gtx, completion)
+}
+
+// 交给匹配模型的适配器执行
+func (h *Handler) dispatch(gtx *gin.Context, completion model.Completion) {
+	gtx.Set(vars.GinCompletion, completion)
+	if key, ok := common.GetGinValue[*model.ApiKey](gtx, vars.GinApiKey); ok && !credential(gtx, key, completion.Model) {
+		return
+	}
+	if !limitAccount(gtx) {
+		return
+	}
+	defer record(gtx, completion.Model)()
+
 	for _, extension := range h.extensions {
 		ok, err := extension.Match(gtx, completion.Model)
 		if err != nil {
@@ -60,14 +109,20 @@ func (h *Handler) completions(gtx *gin.Context) {
 			continue
 		}
 
-		gtx.Set(vars.GinMatchers, response.NewMatchers(gtx, func(t byte, str string) {
-			if completion.Stream && t == 0 {
-				response.SSEResponse(gtx, "matcher", str, time.Now().Unix())
-			}
-			if completion.Stream && t == 1 {
-				response.ReasonSSEResponse(gtx, "matcher", "", str, time.Now().Unix())
-			}
-		}))
+		if !authorizeAdapter(gtx, extension) {
+			return
+		}
+		matched(gtx, extension)
+
+		c := circuitOf(extension, completion.Model)
+		probe, allowed, retry := c.allow()
+		if !allowed {
+			c.reject(gtx, retry)
+			return
+		}
+		defer func() { c.done(probe, outcomeOf(gtx)) }()
+
+		gtx.Set(vars.GinMatchers, newMatchers(gtx, completion.Stream))
 
 		messages, err := extension.HandleMessages(gtx, completion)
 		if err != nil {
@@ -83,24 +138,105 @@ func (h *Handler) completions(gtx *gin.Context) {
 		completion.Messages = messages
 		gtx.Set(vars.GinCompletion, completion)
 
-		if toolcall.NeedExec(gtx) {
-			if ok, err = extension.ToolChoice(gtx); err != nil {
-				response.Error(gtx, -1, err)
-				return
-			}
-			if ok {
-				return
-			}
+		// 每个 choice 各自执行工具选择
+		if completion.N > 1 {
+			multiCompletion(gtx, extension, completion)
+			return
+		}
+
+		if err = completeChoice(gtx, extension); err != nil {
+			response.Error(gtx, -1, err)
+		}
+		return
+	}
+	response.Error(gtx, -1, fmt.Sprintf("model '%s' is not not yet supported", completion.Model))
+}
+
+func newMatchers(gtx *gin.Context, stream bool) []inter.Matcher {
+	return response.NewMatchers(gtx, func(t byte, str string) {
+		if stream && t == 0 {
+			response.SSEResponse(gtx, "matcher", str, time.Now().Unix())
+		}
+		if stream && t == 1 {
+			response.ReasonSSEResponse(gtx, "matcher", "", str, time.Now().Unix())
+		}
+	})
+}
+
+// @POST(path = "
+//
+//	v1/completions,
+//	proxies/v1/completions
+//
+// ")
+func (h *Handler) textCompletions(gtx *gin.Context) {
+	var completion model.TextCompletion
+	if err := gtx.BindJSON(&completion); err != nil {
+		logger.Error(err)
+		response.Error(gtx, -1, err)
+		return
+	}
+
+	gtx.Set(vars.GinTextCompletion, completion)
+	logger.Infof("curr model: %s", completion.Model)
+
+	// 别名路由包装成对话补全，由 relay 按路由依次尝试
+	if routeOf(completion.Model) != nil {
+		h.textAsChat(gtx, completion)
+		return
+	}
+
+	if !authorize(gtx, completion.Model) {
+		return
+	}
+
+	settle, ok := limit(gtx, completion.Model, 1)
+	if !ok {
+		return
+	}
+	defer settle()
+	defer record(gtx, completion.Model)()
+
+	for _, extension := range h.extensions {
+		ok, err := extension.Match(gtx, completion.Model)
+		if err != nil {
+			response.Error(gtx, -1, err)
+			return
+		}
+		if !ok {
+			continue
+		}
+
+		if !authorizeAdapter(gtx, extension) {
+			return
 		}
+		matched(gtx, extension)
 
-		if err = extension.Completion(gtx); err != nil {
+		if ok, err = extension.TextCompletion(gtx); err != nil {
 			response.Error(gtx, -1, err)
+			return
+		}
+
+		// 不支持文本补全的适配器，包装成对话补全
+		if !ok {
+			h.textAsChat(gtx, completion)
 		}
 		return
 	}
 	response.Error(gtx, -1, fmt.Sprintf("model '%s' is not not yet supported", completion.Model))
 }
 
+func (h *Handler) textAsChat(gtx *gin.Context, completion model.TextCompletion) {
+	chat, err := convertTextRequest(completion)
+	if err != nil {
+		response.Error(gtx, http.StatusBadRequest, err)
+		return
+	}
+	withConverter(gtx, newTextConverter(gtx, completion), func() {
+		h.relay(gtx, chat)
+	})
+}
+
 func calcTokens(gtx *gin.Context, messages []model.Keyv[interface{}]) {
 	tokens := 0
 	for _, message := range messages {
@@ -129,6 +265,17 @@ func (h *Handler) embeddings(gtx *gin.Context) {
 
 	gtx.Set(vars.GinEmbedding, embed)
 	logger.Infof("curr model: %s", embed.Model)
+	if !authorize(gtx, embed.Model) {
+		return
+	}
+
+	settle, ok := limit(gtx, embed.Model, 1)
+	if !ok {
+		return
+	}
+	defer settle()
+	defer record(gtx, embed.Model)()
+
 	for _, extension := range h.extensions {
 		ok, err := extension.Match(gtx, embed.Model)
 		if err != nil {
@@ -136,6 +283,10 @@ func (h *Handler) embeddings(gtx *gin.Context) {
 			return
 		}
 		if ok {
+			if !authorizeAdapter(gtx, extension) {
+				return
+			}
+			matched(gtx, extension)
 			if err = extension.Embedding(gtx); err != nil {
 				response.Error(gtx, -1, err)
 			}
@@ -160,6 +311,17 @@ func (h *Handler) generations(gtx *gin.Context) {
 	}
 
 	gtx.Set(vars.GinGeneration, generation)
+	if !authorize(gtx, generation.Model) {
+		return
+	}
+
+	settle, ok := limit(gtx, generation.Model, 1)
+	if !ok {
+		return
+	}
+	defer settle()
+	defer record(gtx, generation.Model)()
+
 	for _, extension := range h.extensions {
 		ok, err := extension.Match(gtx, generation.Model)
 		if err != nil {
@@ -167,6 +329,10 @@ func (h *Handler) generations(gtx *gin.Context) {
 			return
 		}
 		if ok {
+			if !authorizeAdapter(gtx, extension) {
+				return
+			}
+			matched(gtx, extension)
 			if err = extension.Generation(gtx); err != nil {
 				response.Error(gtx, -1, err)
 			}
@@ -187,6 +353,14 @@ func (h *Handler) models(gtx *gin.Context) {
 	for _, extension := range h.extensions {
 		models = append(models, extension.Models()...)
 	}
+	for alias := range routes {
+		models = append(models, model.Model{Id: alias, Object: "model", Created: 1686935002, By: "route"})
+	}
+
+	// 只返回密钥允许访问的模型
+	if key, ok := common.GetGinValue[*model.ApiKey](gtx, vars.GinApiKey); ok {
+		models = slices.DeleteFunc(models, func(mod model.Model) bool { return !key.AllowModel(mod.Id) })
+	}
 	gtx.JSON(200, gin.H{
 		"object": "list",
 		"data":   models,
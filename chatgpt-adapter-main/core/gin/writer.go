@@ -0,0 +1,261 @@
+package gin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"chatgpt-adapter/core/gin/model"
+	"chatgpt-adapter/core/gin/response"
+	"chatgpt-adapter/core/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// 协议转换器：适配器统一输出 OpenAI 格式，由转换器改写为其它协议的格式
+type converter interface {
+	// 流式响应的 Content-Type
+	ContentType() string
+	// 流式响应块
+	Chunk(w io.Writer, chunk model.Response)
+	// 流式响应结束，对应 [DONE]
+	Done(w io.Writer)
+	// 非流式响应
+	Response(w io.Writer, resp model.Response)
+	// 异常响应，sse 为 true 时已经开始流式输出
+	Error(w io.Writer, code int, message string, sse bool)
+}
+
+// 拦截适配器的输出，交由 converter 转换后再写出
+type protoWriter struct {
+	gin.ResponseWriter
+
+	conv   converter
+	header http.Header
+	status int
+
+	sse    bool
+	begin  bool // 已向客户端写出响应头
+	done   bool
+	buffer []byte
+}
+
+func newProtoWriter(w gin.ResponseWriter, conv converter) *protoWriter {
+	return &protoWriter{
+		ResponseWriter: w,
+		conv:           conv,
+		header:         make(http.Header),
+		status:         http.StatusOK,
+	}
+}
+
+func (w *protoWriter) Header() http.Header { return w.header }
+func (w *protoWriter) WriteHeaderNow()     {}
+func (w *protoWriter) Status() int         { return w.status }
+func (w *protoWriter) Written() bool       { return w.begin || len(w.buffer) > 0 }
+func (w *protoWriter) WriteHeader(code int) {
+	if code > 0 && !w.begin {
+		w.status = code
+	}
+}
+
+func (w *protoWriter) WriteString(str string) (int, error) {
+	return w.Write([]byte(str))
+}
+
+func (w *protoWriter) Write(data []byte) (int, error) {
+	if !w.Written() {
+		w.sse = strings.Contains(w.header.Get("Content-Type"), "text/event-stream")
+	}
+
+	w.buffer = append(w.buffer, data...)
+	if w.sse {
+		w.events()
+	}
+	return len(data), nil
+}
+
+func (w *protoWriter) Flush() {
+	if w.begin {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// 处理已接收完整的 SSE 事件块
+func (w *protoWriter) events() {
+	for {
+		idx := bytes.Index(w.buffer, []byte("\n\n"))
+		if idx < 0 {
+			return
+		}
+
+		block := string(w.buffer[:idx])
+		w.buffer = w.buffer[idx+2:]
+		w.event(block)
+	}
+}
+
+func (w *protoWriter) event(block string) {
+	data := ""
+	for _, line := range strings.Split(block, "\n") {
+		if strings.HasPrefix(line, "data:") {
+			data += strings.TrimSpace(line[5:])
+		}
+	}
+
+	if data == "" {
+		return
+	}
+
+	w.start(w.conv.ContentType())
+	if data == "[DONE]" {
+		w.finish()
+		return
+	}
+
+	var chunk model.Response
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	if chunk.Error != nil {
+		w.conv.Error(w.ResponseWriter, http.StatusInternalServerError, chunk.Error.Message, true)
+		return
+	}
+	w.conv.Chunk(w.ResponseWriter, chunk)
+}
+
+func (w *protoWriter) finish() {
+	if w.done {
+		return
+	}
+	w.done = true
+	w.conv.Done(w.ResponseWriter)
+}
+
+func (w *protoWriter) start(contentType string) {
+	if w.begin {
+		return
+	}
+
+	w.begin = true
+	h := w.ResponseWriter.Header()
+	for k, v := range w.header {
+		h[k] = v
+	}
+	h.Set("Content-Type", contentType)
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Close 适配器处理完毕后调用，写出剩余的内容
+func (w *protoWriter) Close() {
+	defer w.ResponseWriter.Flush()
+	if w.sse && w.begin {
+		// 流式输出中途出现的异常是以JSON格式写出的
+		if raw := bytes.TrimSpace(w.buffer); len(raw) > 0 {
+			if message, ok := errorMessage(raw); ok {
+				w.conv.Error(w.ResponseWriter, w.status, message, true)
+			}
+		}
+		w.finish()
+		return
+	}
+
+	raw := bytes.TrimSpace(w.buffer)
+	if len(raw) == 0 {
+		if !w.sse {
+			w.start("application/json; charset=utf-8")
+		}
+		return
+	}
+
+	if w.status >= http.StatusBadRequest {
+		message, ok := errorMessage(raw)
+		if !ok {
+			message = string(raw)
+		}
+		w.start("application/json; charset=utf-8")
+		w.conv.Error(w.ResponseWriter, w.status, message, false)
+		return
+	}
+
+	var resp model.Response
+	if err := json.Unmarshal(raw, &resp); err != nil || len(resp.Choices) == 0 {
+		// 无法识别的内容原样输出
+		w.start(w.header.Get("Content-Type"))
+		_, _ = w.ResponseWriter.Write(w.buffer)
+		return
+	}
+
+	w.start("application/json; charset=utf-8")
+	w.conv.Response(w.ResponseWriter, resp)
+}
+
+func errorMessage(raw []byte) (message string, ok bool) {
+	var obj model.Keyv[interface{}]
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return
+	}
+
+	e := obj.GetKeyv("error")
+	if e == nil {
+		return
+	}
+	return e.GetString("message"), true
+}
+
+// 替换 gin.Context 的 Writer，执行完毕后还原
+func withConverter(gtx *gin.Context, conv converter, apply func()) {
+	writer := gtx.Writer
+	w := newProtoWriter(writer, conv)
+	gtx.Writer = w
+	defer func() {
+		w.Close()
+		gtx.Writer = writer
+	}()
+	apply()
+}
+
+func writeEvent(w io.Writer, event string, data interface{}) {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	layout := ""
+	if event != "" {
+		layout = "event: " + event + "\n"
+	}
+	layout += "data: %s\n\n"
+	if _, err = fmt.Fprintf(w, layout, bytes); err != nil {
+		logger.Error(err)
+	}
+}
+
+func writeJSON(w io.Writer, data interface{}) {
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logger.Error(err)
+	}
+}
+
+// 读取 usage 中的 token 数，适配器未返回 usage 时按输出内容计算
+func usageTokens(gtx *gin.Context, usage map[string]interface{}, output string) (promptTokens, completionTokens int) {
+	if usage == nil {
+		usage = response.CalcUsageTokens(output, gtx.GetInt(ginTokens))
+	}
+
+	for key, value := range map[string]*int{"prompt_tokens": &promptTokens, "completion_tokens": &completionTokens} {
+		switch number := usage[key].(type) {
+		case float64:
+			*value = int(number)
+		case int:
+			*value = number
+		}
+	}
+	return
+}
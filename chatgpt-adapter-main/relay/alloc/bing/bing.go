@@ -59,13 +59,14 @@ func InvocationHandler(ctx *proxy.Context) {
 		return
 	}
 
-	cookie, err := cookiesContainer.Poll()
+	cookie, err := cookiesContainer.PollBy(common.StickyKey(gtx))
 	if err != nil {
 		logger.Error(err)
 		response.Error(gtx, -1, err)
 		return
 	}
 	defer resetMarked(cookie)
+	gtx.Set(vars.GinAccount, cookiesContainer.Id(cookie))
 	gtx.Set("token", cookie)
 
 	//
@@ -81,17 +82,18 @@ func InvocationHandler(ctx *proxy.Context) {
 
 	if err != nil {
 		logger.Error(err)
+		_ = cookiesContainer.MarkFailed(cookie, common.ReasonOf(err))
 		return
 	}
 }
 
 func condition(cookie map[string]string, argv ...interface{}) bool {
-	marker, err := cookiesContainer.Marked(cookie)
+	ok, err := cookiesContainer.Available(cookie)
 	if err != nil {
 		logger.Error(err)
 		return false
 	}
-	return marker == 0
+	return ok
 }
 
 func resetMarked(cookie map[string]string) {
@@ -1,14 +1,17 @@
 package coze
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"chatgpt-adapter/core/common"
 	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/common/store"
 	"chatgpt-adapter/core/common/vars"
 	"chatgpt-adapter/core/gin/model"
 	"chatgpt-adapter/core/gin/response"
@@ -49,7 +52,40 @@ func init() {
 
 		cookiesContainer = common.NewPollContainer("coze", make([]*account, 0), 60*time.Second) // 报错进入60秒冷却
 		cookiesContainer.Condition = condition(env.GetString("server.proxied"))
-		run(env, values...)
+		// 管理接口添加的账号需要先登录
+		cookiesContainer.Append = func(raw json.RawMessage) error {
+			var value account
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return err
+			}
+			go runTasks(env, &obj{&value, w_retry})
+			return nil
+		}
+		// 管理接口添加的账号，以及缓存了登录凭证的账号无需重新登录
+		cookiesContainer.Each(func(value *account) bool {
+			_ = cookiesContainer.Remove(value)
+			if !slices.ContainsFunc(values, func(item *account) bool { return item.E == value.E }) {
+				values = append(values, value)
+			}
+			return true
+		})
+
+		tasks := make([]*account, 0, len(values))
+		for _, value := range values {
+			if cookiesContainer.Removed(value) {
+				continue
+			}
+
+			var cookies string
+			if _, ok := store.Credential("coze", value.E, &cookies); ok && cookies != "" {
+				value.Cookies = cookies
+				cookiesContainer.Add(value)
+				logger.Infof("coze websdk 恢复登录凭证[%s]", value.E)
+				continue
+			}
+			tasks = append(tasks, value)
+		}
+		run(env, tasks...)
 	})
 }
 
@@ -76,7 +112,7 @@ func InvocationHandler(ctx *proxy.Context) {
 	)
 
 	if isSdk(context, completion.Model) {
-		meta, err = cookiesContainer.Poll()
+		meta, err = cookiesContainer.PollBy(common.StickyKey(context))
 		if err != nil {
 			logger.Error(err)
 			response.Error(context, -1, err)
@@ -84,6 +120,7 @@ func InvocationHandler(ctx *proxy.Context) {
 		}
 
 		defer resetMarked(meta)
+		context.Set(vars.GinAccount, cookiesContainer.Id(meta))
 		cookies = meta.Cookies
 		logger.Infof("roll now Cookies: %s", cookies)
 
@@ -129,7 +166,7 @@ func InvocationHandler(ctx *proxy.Context) {
 
 	if err != nil {
 		if meta != nil {
-			_ = cookiesContainer.MarkTo(meta, 2)
+			_ = cookiesContainer.MarkFailed(meta, common.ReasonOf(err))
 			logger.Infof("coze websdk[%s] 进入冷却状态", meta.E)
 		}
 		return
@@ -2,6 +2,7 @@ package coze
 
 import (
 	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/store"
 	"chatgpt-adapter/core/logger"
 	"context"
 	"github.com/bincooo/coze-api"
@@ -62,13 +63,13 @@ func condition(proxied string) func(value *account, argv ...interface{}) bool {
 			return false
 		}
 
-		marker, err := cookiesContainer.Marked(value)
+		ok, err := cookiesContainer.Available(value)
 		if err != nil {
 			logger.Error(err)
 			return false
 		}
 
-		if marker != 0 {
+		if !ok {
 			return false
 		}
 
@@ -253,6 +254,7 @@ func runTasks(env *env.Environment, opts ...*obj) (exec bool) {
 
 		item.value.Cookies = o["data"].(string)
 		cookiesContainer.Add(item.value)
+		store.SetCredential("coze", item.value.E, item.value.Cookies)
 		logger.Infof("coze websdk 同步成功[%s]", item.value.E)
 
 		proxied := env.GetString("server.proxied")
@@ -9,6 +9,7 @@ import (
 
 	"chatgpt-adapter/core/common"
 	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/common/store"
 	"chatgpt-adapter/core/common/vars"
 	"chatgpt-adapter/core/gin/response"
 	"chatgpt-adapter/core/logger"
@@ -33,6 +34,12 @@ func init() {
 		cookies := env.GetStringSlice("grok.cookies")
 		cookiesContainer = common.NewPollContainer[string]("grok", cookies, time.Hour)
 		cookiesContainer.Condition = condition
+
+		// 恢复缓存的过盾凭证
+		var cf map[string]string
+		if _, ok := store.Credential("grok", "clearance", &cf); ok {
+			clearance, userAgent, lang = cf["cookie"], cf["userAgent"], cf["lang"]
+		}
 	})
 }
 
@@ -54,13 +61,14 @@ func InvocationHandler(ctx *proxy.Context) {
 		return
 	}
 
-	cookie, err := cookiesContainer.Poll(gtx)
+	cookie, err := cookiesContainer.PollBy(common.StickyKey(gtx), gtx)
 	if err != nil {
 		logger.Error(err)
 		response.Error(gtx, -1, err)
 		return
 	}
 	defer resetMarked(cookie)
+	gtx.Set(vars.GinAccount, cookiesContainer.Id(cookie))
 	gtx.Set("token", cookie)
 
 	//
@@ -76,18 +84,18 @@ func InvocationHandler(ctx *proxy.Context) {
 
 	if err != nil {
 		logger.Error(err)
+		_ = cookiesContainer.MarkFailed(cookie, common.ReasonOf(err))
 		return
 	}
 }
 
 func condition(cookie string, argv ...interface{}) (ok bool) {
-	marker, err := cookiesContainer.Marked(cookie)
+	ok, err := cookiesContainer.Available(cookie)
 	if err != nil {
 		logger.Error(err)
 		return false
 	}
 
-	ok = marker == 0
 	if !ok {
 		return
 	}
@@ -133,7 +141,7 @@ func condition(cookie string, argv ...interface{}) (ok bool) {
 	count := obj["remainingQueries"].(float64)
 	ok = count > 0
 	if !ok {
-		_ = cookiesContainer.MarkTo(cookie, 2)
+		_ = cookiesContainer.MarkFailed(cookie, common.ReasonRateLimited)
 	}
 	return
 }
@@ -176,6 +184,7 @@ func hookCloudflare(env *env.Environment) error {
 	clearance = data["cookie"].(string)
 	userAgent = data["userAgent"].(string)
 	lang = data["lang"].(string)
+	store.SetCredential("grok", "clearance", map[string]string{"cookie": clearance, "userAgent": userAgent, "lang": lang})
 	return nil
 }
 
@@ -10,6 +10,8 @@ import (
 
 	"chatgpt-adapter/core/common"
 	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/common/quota"
+	"chatgpt-adapter/core/common/store"
 	"chatgpt-adapter/core/common/vars"
 	"chatgpt-adapter/core/gin/response"
 	"chatgpt-adapter/core/logger"
@@ -37,6 +39,12 @@ func init() {
 		cookies := env.GetStringSlice("you.cookies")
 		cookiesContainer = common.NewPollContainer[string]("you", cookies, 6*time.Hour)
 		cookiesContainer.Condition = condition(env)
+
+		// 恢复缓存的过盾凭证
+		var cf map[string]string
+		if _, ok := store.Credential("you", "clearance", &cf); ok {
+			clearance, userAgent, lang = cf["cookie"], cf["userAgent"], cf["lang"]
+		}
 		if len(cookies) > 0 && env.GetBool("you.task") {
 			go timer(env)
 		}
@@ -102,13 +110,14 @@ func InvocationHandler(ctx *proxy.Context) {
 		return
 	}
 
-	cookies, err := cookiesContainer.Poll()
+	cookies, err := cookiesContainer.PollBy(common.StickyKey(gtx))
 	if err != nil {
 		logger.Error(err)
 		response.Error(gtx, -1, err)
 		return
 	}
 	defer resetMarked(cookies)
+	gtx.Set(vars.GinAccount, cookiesContainer.Id(cookies))
 	gtx.Set("token", cookies)
 	gtx.Set("clearance", clearance)
 	gtx.Set("userAgent", userAgent)
@@ -127,17 +136,16 @@ func InvocationHandler(ctx *proxy.Context) {
 
 	if err != nil {
 		logger.Error(err)
-		var se emit.Error
-		if errors.As(err, &se) && se.Code > 400 {
-			_ = cookiesContainer.MarkTo(cookies, 2)
-			// 403 重定向？？？
-			if se.Code == 403 {
-				cleanCloudflare()
-			}
+		reason := common.ReasonOf(err)
+		if strings.Contains(err.Error(), "ZERO QUOTA") {
+			reason = common.ReasonRateLimited
 		}
+		_ = cookiesContainer.MarkFailed(cookies, reason)
 
-		if strings.Contains(err.Error(), "ZERO QUOTA") {
-			_ = cookiesContainer.MarkTo(cookies, 2)
+		// 403 重定向？？？
+		var se emit.Error
+		if errors.As(err, &se) && se.Code == 403 {
+			cleanCloudflare()
 		}
 		return
 	}
@@ -146,13 +154,13 @@ func InvocationHandler(ctx *proxy.Context) {
 func condition(env *env.Environment) func(string, ...interface{}) bool {
 	return func(cookies string, argv ...interface{}) bool {
 
-		marker, err := cookiesContainer.Marked(cookies)
+		ok, err := cookiesContainer.Available(cookies)
 		if err != nil {
 			logger.Error(err)
 			return false
 		}
 
-		if marker != 0 {
+		if !ok {
 			return false
 		}
 
@@ -172,19 +180,22 @@ func condition(env *env.Environment) func(string, ...interface{}) bool {
 					_ = hookCloudflare(env)
 				}
 				if se.Code == 401 { // cookie 失效？？？
-					_ = cookiesContainer.MarkTo(cookies, 2)
+					_ = cookiesContainer.MarkFailed(cookies, common.ReasonUnauthorized)
 				}
 			}
 			logger.Error(err)
 			return false
 		}
 
+		id := cookiesContainer.Id(cookies)
+		quota.Report(id, count)
 		if count <= 0 {
-			_ = cookiesContainer.MarkTo(cookies, 2)
+			_ = cookiesContainer.MarkFailed(cookies, common.ReasonRateLimited)
 			return false
 		}
 
-		return true
+		// 剩余次数低于 quota.reserve 时跳过
+		return quota.Allow(id)
 	}
 }
 
@@ -249,6 +260,7 @@ func hookCloudflare(env *env.Environment) error {
 	clearance = data["cookie"].(string)
 	userAgent = data["userAgent"].(string)
 	lang = data["lang"].(string)
+	store.SetCredential("you", "clearance", map[string]string{"cookie": clearance, "userAgent": userAgent, "lang": lang})
 	return nil
 }
 
@@ -256,6 +268,7 @@ func cleanCloudflare() {
 	mu.Lock()
 	clearance = ""
 	mu.Unlock()
+	store.SetCredential("you", "clearance", nil)
 }
 
 func elseOf[T any](obj any) (zero T) {
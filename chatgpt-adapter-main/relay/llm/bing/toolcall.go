@@ -73,7 +73,7 @@ func toolChoice(ctx *gin.Context, completion model.Completion) bool {
 			return "", err
 		}
 
-		return waitMessage(buffer, toolcall.Cancel)
+		return waitMessage(buffer, toolcall.Stream(ctx))
 	})
 
 	if err != nil {
@@ -30,7 +30,7 @@ func toolChoice(ctx *gin.Context, env *env.Environment, proxies, cookie string,
 			return "", err
 		}
 
-		return waitMessage(r, toolcall.Cancel)
+		return waitMessage(r, toolcall.Stream(ctx))
 	})
 
 	if err != nil {
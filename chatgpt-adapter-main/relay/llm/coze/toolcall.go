@@ -59,7 +59,7 @@ func toolChoice(ctx *gin.Context, cookie, proxies string, completion model.Compl
 			return "", err
 		}
 
-		return waitMessage(chatResponse, toolcall.Cancel)
+		return waitMessage(chatResponse, toolcall.Stream(ctx))
 	})
 
 	if err != nil {
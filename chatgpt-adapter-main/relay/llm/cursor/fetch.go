@@ -3,12 +3,15 @@ package cursor
 import (
 	"chatgpt-adapter/core/cache"
 	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/quota"
+	"chatgpt-adapter/core/common/vars"
 	"chatgpt-adapter/core/gin/model"
 	"chatgpt-adapter/core/logger"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/bincooo/emit.io"
 	"github.com/gin-gonic/gin"
@@ -20,6 +23,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -29,14 +33,9 @@ var (
 )
 
 func fetch(ctx *gin.Context, env *env.Environment, cookie string, buffer []byte) (response *http.Response, err error) {
-	//count, err := checkUsage(ctx, env, 150)
-	//if err != nil {
-	//	return
-	//}
-	//if count <= 0 {
-	//	err = fmt.Errorf("invalid usage")
-	//	return
-	//}
+	if err = checkQuota(ctx, env); err != nil {
+		return
+	}
 	key := uuid.NewString()
 	message := &BidiAppend{
 		Chunk: hex.EncodeToString(buffer),
@@ -205,6 +204,36 @@ func newMessage() (msg ChatMessage, err error) {
 	return
 }
 
+const usageInterval = 10 * time.Minute
+
+// 上次查询上游用量的时间，查询失败时也等待 usageInterval 后再重试
+var usageChecked sync.Map
+
+func usageDue(id string) bool {
+	now := time.Now()
+	if last, ok := usageChecked.Load(id); ok && now.Sub(last.(time.Time)) < usageInterval {
+		return false
+	}
+	usageChecked.Store(id, now)
+	return true
+}
+
+// 按 quota.pools.cursor 的每月请求数检查额度，并定期查询上游的实际用量
+func checkQuota(ctx *gin.Context, env *env.Environment) error {
+	id := Model + ":" + common.CalcHex(ctx.GetString("token"))[:12]
+	ctx.Set(vars.GinAccount, id)
+
+	if q, ok := quota.Of(id); ok && q.Requests > 0 && quota.Stale(id, usageInterval) && usageDue(id) {
+		count, err := checkUsage(ctx, env, q.Requests)
+		if err != nil {
+			logger.Error(err)
+		} else {
+			quota.Report(id, count)
+		}
+	}
+	return quota.Check(id)
+}
+
 func checkUsage(ctx *gin.Context, env *env.Environment, max int) (count int, err error) {
 	var (
 		cookie = ctx.GetString("token")
@@ -236,14 +265,14 @@ func checkUsage(ctx *gin.Context, env *env.Environment, max int) (count int, err
 		return
 	}
 
-	if som, ok := obj["startOfMonth"]; ok {
-		t, e := time.Parse("2006-01-02T15:04:05.000Z", som.(string))
+	// 计费周期开始超过 14 天时上游的用量不可信，不作为剩余次数
+	if som, ok := obj["startOfMonth"].(string); ok {
+		t, e := time.Parse("2006-01-02T15:04:05.000Z", som)
 		if e != nil {
 			logger.Error(e)
-		} else {
-			if t.Before(time.Now().Add(-(14 * 24 * time.Hour))) { // 超14天
-				return
-			}
+		} else if t.Before(time.Now().Add(-(14 * 24 * time.Hour))) { // 超14天
+			err = errors.New("the cursor usage is unknown: the billing month started more than 14 days ago")
+			return
 		}
 	}
 
@@ -256,8 +285,9 @@ func checkUsage(ctx *gin.Context, env *env.Environment, max int) (count int, err
 			continue
 		}
 
-		i := value["numRequests"].(float64)
-		count += int(i)
+		if i, ok := value["numRequests"].(float64); ok {
+			count += int(i)
+		}
 	}
 
 	count = max - count
@@ -36,7 +36,7 @@ func toolChoice(ctx *gin.Context, env *env.Environment, cookie string, completio
 			return "", err
 		}
 
-		return waitMessage(r, toolcall.Cancel)
+		return waitMessage(r, toolcall.Stream(ctx))
 	})
 
 	if err != nil {
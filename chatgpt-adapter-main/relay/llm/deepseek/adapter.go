@@ -2,6 +2,8 @@ package deepseek
 
 import (
 	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/quota"
+	"chatgpt-adapter/core/common/vars"
 	"chatgpt-adapter/core/gin/inter"
 	"chatgpt-adapter/core/gin/model"
 	"chatgpt-adapter/core/gin/response"
@@ -65,6 +67,10 @@ func (api *api) Completion(ctx *gin.Context) (err error) {
 		completion = common.GetGinCompletion(ctx)
 	)
 
+	if err = checkQuota(ctx); err != nil {
+		return
+	}
+
 	request, err := convertRequest(ctx, api.env, completion)
 	if err != nil {
 		logger.Error(err)
@@ -84,3 +90,10 @@ func (api *api) Completion(ctx *gin.Context) (err error) {
 	}
 	return
 }
+
+// deepseek 没有查询用量的接口，按 quota.pools.deepseek 在本地计数
+func checkQuota(ctx *gin.Context) error {
+	id := Model + ":" + common.CalcHex(ctx.GetString("token"))[:12]
+	ctx.Set(vars.GinAccount, id)
+	return quota.Check(id)
+}
@@ -3,6 +3,8 @@ package deepseek
 import (
 	"bytes"
 	"chatgpt-adapter/core/common"
+	"chatgpt-adapter/core/common/inited"
+	"chatgpt-adapter/core/common/store"
 	"chatgpt-adapter/core/gin/model"
 	"chatgpt-adapter/core/gin/response"
 	"chatgpt-adapter/core/logger"
@@ -30,6 +32,16 @@ var (
 	calcServer = "https://wik5ez2o-helper.hf.space"
 )
 
+func init() {
+	inited.AddInitialized(func(*env.Environment) {
+		// 恢复缓存的过盾凭证
+		var cf map[string]string
+		if _, ok := store.Credential("deepseek", "clearance", &cf); ok {
+			clearance, userAgent, lang = cf["cookie"], cf["userAgent"], cf["lang"]
+		}
+	})
+}
+
 //var (
 //	wasmInstance wasm.Instance
 //)
@@ -418,6 +430,7 @@ func hookCloudflare(env *env.Environment) error {
 	clearance = data["cookie"].(string)
 	userAgent = data["userAgent"].(string)
 	lang = data["lang"].(string)
+	store.SetCredential("deepseek", "clearance", map[string]string{"cookie": clearance, "userAgent": userAgent, "lang": lang})
 	return nil
 }
 
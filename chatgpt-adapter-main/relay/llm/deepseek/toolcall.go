@@ -26,6 +26,10 @@ func toolChoice(ctx *gin.Context, env *env.Environment, proxies, cookie string,
 			},
 		}
 
+		if err := checkQuota(ctx); err != nil {
+			return "", err
+		}
+
 		request, err := convertRequest(ctx, env, completion)
 		if err != nil {
 			return "", err
@@ -37,7 +41,7 @@ func toolChoice(ctx *gin.Context, env *env.Environment, proxies, cookie string,
 		}
 
 		defer deleteSession(ctx, env, request.ChatSessionId)
-		return waitMessage(r, toolcall.Cancel)
+		return waitMessage(r, toolcall.Stream(ctx))
 	})
 
 	if err != nil {
@@ -31,7 +31,7 @@ func toolChoice(ctx *gin.Context, env *env.Environment, proxies string, completi
 			return "", err
 		}
 
-		return waitMessage(ch, toolcall.Cancel)
+		return waitMessage(ch, toolcall.Stream(ctx))
 	})
 
 	if err != nil {
@@ -104,6 +104,37 @@ func (api *api) Completion(ctx *gin.Context) (err error) {
 	return
 }
 
+// 上游为 OpenAI 格式接口，直接转发文本补全
+func (api *api) TextCompletion(ctx *gin.Context) (ok bool, err error) {
+	var (
+		cookie     = ctx.GetString("token")
+		proxies    = api.env.GetString("server.proxied")
+		completion = common.GetGinTextCompletion(ctx)
+	)
+
+	r, err := fetchText(ctx, proxies, cookie, completion)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	defer r.Body.Close()
+	ok = true
+	if !completion.Stream {
+		obj, e := emit.ToMap(r)
+		if e != nil {
+			logger.Error(e)
+			response.Error(ctx, -1, e)
+			return
+		}
+		ctx.JSON(http.StatusOK, obj)
+		return
+	}
+
+	waitTextResponse(ctx, r)
+	return
+}
+
 func (api *api) Embedding(ctx *gin.Context) (err error) {
 	embedding := common.GetGinEmbedding(ctx)
 	embedding.Model = ctx.GetString(modKey)
@@ -60,6 +60,41 @@ func fetch(ctx *gin.Context, proxies, token string, completion model.Completion)
 	return
 }
 
+func fetchText(ctx *gin.Context, proxies, token string, completion model.TextCompletion) (r *http.Response, err error) {
+	var (
+		baseUrl = ctx.GetString(key)
+	)
+
+	if !ctx.GetBool(upKey) {
+		proxies = ""
+	}
+
+	completion.Model = ctx.GetString(modKey)
+	obj, err := toMap(completion)
+	if err != nil {
+		return nil, err
+	}
+
+	if prompt, ok := completion.Prompt.(string); ok {
+		ctx.Set(ginTokens, response.CalcTokens(prompt))
+	}
+
+	accept := emit.IsJSON
+	if completion.Stream {
+		accept = emit.IsSTREAM
+	}
+
+	r, err = emit.ClientBuilder(common.HTTPClient).
+		Proxies(proxies).
+		Context(ctx).
+		POST(baseUrl+"/completions").
+		Header("Authorization", "Bearer "+token).
+		JSONHeader().
+		Body(obj).
+		DoC(emit.Status(http.StatusOK), accept)
+	return
+}
+
 func toMap(obj interface{}) (mo map[string]interface{}, err error) {
 	if obj == nil {
 		return
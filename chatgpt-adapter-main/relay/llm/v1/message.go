@@ -159,7 +159,10 @@ func waitResponse(ctx *gin.Context, r *http.Response, sse bool) (content string)
 			continue
 		}
 
-		if choice.FinishReason != nil && *choice.FinishReason == "stop" {
+		if choice.FinishReason != nil && (*choice.FinishReason == "stop" || *choice.FinishReason == "length") {
+			if *choice.FinishReason == "length" {
+				ctx.Set(vars.GinFinishReason, "length")
+			}
 			if chat.Usage == nil {
 				chat.Usage = response.CalcUsageTokens(content, tokens)
 			}
@@ -219,3 +222,38 @@ func waitResponse(ctx *gin.Context, r *http.Response, sse bool) (content string)
 	}
 	return
 }
+
+func waitTextResponse(ctx *gin.Context, r *http.Response) {
+	logger.Info("waitTextResponse ...")
+	scanner := bufio.NewScanner(r.Body)
+	for {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				logger.Error(err)
+			}
+			break
+		}
+
+		data := scanner.Text()
+		logger.Tracef("--------- ORIGINAL MESSAGE ---------")
+		logger.Tracef("%s", data)
+
+		if len(data) < 6 || data[:6] != "data: " {
+			continue
+		}
+
+		data = data[6:]
+		if data == "[DONE]" {
+			break
+		}
+
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &obj); err != nil {
+			logger.Error(err)
+			continue
+		}
+		response.Event(ctx, "", obj)
+	}
+
+	response.Event(ctx, "", "[DONE]")
+}
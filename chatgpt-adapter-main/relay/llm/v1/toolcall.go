@@ -25,7 +25,7 @@ func toolChoice(ctx *gin.Context, proxies string, completion model.Completion) b
 			return "", err
 		}
 
-		return waitMessage(r, toolcall.Cancel)
+		return waitMessage(r, toolcall.Stream(ctx))
 	})
 
 	if err != nil {